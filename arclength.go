@@ -0,0 +1,269 @@
+package pmmp
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/npillmayer/arithm"
+)
+
+// --- Arc length and direction times ----------------------------------------
+
+// Precision of arc lengths and of times found by root finding.
+const (
+	arcEpsilon  = 1e-10
+	timeEpsilon = 1e-12
+)
+
+// ArcLength returns the arc length of a path.
+func (p Path) ArcLength() float64 {
+	l := 0.0
+	for i := range p.controls {
+		l += p.bezier(i).arcLength(1)
+	}
+	return l
+}
+
+// ArcTime returns the time at which the arc length of a path, measured from
+// its start, reaches a. As in MetaPost, a negative length is measured
+// backwards from the start of a cyclic path, giving a negative time, and
+// lengths exceeding the arc length of a cyclic path continue into further
+// cycles. For open paths the result is limited to the range of the path.
+func (p Path) ArcTime(a float64) float64 {
+	if a < 0 {
+		if !p.cycle {
+			return 0
+		}
+		return -p.Reverse().ArcTime(-a)
+	}
+	cycles := 0.0
+	if total := p.ArcLength(); p.cycle && total > 0 && a > total {
+		cycles = math.Floor(a / total)
+		a -= cycles * total
+	}
+	for i := range p.controls {
+		b := p.bezier(i)
+		l := b.arcLength(1)
+		if a <= l {
+			return cycles*float64(p.Length()) + float64(i) + b.arcTime(a, l)
+		}
+		a -= l
+	}
+	return cycles*float64(p.Length()) + float64(p.Length())
+}
+
+// DirectionTime returns the first time at which a path is heading in
+// direction d, or -1 if it never does. Corners at knots count as heading in
+// every direction they turn through. The direction (0,0) is found at time 0.
+func (p Path) DirectionTime(d arithm.Pair) float64 {
+	if d == 0 {
+		return 0
+	}
+	if !p.IsKnown() || len(p.controls) == 0 {
+		return -1
+	}
+	for i := range p.controls {
+		if i > 0 && p.turnsThrough(i, d) {
+			return float64(i)
+		}
+		if t := p.bezier(i).directionTime(d); t >= 0 {
+			return float64(i) + t
+		}
+	}
+	if p.cycle && p.turnsThrough(p.Length(), d) {
+		return float64(p.Length())
+	}
+	return -1
+}
+
+// DirectionPoint returns the point of a path at its direction time for d.
+// The flag is false if the path never heads in direction d.
+func (p Path) DirectionPoint(d arithm.Pair) (arithm.Pair, bool) {
+	t := p.DirectionTime(d)
+	if t < 0 {
+		return 0, false
+	}
+	return p.Point(t), true
+}
+
+// turnsThrough is a predicate: does the path have a corner at knot k, which
+// turns through direction d?
+func (p Path) turnsThrough(k int, d arithm.Pair) bool {
+	in := p.bezier(k - 1).tangent(1)
+	out := p.bezier(k).tangent(0)
+	if in == 0 || out == 0 {
+		return false
+	}
+	turn := cmplx.Phase(complex128(out / in))
+	phi := cmplx.Phase(complex128(d / in))
+	if turn > 0 {
+		return phi >= 0 && phi <= turn
+	}
+	return phi <= 0 && phi >= turn
+}
+
+// derivative returns the derivative of a curve at time t.
+func (b bezier) derivative(t float64) arithm.Pair {
+	s := 1 - t
+	return (b[1]-b[0])*arithm.P(3*s*s, 0) + (b[2]-b[1])*arithm.P(6*s*t, 0) +
+		(b[3]-b[2])*arithm.P(3*t*t, 0)
+}
+
+// tangent returns the direction of a curve at time t. Where the derivative
+// vanishes, e.g. at an end with a control point coinciding with the knot,
+// the direction is taken from the control polygon instead.
+func (b bezier) tangent(t float64) arithm.Pair {
+	if d := b.derivative(t); cmplx.Abs(complex128(d)) > arcEpsilon {
+		return d
+	}
+	if t < 0.5 {
+		for _, z := range b[1:] {
+			if z != b[0] {
+				return z - b[0]
+			}
+		}
+		return 0
+	}
+	for _, z := range []arithm.Pair{b[2], b[1], b[0]} {
+		if z != b[3] {
+			return b[3] - z
+		}
+	}
+	return 0
+}
+
+// speed returns the absolute value of the derivative of a curve at time t.
+func (b bezier) speed(t float64) float64 {
+	return cmplx.Abs(complex128(b.derivative(t)))
+}
+
+// arcLength returns the arc length of a curve from time 0 to time t, using
+// adaptive Simpson integration of its speed.
+func (b bezier) arcLength(t float64) float64 {
+	if t <= 0 {
+		return 0
+	}
+	f0, fm, f1 := b.speed(0), b.speed(t/2), b.speed(t)
+	whole := t / 6 * (f0 + 4*fm + f1)
+	return b.simpson(0, t, f0, fm, f1, whole, arcEpsilon, 40)
+}
+
+// simpson refines the Simpson estimate whole of the arc length between times
+// t0 and t1 until it is precise to eps.
+func (b bezier) simpson(t0, t1, f0, fm, f1, whole, eps float64, depth int) float64 {
+	tm := (t0 + t1) / 2
+	fl, fr := b.speed((t0+tm)/2), b.speed((tm+t1)/2)
+	left := (tm - t0) / 6 * (f0 + 4*fl + fm)
+	right := (t1 - tm) / 6 * (fm + 4*fr + f1)
+	if depth <= 0 || math.Abs(left+right-whole) <= 15*eps {
+		return left + right + (left+right-whole)/15
+	}
+	return b.simpson(t0, tm, f0, fl, fm, left, eps/2, depth-1) +
+		b.simpson(tm, t1, fm, fr, f1, right, eps/2, depth-1)
+}
+
+// arcTime returns the time at which the arc length of a curve reaches a,
+// with 0 ≤ a ≤ l and l the arc length of the whole curve. As arc length is
+// monotone in time, Newton steps are safe as long as they stay within the
+// bracket of the root; otherwise the bracket is bisected.
+func (b bezier) arcTime(a, l float64) float64 {
+	if a <= 0 {
+		return 0
+	}
+	if a >= l {
+		return 1
+	}
+	lo, hi := 0.0, 1.0
+	t := a / l
+	for i := 0; i < 100 && hi-lo > timeEpsilon; i++ {
+		f := b.arcLength(t) - a
+		if math.Abs(f) <= arcEpsilon {
+			break
+		}
+		if f < 0 {
+			lo = t
+		} else {
+			hi = t
+		}
+		if v := b.speed(t); v > 0 {
+			t -= f / v
+		}
+		if t <= lo || t >= hi || math.IsNaN(t) {
+			t = (lo + hi) / 2
+		}
+	}
+	return t
+}
+
+// directionTime returns the first time at which a curve is heading in
+// direction d, or -1 if it never does. The curve is rotated such that d
+// points along the x-axis; candidate times are then the roots of the
+// y-component of its derivative.
+func (b bezier) directionTime(d arithm.Pair) float64 {
+	rot := arithm.Pair(cmplx.Conj(complex128(d))) / arithm.P(cmplx.Abs(complex128(d)), 0)
+	a, c, e := (b[1]-b[0])*rot, (b[2]-b[1])*rot, (b[3]-b[2])*rot
+	// derivative/3 = (1-t)²a + 2t(1-t)c + t²e
+	y, vanishing := quadraticRoots(a.Y()-2*c.Y()+e.Y(), 2*(c.Y()-a.Y()), a.Y())
+	if vanishing { // heading along the x-axis only
+		x, _ := quadraticRoots(a.X()-2*c.X()+e.X(), 2*(c.X()-a.X()), a.X())
+		for _, t := range append([]float64{0}, x...) {
+			if b.derivativeAlong(math.Min(t+timeEpsilon, 1), rot) > 0 {
+				return t
+			}
+		}
+		return -1
+	}
+	for _, t := range y {
+		if b.derivativeAlong(t, rot) > 0 {
+			return t
+		}
+	}
+	return -1
+}
+
+// derivativeAlong returns the x-component of the tangent of a curve at time
+// t, rotated by rot.
+func (b bezier) derivativeAlong(t float64, rot arithm.Pair) float64 {
+	return (b.tangent(t) * rot).X()
+}
+
+// quadraticRoots returns the roots of a·t² + b·t + c within [0,1] in
+// ascending order. The flag is true if the polynomial vanishes identically.
+func quadraticRoots(a, b, c float64) ([]float64, bool) {
+	scale := math.Max(math.Abs(a), math.Max(math.Abs(b), math.Abs(c)))
+	if scale == 0 {
+		return nil, true
+	}
+	var roots []float64
+	a, b, c = a/scale, b/scale, c/scale
+	eps := 1e-9
+	switch {
+	case math.Abs(a) <= eps && math.Abs(b) <= eps:
+		return nil, false
+	case math.Abs(a) <= eps:
+		roots = append(roots, -c/b)
+	default:
+		disc := b*b - 4*a*c
+		if disc < -eps {
+			return nil, false
+		}
+		if disc < 0 {
+			disc = 0
+		}
+		q := -(b + math.Copysign(math.Sqrt(disc), b)) / 2
+		roots = append(roots, q/a)
+		if q != 0 {
+			roots = append(roots, c/q)
+		}
+	}
+	var inside []float64
+	for _, t := range roots {
+		if t >= -eps && t <= 1+eps {
+			inside = append(inside, math.Max(0, math.Min(t, 1)))
+		}
+	}
+	if len(inside) == 2 && inside[0] > inside[1] {
+		inside[0], inside[1] = inside[1], inside[0]
+	}
+	return inside, false
+}
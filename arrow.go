@@ -0,0 +1,59 @@
+package pmmp
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/npillmayer/arithm"
+)
+
+// --- Arrowheads ------------------------------------------------------------
+
+// Arrowhead returns the contour of an arrowhead at the end of a path, as
+// plain MetaPost's arrowhead does: the part of the path within a distance
+// of length from its end is rotated around the end by half the angle (in
+// degrees) in either direction, and the two copies are joined to a cycle.
+// The arrowhead therefore follows the curvature of the path.
+func (p Path) Arrowhead(length, angle float64) Path {
+	if !p.IsKnown() {
+		return Path{}
+	}
+	n := float64(p.Length())
+	e := p.Point(n)
+	circle := PenCircle().MakePath()
+	circle, _ = circle.Transformed(Scaling(FromFloat(2*length), FromFloat(2*length)))
+	circle, _ = circle.Transformed(Shifting(FromFloat(e.X()), FromFloat(e.Y())))
+	tip := p.Subpath(0, n) // the cuttings of p cutafter circle
+	if t, _ := p.Reverse().IntersectionTimes(circle); t >= 0 {
+		tip = p.Reverse().Subpath(0, t).Reverse()
+	}
+	rotated := func(deg float64) []bezier {
+		rot := arithm.Pair(cmplx.Rect(1, deg*math.Pi/180))
+		segs := tip.segments()
+		for i, b := range segs {
+			for j, z := range b {
+				segs[i][j] = e + (z-e)*rot
+			}
+		}
+		return segs
+	}
+	segs := append(rotated(angle/2), reverseBeziers(rotated(-angle/2))...)
+	from, to := segs[len(segs)-1][3], segs[0][0]
+	segs = append(segs, bezier{from, from + (to-from)/3, to - (to-from)/3, to})
+	knots := make([]arithm.Pair, len(segs))
+	controls := make([][2]arithm.Pair, len(segs))
+	for i, b := range segs {
+		knots[i] = b[0]
+		controls[i] = [2]arithm.Pair{b[1], b[2]}
+	}
+	return explicitPath(knots, controls, true)
+}
+
+// reverseBeziers returns a list of consecutive curves, traversed backwards.
+func reverseBeziers(segs []bezier) []bezier {
+	r := make([]bezier, len(segs))
+	for i, b := range segs {
+		r[len(segs)-1-i] = b.reverse()
+	}
+	return r
+}
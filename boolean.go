@@ -0,0 +1,49 @@
+package pmmp
+
+// --- Boolean ---------------------------------------------------------------
+
+// Boolean is a known or unknown boolean value.
+//
+// The zero value is an unknown boolean.
+type Boolean struct {
+	value bool
+	known bool
+}
+
+// NewBoolean creates a known boolean value.
+func NewBoolean(b bool) Boolean {
+	return Boolean{value: b, known: true}
+}
+
+// Self returns this boolean, wrapped into a ValueBase struct.
+func (b Boolean) Self() ValueBase {
+	return ValueBase{b}
+}
+
+// IsKnown is a predicate: is this a known value?
+func (b Boolean) IsKnown() bool {
+	return b.known
+}
+
+// Type returns BooleanType.
+func (b Boolean) Type() ValueType {
+	return BooleanType
+}
+
+// AsBool returns a known boolean value as a bool, or false.
+func (b Boolean) AsBool() bool {
+	if !b.known {
+		tracer().Errorf("value is not a known boolean")
+	}
+	return b.value
+}
+
+func (b Boolean) String() string {
+	if !b.known {
+		return "<unknown boolean>"
+	}
+	if b.value {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,156 @@
+package pmmp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// --- Color -----------------------------------------------------------------
+
+// ColorPart is the name of a part of a color.
+type ColorPart int8
+
+// Parts of RGB colors and of CMYK colors
+const (
+	RedPart ColorPart = iota
+	GreenPart
+	BluePart
+	CyanPart
+	MagentaPart
+	YellowPart
+	BlackPart
+)
+
+var colorPartNames = [7]string{
+	"redpart", "greenpart", "bluepart",
+	"cyanpart", "magentapart", "yellowpart", "blackpart",
+}
+
+func (p ColorPart) String() string {
+	return colorPartNames[p]
+}
+
+// Color is a known or unknown color, either in the RGB color model (type
+// color) or in the CMYK color model (type cmykcolor). Like the parts of a
+// pair, each part may be an unknown linear polynomial.
+//
+// The zero value is an unknown RGB color.
+type Color struct {
+	parts []Numeric // red, green, blue or cyan, magenta, yellow, black
+}
+
+// NewColor creates an RGB color from its parts.
+func NewColor(r, g, b Numeric) Color {
+	return Color{parts: []Numeric{r, g, b}}
+}
+
+// NewCMYKColor creates a CMYK color from its parts.
+func NewCMYKColor(c, m, y, k Numeric) Color {
+	return Color{parts: []Numeric{c, m, y, k}}
+}
+
+// Greyscale creates an RGB color with all parts set to g.
+func Greyscale(g Numeric) Color {
+	return NewColor(g, g, g)
+}
+
+// Self returns this color, wrapped into a ValueBase struct.
+func (c Color) Self() ValueBase {
+	return ValueBase{c}
+}
+
+// IsKnown is a predicate: is this a known value?
+func (c Color) IsKnown() bool {
+	if len(c.parts) == 0 {
+		return false
+	}
+	for _, p := range c.parts {
+		if !p.IsKnown() {
+			return false
+		}
+	}
+	return true
+}
+
+// Type returns ColorType or CMYKColorType.
+func (c Color) Type() ValueType {
+	if c.IsCMYK() {
+		return CMYKColorType
+	}
+	return ColorType
+}
+
+// IsCMYK is a predicate: is this a color of the CMYK color model?
+func (c Color) IsCMYK() bool {
+	return len(c.parts) == 4
+}
+
+// Parts returns the parts of a color, i.e. red, green and blue for RGB
+// colors, or cyan, magenta, yellow and black for CMYK colors.
+func (c Color) Parts() []Numeric {
+	return append([]Numeric(nil), c.parts...)
+}
+
+// Part returns a part of a color. It is an error to ask for a CMYK part of
+// an RGB color, and vice versa.
+func (c Color) Part(p ColorPart) (Numeric, error) {
+	i := int(p)
+	if c.IsCMYK() {
+		i -= int(CyanPart)
+	}
+	if i < 0 || i >= len(c.parts) {
+		return Numeric{}, fmt.Errorf("%s of %v", p, c.Type())
+	}
+	return c.parts[i], nil
+}
+
+// Plus is c + d, part by part. Both colors have to be of the same color model.
+func (c Color) Plus(d Color) (Color, error) {
+	if c.Type() != d.Type() {
+		return Color{}, fmt.Errorf("cannot add %v and %v", c.Type(), d.Type())
+	}
+	r := Color{parts: make([]Numeric, len(c.parts))}
+	for i := range r.parts {
+		r.parts[i] = c.parts[i].Plus(d.parts[i])
+	}
+	return r, nil
+}
+
+// Minus is c - d, part by part. Both colors have to be of the same color
+// model.
+func (c Color) Minus(d Color) (Color, error) {
+	if c.Type() != d.Type() {
+		return Color{}, fmt.Errorf("cannot subtract %v from %v", d.Type(), c.Type())
+	}
+	r := Color{parts: make([]Numeric, len(c.parts))}
+	for i := range r.parts {
+		r.parts[i] = c.parts[i].Minus(d.parts[i])
+	}
+	return r, nil
+}
+
+// Times scales a color by n. Either n or the color has to be known,
+// otherwise the result would not be linear.
+func (c Color) Times(n Numeric) (Color, error) {
+	r := Color{parts: make([]Numeric, len(c.parts))}
+	var err error
+	for i := range r.parts {
+		if r.parts[i], err = c.parts[i].Times(n); err != nil {
+			return Color{}, err
+		}
+	}
+	return r, nil
+}
+
+func (c Color) String() string {
+	var b strings.Builder
+	b.WriteString("(")
+	for i, p := range c.parts {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(p.Self().String())
+	}
+	b.WriteString(")")
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package corelang
+
+import (
+	"fmt"
+
+	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
+)
+
+// defineColors defines color values, the color part operators and the
+// color drawing options. Colors are written as triples (r,g,b) or quadruples
+// (c,m,y,k) of numerics; arithmetic on colors is done by the expression
+// operators.
+func defineColors(env *terex.Environment) {
+	makeColor := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, _ := setupFrom(e, env)
+		n := 3
+		if lexeme == "make-cmykcolor" {
+			n = 4
+		}
+		v, errelem := operands(e, n, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		parts := make([]pmmp.Numeric, n)
+		for i, x := range v {
+			if !x.Self().IsNumeric() {
+				return ErrorPacker("parts of a color have to be numeric", env)
+			}
+			parts[i] = x.Self().AsNumeric()
+		}
+		if n == 4 {
+			return terex.Elem(pmmp.NewCMYKColor(parts[0], parts[1], parts[2], parts[3]))
+		}
+		return terex.Elem(pmmp.NewColor(parts[0], parts[1], parts[2]))
+	}
+	env.Defn("make-color", makeColor)
+	env.Defn("make-cmykcolor", makeColor)
+	part := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, _ := setupFrom(e, env)
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		if !v[0].Self().IsColor() {
+			return ErrorPacker(fmt.Sprintf("%s of %v", lexeme, v[0].Type()), env)
+		}
+		for p := pmmp.RedPart; p <= pmmp.BlackPart; p++ {
+			if p.String() == lexeme {
+				n, err := v[0].Self().AsColor().Part(p)
+				if err != nil {
+					return ErrorPacker(err.Error(), env)
+				}
+				return terex.Elem(n)
+			}
+		}
+		return ErrorPacker(fmt.Sprintf("unknown color part %s", lexeme), env)
+	}
+	for p := pmmp.RedPart; p <= pmmp.BlackPart; p++ {
+		env.Defn(p.String(), part)
+	}
+	option := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, _ := setupFrom(e, env)
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		c, err := drawingColor(lexeme, v[0])
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		return terex.Elem(c)
+	}
+	for _, opt := range []string{"withcolor", "withrgbcolor", "withcmykcolor", "withgreyscale"} {
+		env.Defn(opt, option)
+	}
+}
+
+// drawingColor checks the argument of a color drawing option and returns the
+// color it denotes. withcolor accepts colors of either model and numerics
+// as grey levels, the other options accept only their respective type.
+func drawingColor(option string, arg pmmp.Value) (pmmp.Color, error) {
+	if !arg.IsKnown() {
+		return pmmp.Color{}, fmt.Errorf("%s needs a known value, have %v", option, arg.Self())
+	}
+	switch {
+	case arg.Self().IsNumeric() && (option == "withcolor" || option == "withgreyscale"):
+		return pmmp.Greyscale(arg.Self().AsNumeric()), nil
+	case arg.Type() == pmmp.ColorType && (option == "withcolor" || option == "withrgbcolor"):
+		return arg.Self().AsColor(), nil
+	case arg.Type() == pmmp.CMYKColorType && (option == "withcolor" || option == "withcmykcolor"):
+		return arg.Self().AsColor(), nil
+	}
+	return pmmp.Color{}, fmt.Errorf("%s: illegal argument of type %v", option, arg.Type())
+}
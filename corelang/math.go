@@ -0,0 +1,258 @@
+package corelang
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/npillmayer/arithm"
+	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
+)
+
+// defineMathOps defines MetaPost's numeric primitives and the numeric
+// operators of plain MetaPost: the unary operators sqrt, sind, cosd, mlog,
+// mexp, floor, ceiling, round, abs, angle, dir, unitvector and
+// uniformdeviate, the nullary normaldeviate, the randomseed command, the
+// Pythagorean addition and subtraction ++ and +-+, the operators **, div
+// and mod, and the functions min and max. Operands have to be known, as all
+// of these operations are nonlinear. Random numbers are drawn from the
+// generator of the evaluator, which is set up by randomseed.
+func defineMathOps(env *terex.Environment) {
+	unary := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, _ := setupFrom(e, env)
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		r, err := mathOp1(lexeme, v[0])
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		tracer().Debugf("%s %v = %v", lexeme, v[0].Self(), r.Self())
+		return terex.Elem(r)
+	}
+	for _, op := range []string{
+		"sqrt", "sind", "cosd", "mlog", "mexp", "floor", "ceiling", "round",
+		"abs", "angle", "dir", "unitvector",
+	} {
+		env.Defn(op, unary)
+	}
+	binary := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, _ := setupFrom(e, env)
+		v, errelem := operands(e, 2, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		r, err := mathOp2(lexeme, v[0], v[1])
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		tracer().Debugf("%v %s %v = %v", v[0].Self(), lexeme, v[1].Self(), r.Self())
+		return terex.Elem(r)
+	}
+	for _, op := range []string{"++", "+-+", "**", "div", "mod"} {
+		env.Defn(op, binary)
+	}
+	extremum := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, thread := setupFrom(e, env)
+		var r pmmp.Value
+		for _, a := range flatArgs(e.AsList().Cdr) {
+			el := thread.FetchDecodeExecute(terex.Elem(a))
+			if iserr(el) {
+				return ErrorPacker("error converting arguments", env)
+			}
+			v := value(el)
+			if !v.IsKnown() {
+				return ErrorPacker(fmt.Sprintf("%s of unknown value %v", lexeme, v.Self()), env)
+			}
+			if r == nil {
+				r = v
+				continue
+			}
+			c, err := compare(v, r)
+			if err != nil {
+				return ErrorPacker(fmt.Sprintf("%s: %v", lexeme, err), env)
+			}
+			if lexeme == "min" && c < 0 || lexeme == "max" && c > 0 {
+				r = v
+			}
+		}
+		if r == nil {
+			return ErrorPacker(fmt.Sprintf("%s needs at least one argument", lexeme), env)
+		}
+		return terex.Elem(r)
+	}
+	env.Defn("min", extremum)
+	env.Defn("max", extremum)
+	env.Defn("uniformdeviate", func(e terex.Element, env *terex.Environment) terex.Element {
+		_, _, eval, _ := setupFrom(e, env)
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		if !v[0].IsKnown() || !v[0].Self().IsNumeric() {
+			return ErrorPacker(fmt.Sprintf("uniformdeviate of %v", v[0].Self()), env)
+		}
+		return terex.Elem(pmmp.FromFloat(eval.UniformDeviate(v[0].Self().AsNumeric().AsFloat())))
+	})
+	env.Defn("normaldeviate", func(e terex.Element, env *terex.Environment) terex.Element {
+		_, _, eval, _ := setupFrom(e, env)
+		return terex.Elem(pmmp.FromFloat(eval.NormalDeviate()))
+	})
+	env.Defn("randomseed", func(e terex.Element, env *terex.Environment) terex.Element {
+		_, _, eval, _ := setupFrom(e, env)
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		if !v[0].IsKnown() || !v[0].Self().IsNumeric() {
+			return ErrorPacker(fmt.Sprintf("randomseed needs a known numeric, have %v", v[0].Self()), env)
+		}
+		eval.SetRandomSeed(v[0].Self().AsNumeric().AsFloat())
+		return terex.Elem(nil)
+	})
+}
+
+// flatArgs returns the arguments of a function call. Lists of arguments may
+// be nested, as they are built from left-recursive tertiary lists.
+func flatArgs(l *terex.GCons) []terex.Atom {
+	var r []terex.Atom
+	for ; l != nil; l = l.Cdr {
+		if sub, ok := l.Car.Data.(*terex.GCons); ok && sub != nil && sub.Car.Type() != terex.OperatorType {
+			r = append(r, flatArgs(sub)...)
+			continue
+		}
+		r = append(r, l.Car)
+	}
+	return r
+}
+
+// mathOp1 applies a unary numeric operator. Angles are in degrees.
+func mathOp1(op string, v pmmp.Value) (pmmp.Value, error) {
+	if !v.IsKnown() {
+		return nil, fmt.Errorf("%s of unknown value %v", op, v.Self())
+	}
+	if v.Self().IsPair() {
+		z := v.Self().AsPair().AsPair()
+		switch op {
+		case "abs":
+			return pmmp.FromFloat(cmplx.Abs(complex128(z))), nil
+		case "angle":
+			if z == 0 {
+				return pmmp.FromFloat(0), nil // MetaPost takes angle (0,0) as zero
+			}
+			return pmmp.FromFloat(cmplx.Phase(complex128(z)) * 180 / math.Pi), nil
+		case "unitvector":
+			if z == 0 {
+				return nil, fmt.Errorf("unitvector of (0,0)")
+			}
+			return pmmp.ConvPair(z / arithm.Pair(complex(cmplx.Abs(complex128(z)), 0))), nil
+		case "round", "floor", "ceiling":
+			x, _ := numericOp(op, z.X())
+			y, _ := numericOp(op, z.Y())
+			return pmmp.ConvPair(arithm.P(x, y)), nil
+		}
+	}
+	if !v.Self().IsNumeric() {
+		return nil, fmt.Errorf("%s of %v", op, v.Type())
+	}
+	x := v.Self().AsNumeric().AsFloat()
+	if op == "dir" {
+		return pmmp.ConvPair(arithm.P(cosd(x), sind(x))), nil
+	}
+	r, err := numericOp(op, x)
+	if err != nil {
+		return nil, err
+	}
+	return pmmp.FromFloat(r), nil
+}
+
+// numericOp applies a unary operator to a number.
+func numericOp(op string, x float64) (float64, error) {
+	switch op {
+	case "sqrt":
+		if x < 0 {
+			return 0, fmt.Errorf("square root of %g", x)
+		}
+		return math.Sqrt(x), nil
+	case "sind":
+		return sind(x), nil
+	case "cosd":
+		return cosd(x), nil
+	case "mlog":
+		if x <= 0 {
+			return 0, fmt.Errorf("logarithm of %g", x)
+		}
+		return 256 * math.Log(x), nil
+	case "mexp":
+		return math.Exp(x / 256), nil
+	case "floor":
+		return math.Floor(x), nil
+	case "ceiling":
+		return math.Ceil(x), nil
+	case "round":
+		return math.Floor(x + .5), nil // MetaPost rounds halves up
+	case "abs":
+		return math.Abs(x), nil
+	}
+	return 0, fmt.Errorf("%s of a numeric", op)
+}
+
+// sind and cosd are sine and cosine of angles in degrees. Multiples of 90
+// degrees result in exact values.
+func sind(x float64) float64 {
+	return cosd(x - 90)
+}
+
+func cosd(x float64) float64 {
+	x = math.Mod(x, 360)
+	switch x {
+	case 0:
+		return 1
+	case 90, -270:
+		return 0
+	case 180, -180:
+		return -1
+	case 270, -90:
+		return 0
+	}
+	return math.Cos(x * math.Pi / 180)
+}
+
+// mathOp2 applies a binary numeric operator to known numerics.
+func mathOp2(op string, v1, v2 pmmp.Value) (pmmp.Value, error) {
+	if !v1.IsKnown() || !v2.IsKnown() {
+		return nil, fmt.Errorf("%s of unknown values %v and %v", op, v1.Self(), v2.Self())
+	}
+	if !v1.Self().IsNumeric() || !v2.Self().IsNumeric() {
+		return nil, fmt.Errorf("cannot apply %s to %v and %v", op, v1.Type(), v2.Type())
+	}
+	a, b := v1.Self().AsNumeric().AsFloat(), v2.Self().AsNumeric().AsFloat()
+	var r float64
+	switch op {
+	case "++":
+		r = math.Hypot(a, b)
+	case "+-+":
+		if math.Abs(a) < math.Abs(b) {
+			return nil, fmt.Errorf("Pythagorean subtraction %g+-+%g", a, b)
+		}
+		r = math.Sqrt(a*a - b*b)
+	case "**":
+		r = math.Pow(a, b)
+		if math.IsNaN(r) || math.IsInf(r, 0) {
+			return nil, fmt.Errorf("%g**%g is undefined", a, b)
+		}
+	case "div", "mod":
+		if b == 0 {
+			return nil, fmt.Errorf("%s by zero", op)
+		}
+		r = math.Floor(a / b)
+		if op == "mod" {
+			r = a - b*r
+		}
+	default:
+		return nil, fmt.Errorf("unknown operator %s", op)
+	}
+	return pmmp.FromFloat(r), nil
+}
@@ -0,0 +1,157 @@
+package corelang
+
+import (
+	"fmt"
+
+	"github.com/npillmayer/arithm"
+	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
+)
+
+// definePathOps defines the operators which query paths, intersect them and
+// cut them at intersections. A pair is accepted wherever a path is expected,
+// as a path consisting of a single knot.
+func definePathOps(env *terex.Environment) {
+	ofOp := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, _ := setupFrom(e, env)
+		v, errelem := operands(e, 2, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		p, err := asPath(v[1])
+		if err != nil {
+			return ErrorPacker(fmt.Sprintf("%s: %v", lexeme, err), env)
+		}
+		var r pmmp.Value
+		switch lexeme {
+		case "subpath":
+			if !v[0].IsKnown() || !v[0].Self().IsPair() {
+				return ErrorPacker(fmt.Sprintf("subpath needs a known pair of times, have %v", v[0].Self()), env)
+			}
+			t := v[0].Self().AsPair().AsPair()
+			r = p.Subpath(t.X(), t.Y())
+		case "directiontime", "directionpoint":
+			if !v[0].IsKnown() || !v[0].Self().IsPair() {
+				return ErrorPacker(fmt.Sprintf("%s needs a known direction, have %v", lexeme, v[0].Self()), env)
+			}
+			d := v[0].Self().AsPair().AsPair()
+			if lexeme == "directiontime" {
+				r = pmmp.FromFloat(p.DirectionTime(d))
+				break
+			}
+			z, ok := p.DirectionPoint(d)
+			if !ok {
+				return ErrorPacker(fmt.Sprintf("the direction %v doesn't occur", d), env)
+			}
+			r = pmmp.ConvPair(z)
+		default:
+			if !v[0].IsKnown() || !v[0].Self().IsNumeric() {
+				return ErrorPacker(fmt.Sprintf("%s needs a known numeric, have %v", lexeme, v[0].Self()), env)
+			}
+			t := v[0].Self().AsNumeric().AsFloat()
+			switch lexeme {
+			case "point":
+				r = pmmp.ConvPair(p.Point(t))
+			case "precontrol":
+				r = pmmp.ConvPair(p.PreControl(t))
+			case "postcontrol":
+				r = pmmp.ConvPair(p.PostControl(t))
+			case "direction":
+				r = pmmp.ConvPair(p.Direction(t))
+			case "arctime":
+				r = pmmp.FromFloat(p.ArcTime(t))
+			}
+		}
+		tracer().Debugf("%s %v of %v = %v", lexeme, v[0].Self(), p, r.Self())
+		return terex.Elem(r)
+	}
+	for _, op := range []string{
+		"point", "precontrol", "postcontrol", "direction", "subpath",
+		"arctime", "directiontime", "directionpoint",
+	} {
+		env.Defn(op, ofOp)
+	}
+	env.Defn("reverse", func(e terex.Element, env *terex.Environment) terex.Element {
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		p, err := asPath(v[0])
+		if err != nil {
+			return ErrorPacker(fmt.Sprintf("reverse: %v", err), env)
+		}
+		return terex.Elem(p.Reverse())
+	})
+	env.Defn("arclength", func(e terex.Element, env *terex.Environment) terex.Element {
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		p, err := asPath(v[0])
+		if err != nil {
+			return ErrorPacker(fmt.Sprintf("arclength: %v", err), env)
+		}
+		return terex.Elem(pmmp.FromFloat(p.ArcLength()))
+	})
+	env.Defn("turningnumber", func(e terex.Element, env *terex.Environment) terex.Element {
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		p, err := asPath(v[0])
+		if err != nil {
+			return ErrorPacker(fmt.Sprintf("turningnumber: %v", err), env)
+		}
+		return terex.Elem(pmmp.FromFloat(float64(p.TurningNumber())))
+	})
+	intersection := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, _ := setupFrom(e, env)
+		v, errelem := operands(e, 2, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		p, err := asPath(v[0])
+		if err == nil {
+			var q pmmp.Path
+			if q, err = asPath(v[1]); err == nil {
+				return intersect(lexeme, p, q, env)
+			}
+		}
+		return ErrorPacker(fmt.Sprintf("%s: %v", lexeme, err), env)
+	}
+	for _, op := range []string{"intersectiontimes", "intersectionpoint", "cutbefore", "cutafter"} {
+		env.Defn(op, intersection)
+	}
+}
+
+// intersect applies an intersection operator to paths p and q. Paths which
+// do not intersect have intersection times (-1,-1).
+func intersect(op string, p, q pmmp.Path, env *terex.Environment) terex.Element {
+	switch op {
+	case "intersectiontimes":
+		t, u := p.IntersectionTimes(q)
+		return terex.Elem(pmmp.ConvPair(arithm.P(t, u)))
+	case "intersectionpoint":
+		z, ok := p.IntersectionPoint(q)
+		if !ok {
+			return ErrorPacker("the paths don't intersect", env)
+		}
+		return terex.Elem(pmmp.ConvPair(z))
+	case "cutbefore":
+		return terex.Elem(p.CutBefore(q))
+	}
+	return terex.Elem(p.CutAfter(q))
+}
+
+// asPath converts a known path or pair to a path.
+func asPath(v pmmp.Value) (pmmp.Path, error) {
+	if v.IsKnown() {
+		switch {
+		case v.Self().IsPath():
+			return v.Self().AsPath(), nil
+		case v.Self().IsPair():
+			return pmmp.NewPath([]arithm.Pair{v.Self().AsPair().AsPair()}, nil, false)
+		}
+	}
+	return pmmp.Path{}, fmt.Errorf("known path expected, have %v", v.Self())
+}
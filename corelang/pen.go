@@ -0,0 +1,97 @@
+package corelang
+
+import (
+	"fmt"
+
+	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
+)
+
+// definePens defines pen values, the conversions between pens and paths,
+// penoffset, the pickup command and the withpen drawing option. Pens are
+// transformed by the transformers.
+func definePens(env *terex.Environment) {
+	env.Defn("pencircle", func(e terex.Element, env *terex.Environment) terex.Element {
+		return terex.Elem(pmmp.PenCircle())
+	})
+	env.Defn("pensquare", func(e terex.Element, env *terex.Environment) terex.Element {
+		return terex.Elem(pmmp.PenSquare())
+	})
+	env.Defn("nullpen", func(e terex.Element, env *terex.Environment) terex.Element {
+		return terex.Elem(pmmp.NullPen())
+	})
+	env.Defn("makepen", func(e terex.Element, env *terex.Environment) terex.Element {
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		p, err := asPath(v[0])
+		if err != nil {
+			return ErrorPacker(fmt.Sprintf("makepen: %v", err), env)
+		}
+		pen, err := pmmp.MakePen(p)
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		return terex.Elem(pen)
+	})
+	env.Defn("makepath", func(e terex.Element, env *terex.Environment) terex.Element {
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		pen, err := knownPen("makepath", v[0])
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		return terex.Elem(pen.MakePath())
+	})
+	env.Defn("penoffset", func(e terex.Element, env *terex.Environment) terex.Element {
+		v, errelem := operands(e, 2, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		if !v[0].IsKnown() || !v[0].Self().IsPair() {
+			return ErrorPacker(fmt.Sprintf("penoffset needs a known direction, have %v", v[0].Self()), env)
+		}
+		pen, err := knownPen("penoffset", v[1])
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		return terex.Elem(pmmp.ConvPair(pen.Offset(v[0].Self().AsPair().AsPair())))
+	})
+	env.Defn("pickup", func(e terex.Element, env *terex.Environment) terex.Element {
+		_, _, eval, _ := setupFrom(e, env)
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		pen, err := knownPen("pickup", v[0])
+		if err == nil {
+			err = eval.Pickup(pen)
+		}
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		return terex.Elem(nil)
+	})
+	env.Defn("withpen", func(e terex.Element, env *terex.Environment) terex.Element {
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		pen, err := knownPen("withpen", v[0])
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		return terex.Elem(pen)
+	})
+}
+
+// knownPen checks that the argument of an operator is a known pen.
+func knownPen(op string, v pmmp.Value) (pmmp.Pen, error) {
+	if !v.IsKnown() || !v.Self().IsPen() {
+		return pmmp.Pen{}, fmt.Errorf("%s needs a known pen, have %v", op, v.Self())
+	}
+	return v.Self().AsPen(), nil
+}
@@ -0,0 +1,120 @@
+package corelang
+
+import (
+	"fmt"
+
+	"github.com/npillmayer/arithm"
+	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
+)
+
+// definePictures defines nullpicture, infont, the operators for bounding
+// boxes and the dashed drawing option. The corners of the bounding box, center and
+// bbox apply to pictures, paths and pens. Commands which change pictures are
+// statements of the interpreter.
+func definePictures(env *terex.Environment) {
+	env.Defn("nullpicture", func(e terex.Element, env *terex.Environment) terex.Element {
+		return terex.Elem(pmmp.NullPicture())
+	})
+	env.Defn("infont", func(e terex.Element, env *terex.Environment) terex.Element {
+		_, _, eval, _ := setupFrom(e, env)
+		v, errelem := operands(e, 2, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		for _, x := range v {
+			if !x.IsKnown() || !x.Self().IsString() {
+				return ErrorPacker(fmt.Sprintf("infont needs known strings, have %v", x.Self()), env)
+			}
+		}
+		pic, err := eval.InFont(v[0].Self().AsString().AsString(), v[1].Self().AsString().AsString())
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		return terex.Elem(pic)
+	})
+	corner := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, _ := setupFrom(e, env)
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		ll, ur, err := bbox(lexeme, v[0])
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		var z arithm.Pair
+		switch lexeme {
+		case "llcorner":
+			z = ll
+		case "lrcorner":
+			z = arithm.P(ur.X(), ll.Y())
+		case "ulcorner":
+			z = arithm.P(ll.X(), ur.Y())
+		case "urcorner":
+			z = ur
+		case "center":
+			z = (ll + ur) / 2
+		}
+		return terex.Elem(pmmp.ConvPair(z))
+	}
+	for _, op := range []string{"llcorner", "lrcorner", "ulcorner", "urcorner", "center"} {
+		env.Defn(op, corner)
+	}
+	env.Defn("bbox", func(e terex.Element, env *terex.Environment) terex.Element {
+		_, _, eval, _ := setupFrom(e, env)
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		ll, ur, err := bbox("bbox", v[0])
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		if m := eval.ValueOf("bboxmargin"); m.IsKnown() && m.Self().IsNumeric() {
+			margin := m.Self().AsNumeric().AsFloat()
+			ll, ur = ll-arithm.P(margin, margin), ur+arithm.P(margin, margin)
+		}
+		box, err := pmmp.NewPath([]arithm.Pair{
+			ll, arithm.P(ur.X(), ll.Y()), ur, arithm.P(ll.X(), ur.Y()),
+		}, []pmmp.Join{
+			pmmp.NewJoin("--"), pmmp.NewJoin("--"), pmmp.NewJoin("--"), pmmp.NewJoin("--"),
+		}, true)
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		return terex.Elem(box)
+	})
+	env.Defn("dashed", func(e terex.Element, env *terex.Environment) terex.Element {
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		if !v[0].IsKnown() || !v[0].Self().IsPicture() {
+			return ErrorPacker(fmt.Sprintf("dashed needs a known picture, have %v", v[0].Self()), env)
+		}
+		if _, err := v[0].Self().AsPicture().Dash(); err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		return terex.Elem(v[0].Self().AsPicture())
+	})
+}
+
+// bbox returns the corners of the bounding box of a known picture, path or
+// pen.
+func bbox(op string, v pmmp.Value) (arithm.Pair, arithm.Pair, error) {
+	if v.IsKnown() {
+		switch {
+		case v.Self().IsPicture():
+			ll, ur := v.Self().AsPicture().BBox()
+			return ll, ur, nil
+		case v.Self().IsPath():
+			ll, ur := v.Self().AsPath().BBox()
+			return ll, ur, nil
+		case v.Self().IsPen():
+			ll, ur := v.Self().AsPen().BBox()
+			return ll, ur, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("%s needs a known picture, path or pen, have %v", op, v.Self())
+}
@@ -3,6 +3,10 @@ package corelang
 import (
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/npillmayer/gorgo"
 	"github.com/npillmayer/gorgo/terex"
@@ -13,11 +17,20 @@ import (
 func LoadStandardLanguage() *terex.Environment {
 	env := terex.NewEnvironment("pmmplang", nil)
 	defineExprOps(env)
+	defineRelations(env)
+	defineLogicalOps(env)
+	defineStringOps(env)
+	defineTransforms(env)
+	defineColors(env)
+	definePathOps(env)
+	definePens(env)
+	definePictures(env)
+	defineMathOps(env)
 	return env
 }
 
 func defineExprOps(env *terex.Environment) {
-	env.Defn("SecondaryOp", func(e terex.Element, env *terex.Environment) terex.Element {
+	secondaryOp := func(e terex.Element, env *terex.Environment) terex.Element {
 		lexeme, toktype, _, thread := setupFrom(e, env)
 		tracer().Debugf("call of %s/%s", lexeme, toktype)
 		errelem, _, argv := args(e, 2, env)
@@ -34,19 +47,364 @@ func defineExprOps(env *terex.Environment) {
 		var v pmmp.Value
 		switch lexeme {
 		case "+":
-			//r, err := num1.Self().Plus(num2)
-			v, err = v1.Self().Minus(v2) // TODO Plus
+			v, err = v1.Self().Plus(v2)
 		case "-":
 			v, err = v1.Self().Minus(v2)
 		default:
 			return ErrorPacker(fmt.Sprintf("unknown secondary operator %s", lexeme), env)
 		}
 		if err != nil {
-			//
+			return ErrorPacker(err.Error(), env)
 		}
 		tracer().Debugf("%v %s %v = %s", v1.Self(), lexeme, v2.Self(), v.Self())
 		return terex.Elem(v)
+	}
+	env.Defn("+", secondaryOp)
+	env.Defn("-", secondaryOp)
+	primaryOp := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, _ := setupFrom(e, env)
+		v, errelem := operands(e, 2, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		r, err := scale(lexeme, v[0], v[1])
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		tracer().Debugf("%v %s %v = %s", v[0].Self(), lexeme, v[1].Self(), r.Self())
+		return terex.Elem(r)
+	}
+	env.Defn("*", primaryOp)
+	env.Defn("/", primaryOp)
+	env.Defn("dotprod", primaryOp)
+	env.Defn("negate", func(e terex.Element, env *terex.Environment) terex.Element {
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		r, err := v[0].Self().Negated()
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		return terex.Elem(r)
+	})
+	env.Defn("interpolation", func(e terex.Element, env *terex.Environment) terex.Element {
+		v, errelem := operands(e, 3, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		r, err := interpolate(v[0], v[1], v[2])
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		return terex.Elem(r)
+	})
+	env.Defn("make-pair", func(e terex.Element, env *terex.Environment) terex.Element {
+		_, _, _, thread := setupFrom(e, env)
+		errelem, _, argv := args(e, 2, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		e1 := thread.FetchDecodeExecute(terex.Elem(argv.Nth(1)))
+		e2 := thread.FetchDecodeExecute(terex.Elem(argv.Nth(2)))
+		if iserr(e1) || iserr(e2) {
+			return ErrorPacker("error converting arguments", env)
+		}
+		v1, v2 := value(e1), value(e2)
+		if !v1.Self().IsNumeric() || !v2.Self().IsNumeric() {
+			return ErrorPacker("parts of a pair have to be numeric", env)
+		}
+		return terex.Elem(pmmp.NewPair(v1.Self().AsNumeric(), v2.Self().AsNumeric()))
+	})
+}
+
+// scale calculates v1*v2, v1/v2 or v1 dotprod v2. Multiplication needs at
+// least one numeric operand, division is by known, non-zero numerics only.
+// Products of unknown quantities are not linear and result in an error.
+func scale(op string, v1, v2 pmmp.Value) (pmmp.Value, error) {
+	switch op {
+	case "/":
+		if !v2.Self().IsNumeric() {
+			return nil, fmt.Errorf("division by %v", v2.Type())
+		}
+		return v1.Self().Over(v2.Self().AsNumeric())
+	case "dotprod":
+		return v1.Self().DotProd(v2)
+	}
+	if v2.Self().IsNumeric() {
+		return v1.Self().Times(v2.Self().AsNumeric())
+	}
+	if v1.Self().IsNumeric() {
+		return v2.Self().Times(v1.Self().AsNumeric())
+	}
+	return nil, fmt.Errorf("cannot multiply %v and %v", v1.Type(), v2.Type())
+}
+
+// interpolate calculates t[a,b], i.e. a+t(b-a).
+func interpolate(t, a, b pmmp.Value) (pmmp.Value, error) {
+	if !t.Self().IsNumeric() {
+		return nil, fmt.Errorf("interpolation by %v", t.Type())
+	}
+	d, err := b.Self().Minus(a)
+	if err != nil {
+		return nil, err
+	}
+	if d, err = d.Self().Times(t.Self().AsNumeric()); err != nil {
+		return nil, err
+	}
+	return a.Self().Plus(d)
+}
+
+// defineRelations defines the relational operators. Relations compare
+// known values of equal type, resulting in a boolean. Numerics are compared
+// by value, pairs lexicographically by their x- and y-parts, strings
+// lexicographically, and booleans with false < true.
+func defineRelations(env *terex.Environment) {
+	relation := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, thread := setupFrom(e, env)
+		errelem, _, argv := args(e, 2, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		e1 := thread.FetchDecodeExecute(terex.Elem(argv.Nth(1)))
+		e2 := thread.FetchDecodeExecute(terex.Elem(argv.Nth(2)))
+		if iserr(e1) || iserr(e2) {
+			return ErrorPacker("error converting arguments", env)
+		}
+		v1, v2 := value(e1), value(e2)
+		if !v1.IsKnown() || !v2.IsKnown() {
+			return ErrorPacker(fmt.Sprintf("relation %s of unknown values", lexeme), env)
+		}
+		c, err := compare(v1, v2)
+		if err != nil {
+			return ErrorPacker(fmt.Sprintf("relation %s: %v", lexeme, err), env)
+		}
+		var r bool
+		switch lexeme {
+		case "=", "==":
+			r = c == 0
+		case "≠", "<>":
+			r = c != 0
+		case "<":
+			r = c < 0
+		case ">":
+			r = c > 0
+		case "≤", "<=":
+			r = c <= 0
+		case "≥", ">=":
+			r = c >= 0
+		default:
+			return ErrorPacker(fmt.Sprintf("unknown relation %s", lexeme), env)
+		}
+		tracer().Debugf("%v %s %v = %v", v1.Self(), lexeme, v2.Self(), r)
+		return terex.Elem(pmmp.NewBoolean(r))
+	}
+	for _, op := range []string{"=", "==", "≠", "<>", "<", ">", "≤", "<=", "≥", ">="} {
+		env.Defn(op, relation)
+	}
+}
+
+// compare compares two known values of equal type. It returns -1, 0 or +1.
+func compare(v1, v2 pmmp.Value) (int, error) {
+	if v1.Type() != v2.Type() {
+		return 0, fmt.Errorf("cannot compare %v and %v", v1.Type(), v2.Type())
+	}
+	switch v1.Type() {
+	case pmmp.NumericType:
+		return compareFloats(v1.Self().AsNumeric().AsFloat(), v2.Self().AsNumeric().AsFloat()), nil
+	case pmmp.PairType:
+		p1, p2 := v1.Self().AsPair().AsPair(), v2.Self().AsPair().AsPair()
+		if c := compareFloats(p1.X(), p2.X()); c != 0 {
+			return c, nil
+		}
+		return compareFloats(p1.Y(), p2.Y()), nil
+	case pmmp.StringType:
+		return strings.Compare(v1.Self().AsString().AsString(), v2.Self().AsString().AsString()), nil
+	case pmmp.BooleanType:
+		b1, b2 := v1.Self().AsBoolean().AsBool(), v2.Self().AsBoolean().AsBool()
+		switch {
+		case b1 == b2:
+			return 0, nil
+		case b2:
+			return -1, nil
+		}
+		return 1, nil
+	}
+	return 0, fmt.Errorf("cannot compare values of type %v", v1.Type())
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// defineLogicalOps defines the boolean constants and the logical operators
+// and, or and not. Operands have to be known booleans.
+func defineLogicalOps(env *terex.Environment) {
+	env.Defn("true", func(e terex.Element, env *terex.Environment) terex.Element {
+		return terex.Elem(pmmp.NewBoolean(true))
 	})
+	env.Defn("false", func(e terex.Element, env *terex.Environment) terex.Element {
+		return terex.Elem(pmmp.NewBoolean(false))
+	})
+	logicalOp := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, thread := setupFrom(e, env)
+		errelem, argc, argv := args(e, -1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		if (lexeme == "not") != (argc == 1) || argc < 1 || argc > 2 {
+			return ErrorPacker(fmt.Sprintf("wrong number of arguments for %s", lexeme), env)
+		}
+		var b [2]bool
+		for i := 0; i < argc; i++ {
+			el := thread.FetchDecodeExecute(terex.Elem(argv.Nth(i + 1)))
+			if iserr(el) {
+				return ErrorPacker("error converting arguments", env)
+			}
+			v := value(el)
+			if !v.IsKnown() || !v.Self().IsBoolean() {
+				return ErrorPacker(fmt.Sprintf("%s needs known booleans, have %v", lexeme, v.Self()), env)
+			}
+			b[i] = v.Self().AsBoolean().AsBool()
+		}
+		var r bool
+		switch lexeme {
+		case "and":
+			r = b[0] && b[1]
+		case "or":
+			r = b[0] || b[1]
+		case "not":
+			r = !b[0]
+		}
+		return terex.Elem(pmmp.NewBoolean(r))
+	}
+	env.Defn("and", logicalOp)
+	env.Defn("or", logicalOp)
+	env.Defn("not", logicalOp)
+}
+
+// defineStringOps defines the operators on strings: concatenation &,
+// substring (a,b) of s, length, and the conversions decimal, char and ASCII.
+// length applies to paths, pairs and pictures as well.
+func defineStringOps(env *terex.Environment) {
+	stringOp := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, thread := setupFrom(e, env)
+		argc := 1
+		if lexeme == "&" || lexeme == "substring" {
+			argc = 2
+		}
+		errelem, _, argv := args(e, argc, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		var v [2]pmmp.Value
+		for i := 0; i < argc; i++ {
+			el := thread.FetchDecodeExecute(terex.Elem(argv.Nth(i + 1)))
+			if iserr(el) {
+				return ErrorPacker("error converting arguments", env)
+			}
+			if v[i] = value(el); !v[i].IsKnown() {
+				return ErrorPacker(fmt.Sprintf("%s of unknown value %v", lexeme, v[i].Self()), env)
+			}
+		}
+		var r pmmp.Value
+		var err error
+		switch lexeme {
+		case "&":
+			if !v[0].Self().IsString() || !v[1].Self().IsString() {
+				return ErrorPacker(fmt.Sprintf("cannot concatenate %v and %v", v[0].Type(), v[1].Type()), env)
+			}
+			r = pmmp.NewString(v[0].Self().AsString().AsString() + v[1].Self().AsString().AsString())
+		case "substring":
+			r, err = substring(v[0], v[1])
+		case "length":
+			switch {
+			case v[0].Self().IsString():
+				r = pmmp.FromFloat(float64(len([]rune(v[0].Self().AsString().AsString()))))
+			case v[0].Self().IsPath():
+				r = pmmp.FromFloat(float64(v[0].Self().AsPath().Length()))
+			case v[0].Self().IsPair():
+				r, err = mathOp1("abs", v[0])
+			case v[0].Self().IsPicture():
+				r = pmmp.FromFloat(float64(len(v[0].Self().AsPicture().Components())))
+			default:
+				return ErrorPacker(fmt.Sprintf("length of %v not implemented", v[0].Type()), env)
+			}
+		case "decimal":
+			if !v[0].Self().IsNumeric() {
+				return ErrorPacker(fmt.Sprintf("decimal of %v", v[0].Type()), env)
+			}
+			r = pmmp.NewString(decimal(v[0].Self().AsNumeric().AsFloat()))
+		case "char":
+			if !v[0].Self().IsNumeric() {
+				return ErrorPacker(fmt.Sprintf("char of %v", v[0].Type()), env)
+			}
+			c := math.Round(v[0].Self().AsNumeric().AsFloat())
+			if c < 0 || c > unicode.MaxRune {
+				return ErrorPacker(fmt.Sprintf("char of %g out of range", c), env)
+			}
+			r = pmmp.NewString(string(rune(c)))
+		case "ASCII":
+			if !v[0].Self().IsString() {
+				return ErrorPacker(fmt.Sprintf("ASCII of %v", v[0].Type()), env)
+			}
+			c := -1 // MetaPost's ASCII of an empty string
+			for _, ch := range v[0].Self().AsString().AsString() {
+				c = int(ch)
+				break
+			}
+			r = pmmp.FromFloat(float64(c))
+		}
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		tracer().Debugf("%s %v = %v", lexeme, v[0].Self(), r.Self())
+		return terex.Elem(r)
+	}
+	for _, op := range []string{"&", "substring", "length", "decimal", "char", "ASCII"} {
+		env.Defn(op, stringOp)
+	}
+}
+
+// substring returns the part of a string between two positions, given as
+// a pair. Positions are between characters, starting with 0 in front of the
+// first character. If the first position is greater than the second one,
+// the substring is reversed.
+func substring(pos, str pmmp.Value) (pmmp.Value, error) {
+	if !pos.Self().IsPair() || !str.Self().IsString() {
+		return nil, fmt.Errorf("substring needs a pair and a string, have %v and %v", pos.Type(), str.Type())
+	}
+	s := []rune(str.Self().AsString().AsString())
+	clip := func(x float64) int {
+		return int(math.Max(0, math.Min(float64(len(s)), math.Round(x))))
+	}
+	p := pos.Self().AsPair().AsPair()
+	a, b := clip(p.X()), clip(p.Y())
+	if a <= b {
+		return pmmp.NewString(string(s[a:b])), nil
+	}
+	r := make([]rune, 0, a-b)
+	for i := a - 1; i >= b; i-- {
+		r = append(r, s[i])
+	}
+	return pmmp.NewString(string(r)), nil
+}
+
+// decimal formats a number the way MetaPost does, with at most 5 digits
+// after the decimal point and without trailing zeros.
+func decimal(x float64) string {
+	s := strconv.FormatFloat(x, 'f', 5, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
 }
 
 func args(e terex.Element, n int, env *terex.Environment) (terex.Element, int, *terex.GCons) {
@@ -58,6 +416,24 @@ func args(e terex.Element, n int, env *terex.Environment) (terex.Element, int, *
 	return terex.Elem(nil), argc, l
 }
 
+// operands evaluates the n arguments of an operator to values.
+func operands(e terex.Element, n int, env *terex.Environment) ([]pmmp.Value, terex.Element) {
+	_, _, _, thread := setupFrom(e, env)
+	errelem, _, argv := args(e, n, env)
+	if !errelem.IsNil() {
+		return nil, errelem
+	}
+	values := make([]pmmp.Value, n)
+	for i := range values {
+		el := thread.FetchDecodeExecute(terex.Elem(argv.Nth(i + 1)))
+		if iserr(el) {
+			return nil, ErrorPacker("error converting arguments", env)
+		}
+		values[i] = value(el)
+	}
+	return values, terex.Elem(nil)
+}
+
 func ErrorPacker(emsg string, env *terex.Environment) terex.Element {
 	tracer().Errorf(emsg)
 	env.Error(errors.New(emsg))
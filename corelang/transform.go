@@ -0,0 +1,130 @@
+package corelang
+
+import (
+	"fmt"
+
+	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
+)
+
+// defineTransforms defines transform values and the transformers. A
+// transformer, e.g. shifted, creates a transform from its argument and
+// applies it to a pair, a path, a pen, a picture or a transform; the latter
+// results in the composition of both transforms. Either the transform or the value it is
+// applied to has to be known, as otherwise the result would not be linear.
+func defineTransforms(env *terex.Environment) {
+	env.Defn("identity", func(e terex.Element, env *terex.Environment) terex.Element {
+		return terex.Elem(pmmp.Identity())
+	})
+	transformer := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, _ := setupFrom(e, env)
+		v, errelem := operands(e, 2, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		t, err := makeTransform(lexeme, v[1])
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		var r pmmp.Value
+		switch {
+		case v[0].Self().IsPair():
+			r, err = t.ApplyTo(v[0].Self().AsPair())
+		case v[0].Self().IsTransform():
+			r, err = v[0].Self().AsTransform().Transformed(t)
+		case v[0].Self().IsPen():
+			r, err = v[0].Self().AsPen().Transformed(t)
+		case v[0].Self().IsPath():
+			r, err = v[0].Self().AsPath().Transformed(t)
+		case v[0].Self().IsPicture():
+			r, err = v[0].Self().AsPicture().Transformed(t)
+		default:
+			err = fmt.Errorf("cannot transform a value of type %v", v[0].Type())
+		}
+		if err != nil {
+			return ErrorPacker(fmt.Sprintf("%s: %v", lexeme, err), env)
+		}
+		tracer().Debugf("%v %s %v = %v", v[0].Self(), lexeme, v[1].Self(), r.Self())
+		return terex.Elem(r)
+	}
+	for _, op := range []string{
+		"transformed", "shifted", "scaled", "xscaled", "yscaled", "zscaled", "slanted", "rotated",
+	} {
+		env.Defn(op, transformer)
+	}
+	env.Defn("inverse", func(e terex.Element, env *terex.Environment) terex.Element {
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		if !v[0].Self().IsTransform() {
+			return ErrorPacker(fmt.Sprintf("inverse of %v", v[0].Type()), env)
+		}
+		t, err := v[0].Self().AsTransform().Inverse()
+		if err != nil {
+			return ErrorPacker(err.Error(), env)
+		}
+		return terex.Elem(t)
+	})
+	part := func(e terex.Element, env *terex.Environment) terex.Element {
+		lexeme, _, _, _ := setupFrom(e, env)
+		v, errelem := operands(e, 1, env)
+		if !errelem.IsNil() {
+			return errelem
+		}
+		for p := pmmp.XPart; p <= pmmp.YYPart; p++ {
+			if p.String() != lexeme {
+				continue
+			}
+			switch {
+			case v[0].Self().IsTransform():
+				return terex.Elem(v[0].Self().AsTransform().Part(p))
+			case v[0].Self().IsPair() && p == pmmp.XPart:
+				return terex.Elem(v[0].Self().AsPair().XNumeric())
+			case v[0].Self().IsPair() && p == pmmp.YPart:
+				return terex.Elem(v[0].Self().AsPair().YNumeric())
+			}
+		}
+		return ErrorPacker(fmt.Sprintf("%s of %v", lexeme, v[0].Type()), env)
+	}
+	for p := pmmp.XPart; p <= pmmp.YYPart; p++ {
+		env.Defn(p.String(), part)
+	}
+}
+
+// makeTransform creates the transform for a transformer and its argument.
+func makeTransform(transformer string, arg pmmp.Value) (pmmp.Transform, error) {
+	switch transformer {
+	case "transformed":
+		if arg.Self().IsTransform() {
+			return arg.Self().AsTransform(), nil
+		}
+	case "shifted", "zscaled":
+		if arg.Self().IsPair() {
+			p := arg.Self().AsPair()
+			if transformer == "shifted" {
+				return pmmp.Shifting(p.XNumeric(), p.YNumeric()), nil
+			}
+			return pmmp.ZScaling(p.XNumeric(), p.YNumeric()), nil
+		}
+	case "scaled", "xscaled", "yscaled", "slanted":
+		if arg.Self().IsNumeric() {
+			s, one := arg.Self().AsNumeric(), pmmp.FromFloat(1)
+			switch transformer {
+			case "scaled":
+				return pmmp.Scaling(s, s), nil
+			case "xscaled":
+				return pmmp.Scaling(s, one), nil
+			case "yscaled":
+				return pmmp.Scaling(one, s), nil
+			}
+			return pmmp.Slanting(s), nil
+		}
+	case "rotated":
+		if arg.IsKnown() && arg.Self().IsNumeric() {
+			return pmmp.Rotation(arg.Self().AsNumeric().AsFloat()), nil
+		}
+		return pmmp.Transform{}, fmt.Errorf("rotated needs a known numeric, have %v", arg.Self())
+	}
+	return pmmp.Transform{}, fmt.Errorf("%s: illegal argument of type %v", transformer, arg.Type())
+}
@@ -0,0 +1,159 @@
+package pmmp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/npillmayer/arithm"
+)
+
+// --- Dash patterns ---------------------------------------------------------
+
+// Dash is a dash pattern for stroking paths, in the form output formats
+// expect it: the lengths of alternating dashes and gaps, starting with a
+// dash, and the distance into the pattern at which a path starts.
+//
+// The zero value is a solid line.
+type Dash struct {
+	Array  []float64 // dash, gap, dash, gap, …
+	Offset float64
+}
+
+// IsSolid is a predicate: is this the pattern of a solid line?
+func (d Dash) IsSolid() bool {
+	return len(d.Array) == 0
+}
+
+// Period returns the length after which a dash pattern repeats.
+func (d Dash) Period() float64 {
+	p := 0.0
+	for _, l := range d.Array {
+		p += l
+	}
+	return p
+}
+
+// Equal is a predicate: are two dash patterns equal?
+func (d Dash) Equal(e Dash) bool {
+	if len(d.Array) != len(e.Array) || !arithm.Is0(d.Offset-e.Offset) {
+		return false
+	}
+	for i, l := range d.Array {
+		if !arithm.Is0(l - e.Array[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Scaled returns a dash pattern with all lengths multiplied by s.
+func (d Dash) Scaled(s float64) Dash {
+	if d.IsSolid() {
+		return d
+	}
+	r := Dash{Array: make([]float64, len(d.Array)), Offset: d.Offset * s}
+	for i, l := range d.Array {
+		r.Array[i] = l * s
+	}
+	return r
+}
+
+func (d Dash) String() string {
+	if d.IsSolid() {
+		return "solid"
+	}
+	a := make([]interface{}, len(d.Array))
+	for i, l := range d.Array {
+		a[i] = roundScaled(l)
+	}
+	return fmt.Sprintf("dash%v offset %g", a, roundScaled(d.Offset))
+}
+
+// DashSegment is a part of a dash pattern as given to plain MetaPost's
+// dashpattern: a dash of some length if On is set, a gap otherwise.
+type DashSegment struct {
+	On     bool
+	Length float64
+}
+
+// DashPattern returns the picture of a dash pattern, as plain MetaPost's
+// dashpattern creates it: each dash is a horizontal line at its position
+// along the pattern. All lines are at a height equal to the period of the
+// pattern, which is how MetaPost finds the period of a dash picture.
+func DashPattern(segments ...DashSegment) Picture {
+	period := 0.0
+	for _, s := range segments {
+		period += s.Length
+	}
+	pic, w := NullPicture(), 0.0
+	for _, s := range segments {
+		if s.On {
+			line, _ := NewPath([]arithm.Pair{arithm.P(w, period), arithm.P(w+s.Length, period)},
+				[]Join{NewJoin("--")}, false)
+			pic, _ = pic.AddDoublePath(line, Greyscale(FromFloat(0)), Stroke{Pen: NullPen()})
+		}
+		w += s.Length
+	}
+	return pic
+}
+
+// Dash converts the picture of a dash pattern to a dash pattern. The picture
+// has to consist of horizontal lines at a common height, which is the period
+// of the pattern; their x-coordinates give the positions of the dashes.
+func (p Picture) Dash() (Dash, error) {
+	if !p.known || len(p.components) == 0 {
+		return Dash{}, fmt.Errorf("dash pattern without dashes")
+	}
+	type interval struct{ from, to float64 }
+	var dashes []interval
+	period := math.NaN()
+	for _, c := range p.components {
+		if c.Kind != StrokeComponent || c.Path.cycle {
+			return Dash{}, fmt.Errorf("picture is too complicated to use as a dash pattern")
+		}
+		ll, ur := c.Path.BBox()
+		if math.IsNaN(period) {
+			period = ll.Y()
+		}
+		if !arithm.Is0(ll.Y()-ur.Y()) || !arithm.Is0(ll.Y()-period) {
+			return Dash{}, fmt.Errorf("dash pattern needs horizontal lines at the same height")
+		}
+		dashes = append(dashes, interval{ll.X(), ur.X()})
+	}
+	if period <= 0 {
+		return Dash{}, fmt.Errorf("dash pattern needs a positive period, have %g", period)
+	}
+	sort.Slice(dashes, func(i, j int) bool { return dashes[i].from < dashes[j].from })
+	merged := []interval{dashes[0]}
+	for _, d := range dashes[1:] {
+		if last := &merged[len(merged)-1]; d.from <= last.to {
+			last.to = math.Max(last.to, d.to)
+		} else {
+			merged = append(merged, d)
+		}
+	}
+	start := merged[0].from
+	if merged[len(merged)-1].to > start+period {
+		return Dash{}, fmt.Errorf("dashes of a dash pattern must not exceed its period")
+	}
+	var dash Dash
+	for i, d := range merged {
+		next := start + period
+		if i+1 < len(merged) {
+			next = merged[i+1].from
+		}
+		dash.Array = append(dash.Array, d.to-d.from, next-d.to)
+	}
+	if dash.Offset = math.Mod(-start, period); dash.Offset < 0 {
+		dash.Offset += period
+	}
+	return dash, nil
+}
+
+// dashScale returns the factor by which a known transform scales dash
+// patterns, i.e. the square root of the absolute value of its determinant.
+func dashScale(t Transform) float64 {
+	u, _ := t.affine()
+	return math.Sqrt(math.Abs(u[2]*u[5] - u[3]*u[4]))
+}
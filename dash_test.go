@@ -0,0 +1,82 @@
+package pmmp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/npillmayer/arithm"
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+)
+
+func TestDashPattern(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp")
+	defer teardown()
+	//
+	on := func(l float64) DashSegment { return DashSegment{On: true, Length: l} }
+	off := func(l float64) DashSegment { return DashSegment{Length: l} }
+	for i, c := range []struct {
+		segments []DashSegment
+		dash     Dash
+	}{
+		{[]DashSegment{on(3), off(3)}, Dash{Array: []float64{3, 3}}},           // evenly
+		{[]DashSegment{off(2.5), on(0), off(2.5)}, Dash{[]float64{0, 5}, 2.5}}, // withdots
+		{[]DashSegment{on(1), off(2), on(3), off(4)}, Dash{[]float64{1, 2, 3, 4}, 0}},
+		{[]DashSegment{on(1), on(1), off(2)}, Dash{Array: []float64{2, 2}}}, // adjacent dashes merge
+	} {
+		dash, err := DashPattern(c.segments...).Dash()
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if !dash.Equal(c.dash) {
+			t.Errorf("test %d: expected %v, have %v", i, c.dash, dash)
+		}
+	}
+}
+
+func TestDashErrors(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp")
+	defer teardown()
+	//
+	slanted := makePath(t, "--", false, arithm.P(0, 3), arithm.P(1, 4))
+	lowered := makePath(t, "--", false, arithm.P(0, 3), arithm.P(1, 3))
+	lowered2 := makePath(t, "--", false, arithm.P(1, 2), arithm.P(2, 2))
+	tooLong := makePath(t, "--", false, arithm.P(0, 1), arithm.P(3, 1))
+	pen := Stroke{Pen: NullPen()}
+	grey := Greyscale(FromFloat(0))
+	for i, pic := range []Picture{
+		NullPicture(),
+		addLine(t, NullPicture(), slanted, grey, pen),
+		addLine(t, addLine(t, NullPicture(), lowered, grey, pen), lowered2, grey, pen),
+		addLine(t, NullPicture(), tooLong, grey, pen),
+		{}, // unknown picture
+	} {
+		if _, err := pic.Dash(); err == nil {
+			t.Errorf("test %d: expected picture %v to be rejected as a dash pattern", i, pic)
+		}
+	}
+}
+
+func TestDashScaled(t *testing.T) {
+	d := Dash{Array: []float64{1, 3}, Offset: 2}
+	if p := d.Period(); p != 4 {
+		t.Errorf("expected period 4, have %g", p)
+	}
+	if s := d.Scaled(2); !s.Equal(Dash{[]float64{2, 6}, 4}) {
+		t.Errorf("expected dash pattern scaled by 2, have %v", s)
+	}
+	if s := (Dash{}).Scaled(2); !s.IsSolid() {
+		t.Errorf("expected a scaled solid line to stay solid, have %v", s)
+	}
+	if s := dashScale(Scaling(FromFloat(2), FromFloat(8))); math.Abs(s-4) > 1e-9 {
+		t.Errorf("expected a dash scale of 4 for xscaled 2 yscaled 8, have %g", s)
+	}
+}
+
+func addLine(t *testing.T, pic Picture, p Path, color Color, stroke Stroke) Picture {
+	pic, err := pic.AddDoublePath(p, color, stroke)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pic
+}
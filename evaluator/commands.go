@@ -4,40 +4,39 @@ import (
 	"bytes"
 	"fmt"
 
+	"github.com/npillmayer/arithm"
 	"github.com/npillmayer/arithm/polyn"
 	"github.com/npillmayer/gorgo/runtime"
 	"github.com/npillmayer/pmmp"
 	"github.com/npillmayer/pmmp/variables"
 )
 
-// WhateverDeclaration is the global declaration of 'whatever', used to
-// instantiate anonymous whatever-variables.
-var WhateverDeclaration *variables.VarDecl
-
-// Counter for 'whatever' anonymous variables.
-var whateverCounter int64
-
-// Whatever creates an anonymous variable. In MetaFont this is a macro, but
-// it is a frequent use case, so we put it in the core.
-func (ev *Evaluator) Whatever() *variables.VarRef {
-	var vref *variables.VarRef
-	sym, _ := ev.ScopeTree.Globals().ResolveTag("_whtvr")
-	if sym == nil {
-		tracer().Errorf("'whatever'-variable not correctly initialized")
-	} else {
-		inx := []float64{1.0}
-		whateverCounter++
-		inx[0] = float64(whateverCounter)
-		vref = variables.CreateVarRef(WhateverDeclaration.AsSuffix(), nil, inx)
-	}
-	return vref
+// Whatever creates an anonymous unknown numeric. As in plain MetaPost, where
+// whatever is defined as
+//
+//     begingroup save ?; ? endgroup
+//
+// it is a variable of a group of its own, which is a capsule as soon as the
+// group ends. Every call returns a new capsule.
+func (ev *Evaluator) Whatever() pmmp.Value {
+	Begingroup(ev.Runtime, "whatever")
+	defer ev.Endgroup()
+	ev.Save("?")
+	return ev.valueOf(ev.findVariable("?", nil))
 }
 
 // Equation adds a new equation to the runtime evaluator. Given two values
 // which represent left and right side polynomials of an equation, it creates an
 // equations and puts it into the LEQ solver. Values/polynomials may be of
-// numeric or pair type, but must have matching types.
+// numeric, pair, transform or color type, but must have matching types.
+//
+// Inconsistent equations are reported as an error.
 func (ev *Evaluator) Equation(left, right pmmp.Value) (err error) {
+	defer func() { // the LEQ solver panics for inconsistent equations
+		if r := recover(); r != nil {
+			err = fmt.Errorf("inconsistent equation: %v", r)
+		}
+	}()
 	var zero pmmp.Value
 	if zero, err = right.Self().Minus(left); err == nil {
 		if zero.IsKnown() {
@@ -51,6 +50,19 @@ func (ev *Evaluator) Equation(left, right pmmp.Value) (err error) {
 				p.YNumeric().Polynomial(),
 			}
 			ev.leq.AddEqs(eqs)
+		} else if zero.Self().IsTransform() {
+			t := zero.Self().AsTransform()
+			var eqs []polyn.Polynomial
+			for p := pmmp.XPart; p <= pmmp.YYPart; p++ {
+				eqs = append(eqs, t.Part(p).Polynomial())
+			}
+			ev.leq.AddEqs(eqs)
+		} else if zero.Self().IsColor() {
+			var eqs []polyn.Polynomial
+			for _, part := range zero.Self().AsColor().Parts() {
+				eqs = append(eqs, part.Polynomial())
+			}
+			ev.leq.AddEqs(eqs)
 		} else {
 			ev.leq.AddEq(zero.Self().AsNumeric().Polynomial())
 		}
@@ -81,31 +93,46 @@ func (ev *Evaluator) Assign(lvalue *variables.VarRef, e pmmp.Value) error {
 	oldserial := lvalue.ID()
 	tracer().P("var", varname).Debugf("assignment of lvalue #%d", oldserial)
 	ev.EncapsuleVariable(oldserial)
+	for _, part := range lvalue.Parts() {
+		ev.EncapsuleVariable(part.ID())
+	}
 	vref, mf := ev.FindVariableReferenceInMemory(lvalue, false)
 	vref.Set(nil) // now lvalue is unset / unsolved
 	tracer().P("var", varname).Debugf("unset in %v", mf)
 	vref.Reincarnate()
-	tracer().P("var", varname).Debugf("new lvalue incarnation #%d", vref.ID)
-	if vref.Type() != pmmp.NumericType && vref.Type() != pmmp.PathType {
-		//vref.Set(e.Other) // TODO Value of type path
-		panic(fmt.Sprintf("assignment of type %v not yet implemented", vref.Type()))
+	ev.registerVariable(vref)
+	tracer().P("var", varname).Debugf("new lvalue incarnation #%d", vref.ID())
+	if vref.Type() == pmmp.NumericType || vref.Type() == pmmp.PairType ||
+		vref.Type() == pmmp.TransformType || vref.IsColor() {
+		// create linear equation
+		return ev.Equation(ev.valueOf(vref), e)
+	}
+	if vref.Type() == pmmp.PathType && e.IsKnown() && e.Self().IsPair() {
+		e, _ = pmmp.NewPath([]arithm.Pair{e.Self().AsPair().AsPair()}, nil, false)
 	}
-	// create linear equation
-	return ev.Equation(lvalue.Value, e)
+	if e.Type() != vref.Type() || !e.IsKnown() {
+		return fmt.Errorf("cannot assign %v to %v variable %s", e.Self(), vref.Type(), varname)
+	}
+	vref.Set(e)
+	return nil
 }
 
-// Save a tag within a group. The tag will be restored at the end of the
-// group. Save-commands within global scope will be ignored.
+// Save is the MetaPost save command for a tag. Within a group, the tag will
+// be a new, undeclared tag until the end of the group, when the outer tag
+// will be restored. Variables of the saved tag go out of scope at the end of
+// the group, but live on as capsules as long as they are part of equations.
 //
-// This method simply creates a var decl for the tag in the current scope.
-func Save(rt *runtime.Runtime, tag string) {
-	sym, scope := rt.ScopeTree.Current().ResolveTag(tag)
-	if sym != nil { // already found in scope stack
-		tracer().P("tag", tag).Debugf("save: found tag in scope %s",
-			scope.Name)
+// Save-commands within global scope clear the tag, without anything being
+// restored later (MetaFont semantics). Variables of a tag which is saved
+// twice within a group are cleared, too.
+func (ev *Evaluator) Save(tag string) {
+	scope := ev.ScopeTree.Current()
+	if sym := scope.Tags().ResolveTag(tag); sym != nil {
+		tracer().P("tag", tag).Debugf("save: clearing tag in scope %s", scope.Name)
+		ev.eraseVariables(tag, scope)
 	}
 	tracer().Debugf("declaring %s in current scope", tag)
-	rt.ScopeTree.Current().DefineTag(tag)
+	scope.Tags().InsertTag(runtime.NewTag(tag))
 }
 
 // Begingroup is the
@@ -126,6 +153,7 @@ func Begingroup(rt *runtime.Runtime, name string) (*runtime.Scope, *runtime.Dyna
 func (ev *Evaluator) Endgroup() {
 	mf := ev.PopScopeAndMemory()
 	ev.EncapsuleVarsInMemory(mf)
+	ev.dropCapsules(mf)
 }
 
 // PopScopeAndMemory decreases the grouping level.
@@ -0,0 +1,160 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/npillmayer/gorgo/runtime"
+	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
+)
+
+// builtins holds the instructions which are built into the interpreter,
+// i.e. statements and control structures. Operators of the language
+// environment cannot override them.
+//
+// builtins is initialized in init() to avoid an initialization cycle.
+var builtins map[string]instruction
+
+func init() {
+	builtins = map[string]instruction{
+		"statements":   evalSequence,
+		"statement":    evalSequence,
+		"equations":    evalSequence,
+		"if":           evalConditional,
+		"variable":     evalVariable,
+		"str":          evalStr,
+		"equation":     evalEquation,
+		"assignment":   evalAssignment,
+		"begingroup":   evalGroup,
+		"save":         evalSave,
+		"whatever":     evalWhatever,
+		"for":          evalLoop,
+		"forsuffixes":  evalLoop,
+		"forever":      evalLoop,
+		"exitif":       evalExit,
+		"exitunless":   evalExit,
+		"vardecl":      evalDeclaration,
+		"make-path":    evalPath,
+		"segment":      evalSegment,
+		"primarydef":   evalOperatorDef,
+		"secondarydef": evalOperatorDef,
+		"tertiarydef":  evalOperatorDef,
+		"capsule":      evalCapsule,
+		"addto":        evalAddto,
+		"clip":         evalBounds,
+		"setbounds":    evalBounds,
+		"dashpattern":  evalDashPattern,
+		"label":        evalLabel,
+		"dotlabel":     evalLabel,
+		"thelabel":     evalTheLabel,
+		"draw":         evalDraw,
+		"fill":         evalDraw,
+		"filldraw":     evalDraw,
+		"undraw":       evalDraw,
+		"unfill":       evalDraw,
+		"unfilldraw":   evalDraw,
+		"drawarrow":    evalDraw,
+		"drawdblarrow": evalDraw,
+		"cutdraw":      evalDraw,
+		"known":        evalPredicate,
+		"unknown":      evalPredicate,
+		"cycle":        evalPredicate,
+	}
+	for _, t := range []string{
+		"boolean", "cmykcolor", "color", "numeric", "pair", "path", "pen",
+		"picture", "rgbcolor", "string", "transform",
+	} {
+		builtins[t] = evalPredicate
+	}
+}
+
+// evalSequence executes the arguments of an AST node one after the other,
+// e.g. for
+//
+//     ( #statements ⟨statement⟩ … )
+//
+// Execution stops at the first error. Returns the result of the last
+// argument.
+func evalSequence(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	return th.executeSequence(e.AsList().Cdr)
+}
+
+// evalCapsule executes
+//
+//     ( #capsule ⟨expression⟩ )
+//
+// Capsules are bound to the value arguments of macros, and every occurrence
+// of a value parameter in the replacement text is a capsule of the same name.
+// The argument expression is evaluated only once, the other occurrences share
+// its value. The value is dropped at the end of the group it has been
+// evaluated in, e.g., for the next iteration of a loop.
+func evalCapsule(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	ev := th.intp.evaluator
+	l := e.AsList()
+	name := l.Car.Data.(pmmp.TokenOperator).Opname()
+	if v, ok := ev.capsules[name]; ok {
+		return v
+	}
+	v := th.FetchDecodeExecute(terex.Elem(l.Cdar()))
+	if v.Type() == terex.ErrorType {
+		return v
+	}
+	ev.capsules[name] = v
+	mf := ev.MemFrameStack.Current()
+	ev.evaluated[mf] = append(ev.evaluated[mf], name)
+	return v
+}
+
+// dropCapsules forgets the values of the capsules which have been evaluated
+// within memory frame mf.
+func (ev *Evaluator) dropCapsules(mf *runtime.DynamicMemoryFrame) {
+	for _, name := range ev.evaluated[mf] {
+		delete(ev.capsules, name)
+	}
+	delete(ev.evaluated, mf)
+}
+
+// evalConditional executes
+//
+//     ( #if ⟨boolean expression⟩ ⟨body⟩ [⟨else part⟩] )
+//
+// with an elseif-branch being a nested #if-node in the else part. The result
+// is the result of the branch taken, which is the value of conditional
+// primaries and conditional path segments.
+func evalConditional(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	l := e.AsList()
+	cond := th.FetchDecodeExecute(terex.Elem(l.Cdar()))
+	if cond.Type() == terex.ErrorType {
+		return cond
+	}
+	b, err := truthValue(cond)
+	if err != nil {
+		return th.error(err)
+	}
+	if b {
+		return th.FetchDecodeExecute(terex.Elem(l.Cddar()))
+	}
+	if l.Length() > 3 { // else part present
+		return th.FetchDecodeExecute(terex.Elem(l.Nth(4)))
+	}
+	return terex.Elem(nil)
+}
+
+// truthValue returns the boolean value of an evaluated condition. It is an
+// error for a condition not to be a known boolean.
+func truthValue(e terex.Element) (bool, error) {
+	if e.IsAtom() {
+		switch b := e.AsAtom().Data.(type) {
+		case bool:
+			return b, nil
+		case pmmp.Boolean:
+			if b.IsKnown() {
+				return b.AsBool(), nil
+			}
+		}
+	}
+	return false, fmt.Errorf("condition is not a known boolean: %v", e)
+}
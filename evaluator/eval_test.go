@@ -1,8 +1,12 @@
 package evaluator_test
 
 import (
+	"math"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/npillmayer/arithm"
 	"github.com/npillmayer/gorgo/terex"
 	"github.com/npillmayer/pmmp"
 	"github.com/npillmayer/pmmp/corelang"
@@ -16,11 +20,11 @@ func TestSetup(t *testing.T) {
 	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
 	defer teardown()
 	//
-	intp := evaluator.NewInterpreter()
-	if intp == nil {
-		t.Errorf("error creating interpreter")
+	intp, err := evaluator.NewInterpreter()
+	if err != nil {
+		t.Fatalf("error creating interpreter: %v", err)
 	}
-	_, err := intp.Start(nil, nil)
+	_, err = intp.Start(nil, nil)
 	if err != nil {
 		if err != evaluator.ErrNoProgramToExecute {
 			t.Errorf("expected empty-input-error, but got %v", err)
@@ -34,7 +38,7 @@ func TestStart1(t *testing.T) {
 	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
 	defer teardown()
 	//
-	intp := evaluator.NewInterpreter()
+	intp := newInterpreter(t)
 	ast := terex.Atomize(terex.Cons(wrap("+", "SecondaryOp"), nil))
 	input := terex.Cons(ast, terex.Cons(wrap("#eof", "EOF"), nil))
 	_, err := intp.Start(input, nil)
@@ -47,7 +51,7 @@ func TestSubtraction(t *testing.T) {
 	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
 	defer teardown()
 	//
-	intp := evaluator.NewInterpreter()
+	intp := newInterpreter(t)
 	operands := terex.Cons(num(3), terex.Cons(num(2), nil))
 	ast := terex.Atomize(terex.Cons(wrap("-", "SecondaryOp"), operands))
 	input := terex.Cons(ast, terex.Cons(wrap("#eof", "EOF"), nil))
@@ -64,6 +68,1012 @@ func TestSubtraction(t *testing.T) {
 	}
 }
 
+func TestStatements(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	intp := run("a = 2; b = a; pair z; z = (a,b); b := 3;", t)
+	if v := intp.Evaluator().ValueOf("b"); !v.IsKnown() || v.Self().AsNumeric().AsFloat() != 3 {
+		t.Errorf("expected b=3, is %v", v.Self())
+	}
+	if v := intp.Evaluator().ValueOf("z"); !v.IsKnown() || v.Self().AsPair().XNumeric().AsFloat() != 2 {
+		t.Errorf("expected z=(2,2), is %v", v.Self())
+	}
+}
+
+func TestIfStatement(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, c := range []struct {
+		program string
+		a       float64
+	}{
+		{"b=1; if b<2: a=1; else: a=2; fi;", 1},
+		{"b=3; if b<2: a=1; elseif b<4: a=3; else: a=2; fi;", 3},
+		{"b=5; if b<2: a=1; elseif b<4: a=3; else: a=2; fi;", 2},
+		{"b=1; a = if b>2: 7 else: 8 fi;", 8},
+	} {
+		intp := run(c.program, t)
+		v := intp.Evaluator().ValueOf("a")
+		if !v.IsKnown() || v.Self().AsNumeric().AsFloat() != c.a {
+			t.Errorf("%q: expected a=%g, is %v", c.program, c.a, v.Self())
+		}
+	}
+}
+
+func TestIfUnknownCondition(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	program, _, err := grammar.Parse(strings.NewReader("if b<2: a=1; fi;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	intp := newInterpreter(t)
+	r, _ := intp.Start(program, corelang.LoadStandardLanguage())
+	if r == nil || r.Car.Type() != terex.ErrorType {
+		t.Errorf("expected condition on unknown b to be an error")
+	}
+}
+
+func TestBooleans(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, c := range []struct {
+		program string
+		b       bool
+	}{
+		{"boolean b; b = true;", true},
+		{"boolean b; b := not true;", false},
+		{"boolean b; b = (1 < 2) and (2 <= 2);", true},
+		{"boolean b; b = ((1,2) > (1,1)) or false;", true},
+		{"boolean a, b; b = a; a = true;", true},
+		{"boolean b; b = (true = false);", false},
+		{"boolean b; b = 3 ≠ 3;", false},
+		{"boolean b, c; c = true; b = c;", true},
+		{"boolean b; a = 1; b = if a ≥ 1: true else: false fi;", true},
+	} {
+		intp := run(c.program, t)
+		v := intp.Evaluator().ValueOf("b")
+		if !v.IsKnown() || !v.Self().IsBoolean() || v.Self().AsBoolean().AsBool() != c.b {
+			t.Errorf("%q: expected b=%v, is %v", c.program, c.b, v.Self())
+		}
+	}
+	for _, program := range []string{
+		"boolean b; b = true; b = false;", // inconsistent equation
+		"boolean b; b = 1;",
+		"a = true and 1;",
+	} {
+		ast, _, err := grammar.Parse(strings.NewReader(program))
+		if err != nil {
+			t.Fatalf("cannot parse %q: %v", program, err)
+		}
+		intp := newInterpreter(t)
+		r, _ := intp.Start(ast, corelang.LoadStandardLanguage())
+		if r == nil || r.Car.Type() != terex.ErrorType {
+			t.Errorf("%q: expected an error", program)
+		}
+	}
+	// and/or bind tighter than relations, as in MetaPost
+	for _, program := range []string{
+		"boolean b; b = 1 < 2 and 2 <= 2;",
+		"boolean b; b = (1,2) > (1,1) or false;",
+	} {
+		ast, _, err := grammar.Parse(strings.NewReader(program))
+		if err != nil {
+			continue // rejected by the parser
+		}
+		intp := newInterpreter(t)
+		r, _ := intp.Start(ast, corelang.LoadStandardLanguage())
+		if r == nil || r.Car.Type() != terex.ErrorType {
+			t.Errorf("%q: expected an error", program)
+		}
+	}
+}
+
+func TestLinkedEquations(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	intp := run(`boolean a, b, c; a = b; b = c; c = true;
+		string s, u; s = u; u = "x";
+		path p, q; p = q; q = (0,0)--(1,1);
+		boolean d, e; d = e; d := false; e = true;`, t)
+	ev := intp.Evaluator()
+	for _, name := range []string{"a", "b", "c", "e"} {
+		if v := ev.ValueOf(name); !v.IsKnown() || !v.Self().AsBoolean().AsBool() {
+			t.Errorf("expected %s = true, is %v", name, v.Self())
+		}
+	}
+	if v := ev.ValueOf("s"); !v.IsKnown() || v.Self().AsString().AsString() != "x" {
+		t.Errorf("expected s = \"x\", is %v", v.Self())
+	}
+	if v := ev.ValueOf("p"); !v.IsKnown() || v.Self().AsPath().N() != 2 {
+		t.Errorf("expected p = (0,0)--(1,1), is %v", v.Self())
+	}
+	if v := ev.ValueOf("d"); !v.IsKnown() || v.Self().AsBoolean().AsBool() {
+		t.Errorf("expected d = false after assignment, is %v", v.Self())
+	}
+	intp = run("boolean a, b; a = b;", t)
+	if v := intp.Evaluator().ValueOf("a"); v.IsKnown() {
+		t.Errorf("expected a to be unknown, is %v", v.Self())
+	}
+	for _, program := range []string{
+		"boolean a, b; a = b; b = true; a = false;", // inconsistent equation
+		"boolean a; string s; a = s;",
+	} {
+		ast, _, err := grammar.Parse(strings.NewReader(program))
+		if err != nil {
+			t.Fatalf("cannot parse %q: %v", program, err)
+		}
+		intp := newInterpreter(t)
+		r, _ := intp.Start(ast, corelang.LoadStandardLanguage())
+		if r == nil || r.Car.Type() != terex.ErrorType {
+			t.Errorf("%q: expected an error", program)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, c := range []struct {
+		program string
+		s       string
+	}{
+		{`string s; s = "abc";`, "abc"},
+		{`string s; s := "ab" & "" & "c";`, "abc"},
+		{`string s; s = substring (1,3) of "hello";`, "el"},
+		{`string s; s = substring (3,1) of "hello";`, "le"},
+		{`string s; s = decimal 1/4 & char 65;`, "0.25A"},
+		{`string s; s = str x.r1;`, "x.r1"},
+		{`string s; s = str x[-1]b;`, "x[-1]b"},
+		{`string s; a = 1; s = if "ab" < "b": decimal (length "ab" - a) fi;`, "1"},
+		{`string s; a = 2; s = if "ab" < "b": decimal (length "ab" + a) fi;`, "4"},
+		{`string s; a = ASCII "A"; s = decimal a;`, "65"},
+	} {
+		intp := run(c.program, t)
+		v := intp.Evaluator().ValueOf("s")
+		if !v.IsKnown() || !v.Self().IsString() || v.Self().AsString().AsString() != c.s {
+			t.Errorf("%q: expected s=%q, is %v", c.program, c.s, v.Self())
+		}
+	}
+}
+
+func TestTransforms(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, c := range []struct {
+		program string
+		x, y    float64
+	}{
+		{"pair z; z = (1,1) shifted (1,0) scaled 2;", 4, 2},
+		{"pair z; transform T; T = identity shifted (1,0) scaled 2; z = (1,1) transformed T;", 4, 2},
+		{"pair z; transform T; T = identity scaled 2 shifted (1,1); z = (5,3) transformed inverse T;", 2, 1},
+		{"pair z; z = (1,0) rotated 90;", 0, 1},
+		{"pair z; transform T; T = identity slanted 1; z = (xxpart T, xypart T);", 1, 1},
+	} {
+		intp := run(c.program, t)
+		v := intp.Evaluator().ValueOf("z")
+		if !v.IsKnown() || v.Self().AsPair().AsPair() != arithm.P(c.x, c.y) {
+			t.Errorf("%q: expected z=(%g,%g), is %v", c.program, c.x, c.y, v.Self())
+		}
+	}
+	// solve an unknown transform from three point correspondences
+	intp := run(`transform T; (0,0) transformed T = (1,2);
+		(1,0) transformed T = (3,2); (0,1) transformed T = (1,5);`, t)
+	v := intp.Evaluator().ValueOf("T")
+	if !v.IsKnown() || !v.Self().IsTransform() {
+		t.Fatalf("expected T to be solved, is %v", v.Self())
+	}
+	T := v.Self().AsTransform()
+	for p, x := range []float64{1, 2, 2, 0, 0, 3} {
+		if f := T.Part(pmmp.TransformPart(p)).AsFloat(); f != x {
+			t.Errorf("expected %v T = %g, is %g", pmmp.TransformPart(p), x, f)
+		}
+	}
+}
+
+func TestColors(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, c := range []struct {
+		program string
+		parts   []float64
+	}{
+		{"color c; c = (1,0.5,0);", []float64{1, 0.5, 0}},
+		{"color c; (0.5,a,1) = c; a = 0.1;", []float64{0.5, 0.1, 1}},
+		{"color c; c = (x,1,x); redpart c = 0.3;", []float64{0.3, 1, 0.3}},
+		{"cmykcolor c; c = (0,0,0,1); yellowpart c = 0;", []float64{0, 0, 0, 1}},
+		{"cmykcolor c; c := (0,1,0,x); x = blackpart (1,1,1,0.2);", []float64{0, 1, 0, 0.2}},
+		{"color c; c = (1,0,0) + 0.5(0,1,0);", []float64{1, 0.5, 0}},
+		{"color c; c = (0,0,1)*2 - (0,0,1)/2;", []float64{0, 0, 1.5}},
+		{"color c; c = 0.25[(0,0,0),(1,1,1)];", []float64{.25, .25, .25}},
+	} {
+		intp := run(c.program, t)
+		v := intp.Evaluator().ValueOf("c")
+		if !v.IsKnown() || !v.Self().IsColor() {
+			t.Errorf("%q: expected c to be a known color, is %v", c.program, v.Self())
+			continue
+		}
+		parts := v.Self().AsColor().Parts()
+		if len(parts) != len(c.parts) {
+			t.Errorf("%q: expected c to have %d parts, has %d", c.program, len(c.parts), len(parts))
+			continue
+		}
+		for i, p := range parts {
+			if !arithm.Is0(p.AsFloat() - c.parts[i]) {
+				t.Errorf("%q: expected c=%v, is %v", c.program, c.parts, v.Self())
+				break
+			}
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, c := range []struct {
+		program string
+		a       float64
+	}{
+		{"for i=1 upto 3: x[i]=i; endfor; a=x[3];", 3},
+		{"for i=10 step -2 until 6: a:=i; endfor;", 6},
+		{"for i=3 downto 1: a:=i; endfor;", 1},
+		{"for v=5,7: a:=v; endfor;", 7},
+		{"forsuffixes s=l,r: x.s=2; endfor; a=x.r;", 2},
+		{"b:=0; forever: b:=b-1; exitif b<-3; endfor; a=b;", -4},
+		{"b:=0; forever: b:=b-1; exitunless b>-2; endfor; a=b;", -2},
+		{"a = begingroup for i=1 upto 2: c:=i; endfor; c endgroup;", 2},
+	} {
+		intp := run(c.program, t)
+		v := intp.Evaluator().ValueOf("a")
+		if !v.IsKnown() || v.Self().AsNumeric().AsFloat() != c.a {
+			t.Errorf("%q: expected a=%g, is %v", c.program, c.a, v.Self())
+		}
+	}
+}
+
+func TestLoopValues(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, c := range []struct {
+		program string
+		s       string
+	}{
+		{`string s; s := ""; for x = "a", "b": s := s & x; endfor;`, "ab"},
+		{`string s; s := ""; for b = true, false: s := s & if b: "t" else: "f" fi; endfor;`, "tf"},
+		{`string s; pen p; s := ""; for q = pencircle, p: s := s & if known q: "k" else: "u" fi; endfor;`, "ku"},
+		{`string s; s := ""; for c = (1,0,0,0), (0,1,0): s := s & if cmykcolor c: "c" else: "r" fi; endfor;`, "cr"},
+		{`string s; path p; p = (0,0)--(1,1); for q = p: s = if path q: decimal length q fi; endfor;`, "1"},
+	} {
+		intp := run(c.program, t)
+		v := intp.Evaluator().ValueOf("s")
+		if !v.IsKnown() || !v.Self().IsString() || v.Self().AsString().AsString() != c.s {
+			t.Errorf("%q: expected s=%q, is %v", c.program, c.s, v.Self())
+		}
+	}
+}
+
+func TestPathUnrolling(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	points := "pair z[]; z0=(0,0); z1=(1,0); z2=(1,1); z3=(0,1); path p; "
+	for _, c := range []struct {
+		program string
+		n       int
+		cycle   bool
+	}{
+		{"p := z0..z1--z2;", 3, false},
+		{"p := z0 for i=1 upto 3: .. z[i] endfor .. cycle;", 4, true},
+		{"p := z0 for i=1 upto 3: if i<>2: .. z[i] fi endfor;", 3, false},
+		{"p := z0 if 1<2: --z1 else: --z2 fi --z3;", 3, false},
+		{"p := z0 for i=1 upto 2: for j=1 upto 2: ..(i,j) endfor endfor;", 5, false},
+	} {
+		intp := run(points+c.program, t)
+		v := intp.Evaluator().ValueOf("p")
+		if !v.IsKnown() || !v.Self().IsPath() {
+			t.Errorf("%q: expected p to be a known path, is %v", c.program, v)
+			continue
+		}
+		if p := v.Self().AsPath(); p.N() != c.n || p.IsCycle() != c.cycle {
+			t.Errorf("%q: expected %d knots (cycle=%v), have %v", c.program, c.n, c.cycle, p)
+		}
+	}
+}
+
+func TestMacroArguments(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	dec := "begingroup a := a - 1; a endgroup" // has a side effect on a
+	for _, c := range []struct {
+		program string
+		a, b    float64
+	}{
+		{"def diff(expr x) = x - x enddef; a := 1; b = diff(" + dec + ");", 0, 0},
+		{"def f(expr x) = begingroup c := 0 - x; x endgroup enddef; a := 3; b = f(" + dec + ");", 2, 2},
+		{"def rep(expr x) = for i=1 upto 3: b := b - x; endfor enddef; a := 3; b := 0; rep(" + dec + ");", 2, -6},
+		{"def sub(expr x) = b := b - x enddef; a := 0; b := 10; for i=1 upto 3: sub(i); endfor;", 0, 4},
+		{"def p(suffix s)(text t) = x.s t enddef; p(l)(:= 2); a := 0; b = x.l;", 0, 2},
+		{`def f(expr s, n) = if s = "ab": n else: 0 fi enddef; a := 0; b = f("a" & "b", 3);`, 0, 3},
+		{`def g(expr s) = length ("a" & s) enddef; a := 0; b = g("bc");`, 0, 3},
+		{"def inc(expr x) = b := b + x enddef; a := 0; b := 1; inc(2); inc(b);", 0, 6},
+		{"def sq primary x = x*x enddef; a := 0; b = sq 3 + 1;", 0, 10},
+	} {
+		intp := run(c.program, t)
+		a, b := intp.Evaluator().ValueOf("a"), intp.Evaluator().ValueOf("b")
+		if !a.IsKnown() || a.Self().AsNumeric().AsFloat() != c.a ||
+			!b.IsKnown() || b.Self().AsNumeric().AsFloat() != c.b {
+			t.Errorf("%q: expected a=%g and b=%g, are %v and %v", c.program, c.a, c.b, a.Self(), b.Self())
+		}
+	}
+}
+
+func TestPathControls(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	// expected control points are the ones chosen by MetaPost
+	for _, c := range []struct {
+		program string
+		i       int // join to check
+		c1, c2  arithm.Pair
+	}{
+		{"p := (0,0)..(1,1);", 0, arithm.P(0.33333, 0.33333), arithm.P(0.66667, 0.66667)},
+		{"p := (0,0)--(3,0);", 0, arithm.P(1, 0), arithm.P(2, 0)},
+		{"p := (0,0){up}..{down}(1,0);", 0, arithm.P(0, 0.66667), arithm.P(1, 0.66667)},
+		{"p := (0,0)..(10,10)..(20,0);", 1, arithm.P(15.52285, 10), arithm.P(20, 5.52285)},
+		{"p := (1,1)..(2,2)..(3,1)..(2,0)..cycle;", 3, arithm.P(1.44772, 0), arithm.P(1, 0.44772)},
+		{"p := (0,0){up}..tension 2..{down}(1,0);", 0, arithm.P(0, 0.33333), arithm.P(1, 0.33333)},
+		{"p := (0,0)..controls (1,2) and (3,4)..(5,0);", 0, arithm.P(1, 2), arithm.P(3, 4)},
+		{"p := (0,0)..(1,1); p := p..(2,0);", 0, arithm.P(0.33333, 0.33333), arithm.P(0.66667, 0.66667)},
+	} {
+		intp := run("path p; "+c.program, t)
+		v := intp.Evaluator().ValueOf("p")
+		if !v.IsKnown() || !v.Self().IsPath() {
+			t.Errorf("%q: expected p to be a known path, is %v", c.program, v)
+			continue
+		}
+		c1, c2 := v.Self().AsPath().Controls(c.i)
+		if !closeTo(c1, c.c1) || !closeTo(c2, c.c2) {
+			t.Errorf("%q: expected controls %v and %v, have %v", c.program, c.c1, c.c2, v.Self())
+		}
+	}
+}
+
+func TestPathEquations(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, program := range []string{
+		"path p; p = (0,0)--(1,1);",
+		"path p; (0,0)--(1,1) = p;",
+		"path p, q; q = (0,0)--(1,1); p = q; p = (0,0)--(1,1);",
+		"path p; pair z; z = (0,0); p = z--(1,1); (0,0)--(1,1) = p;",
+	} {
+		intp := run(program, t)
+		v := intp.Evaluator().ValueOf("p")
+		if !v.IsKnown() || !v.Self().IsPath() {
+			t.Errorf("%q: expected p to be a known path, is %v", program, v)
+			continue
+		}
+		if p := v.Self().AsPath(); p.N() != 2 || !closeTo(p.Knot(1), arithm.P(1, 1)) {
+			t.Errorf("%q: expected p = (0,0)--(1,1), is %v", program, v.Self())
+		}
+	}
+	run("path o; o = (1,1); o = (1,1);", t)
+	run("pen q; q = pencircle; q = pencircle;", t)
+	run("picture r; r = nullpicture; r = nullpicture;", t)
+	for _, program := range []string{
+		"path p; p = (0,0)--(1,1); p = (0,0)..(1,1)..cycle;", // inconsistent equation
+		"path p; p = (0,0)--(1,1); p = (0,0)--(2,2);",
+		"pen q; q = pencircle; q = pensquare;",
+		"path p; p = pencircle;", // equation between path and pen
+	} {
+		ast, _, err := grammar.Parse(strings.NewReader(program))
+		if err != nil {
+			t.Fatalf("cannot parse %q: %v", program, err)
+		}
+		intp := newInterpreter(t)
+		r, _ := intp.Start(ast, corelang.LoadStandardLanguage())
+		if r == nil || r.Car.Type() != terex.ErrorType {
+			t.Errorf("%q: expected an error", program)
+		}
+	}
+}
+
+func TestPathQueries(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	square := "path p; p = (0,0)--(2,0)--(2,2)--(0,2)--cycle; pair z; "
+	for _, c := range []struct {
+		program string
+		z       arithm.Pair
+	}{
+		{"z = point 1.5 of p;", arithm.P(2, 1)},
+		{"z = point 5 of p;", arithm.P(2, 0)},
+		{"z = point 6.5 of p;", arithm.P(1, 2)},
+		{"z = precontrol 1 of p;", arithm.P(1.33333, 0)},
+		{"z = postcontrol 0.5 of p;", arithm.P(1.33333, 0)},
+		{"z = direction 0.5 of p;", arithm.P(0.66667, 0)},
+		{"z = point 0.5 of reverse p;", arithm.P(0, 1)},
+		{"z = point 1 of subpath (1.5,3) of p;", arithm.P(2, 2)},
+		{"z = point 0 of subpath (3,1) of p;", arithm.P(0, 2)},
+		{"z = point 1 of subpath (3,5) of p;", arithm.P(0, 0)},
+	} {
+		intp := run(square+c.program, t)
+		v := intp.Evaluator().ValueOf("z")
+		if !v.IsKnown() || !closeTo(v.Self().AsPair().AsPair(), c.z) {
+			t.Errorf("%q: expected z=%v, is %v", c.program, c.z, v.Self())
+		}
+	}
+	for _, c := range []struct {
+		program string
+		n       float64
+	}{
+		{"n = length p;", 4},
+		{"n = length subpath (3,1) of p;", 2},
+		{"n = length ((0,0)..(1,1));", 1},
+		{"n = turningnumber p;", 1},
+		{"n = turningnumber reverse p;", -1},
+		{"n = if cycle p: 1 else: 0 fi;", 1},
+		{"n = if cycle (subpath (0,4) of p): 1 else: 0 fi;", 0},
+	} {
+		intp := run(square+c.program, t)
+		v := intp.Evaluator().ValueOf("n")
+		if !v.IsKnown() || v.Self().AsNumeric().AsFloat() != c.n {
+			t.Errorf("%q: expected n=%g, is %v", c.program, c.n, v.Self())
+		}
+	}
+}
+
+func TestArcLength(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	paths := "path p, c; p = (0,0)--(2,0)--(2,2)--(0,2)--cycle; " +
+		"c = (1,0)..(0,1)..(-1,0)..(0,-1)..cycle; numeric n; pair z; "
+	for _, x := range []struct {
+		program string
+		n       float64
+	}{
+		{"n = arclength p;", 8},
+		{"n = arclength subpath (0,1.5) of p;", 3},
+		{"n = arclength c;", 6.28407},
+		{"n = arctime 3 of p;", 1.5},
+		{"n = arctime 19 of p;", 9.5},
+		{"n = arctime 5 of subpath (0,2) of p;", 2},
+		{"n = arctime arclength subpath (0,1) of c of c;", 1},
+		{"n = arctime arclength c / 4 of c;", 1},
+		{"n = directiontime (1,0) of p;", 0},
+		{"n = directiontime (1,1) of p;", 1},
+		{"n = directiontime (0,1) of c;", 0},
+		{"n = directiontime (0,1) of ((0,0)--(1,0));", -1},
+	} {
+		intp := run(paths+x.program, t)
+		v := intp.Evaluator().ValueOf("n")
+		if !v.IsKnown() || math.Abs(v.Self().AsNumeric().AsFloat()-x.n) > 1e-4 {
+			t.Errorf("%q: expected n=%g, is %v", x.program, x.n, v.Self())
+		}
+	}
+	for _, x := range []struct {
+		program string
+		z       arithm.Pair
+	}{
+		{"z = directionpoint (0,1) of c;", arithm.P(1, 0)},
+		{"z = directionpoint (1,1) of c;", arithm.P(0.70711, -0.70711)},
+		{"z = directionpoint (1,1) of reverse p;", arithm.P(0, 2)},
+	} {
+		intp := run(paths+x.program, t)
+		v := intp.Evaluator().ValueOf("z")
+		if !v.IsKnown() || !closeTo(v.Self().AsPair().AsPair(), x.z) {
+			t.Errorf("%q: expected z=%v, is %v", x.program, x.z, v.Self())
+		}
+	}
+}
+
+func TestIntersections(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	paths := "path c, h; c = (3,2)..(2,3)..(1,2)..(2,1)..cycle; h = (0,2)--(4,2); pair z; "
+	for _, x := range []struct {
+		program string
+		z       arithm.Pair
+	}{
+		{"z = ((0,0)--(2,2)) intersectiontimes ((0,2)--(2,0));", arithm.P(0.5, 0.5)},
+		{"z = ((0,0)--(2,2)) intersectionpoint ((0,2)--(2,0));", arithm.P(1, 1)},
+		{"z = ((0,0)--(1,0)) intersectiontimes ((0,1)--(1,1));", arithm.P(-1, -1)},
+		{"z = h intersectiontimes c;", arithm.P(0.75, 0)},
+		{"z = c intersectiontimes h;", arithm.P(0, 0.75)},
+		{"z = c intersectiontimes (2,3);", arithm.P(1, 0)},
+		{"z = point 0 of (h cutbefore c);", arithm.P(3, 2)},
+		{"z = point 0 of (h cutbefore ((1,0)--(1,4)));", arithm.P(1, 2)},
+		{"z = point 1 of (h cutafter c);", arithm.P(3, 2)},
+		{"z = point 1 of (h cutafter ((5,0)--(5,4)));", arithm.P(4, 2)},
+	} {
+		intp := run(paths+x.program, t)
+		v := intp.Evaluator().ValueOf("z")
+		if !v.IsKnown() || !closeTo(v.Self().AsPair().AsPair(), x.z) {
+			t.Errorf("%q: expected z=%v, is %v", x.program, x.z, v.Self())
+		}
+	}
+}
+
+func TestPens(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, x := range []struct {
+		program string
+		z       arithm.Pair
+	}{
+		{"z = penoffset (1,0) of pencircle;", arithm.P(0, -0.5)},
+		{"z = penoffset (0,1) of (pencircle xscaled 2 shifted (1,1));", arithm.P(2, 1)},
+		{"z = penoffset (1,1) of pensquare;", arithm.P(0.5, -0.5)},
+		{"z = penoffset (1,0) of nullpen;", arithm.P(0, 0)},
+		{"z = point 2 of makepath pencircle;", arithm.P(0, 0.5)},
+		{"z = point 1 of makepath makepen ((0,0)--(2,0)--(1,1)--(1,0.5)--cycle);", arithm.P(2, 0)},
+		{"pickup pencircle scaled 2; z = penoffset (1,0) of currentpen;", arithm.P(0, -1)},
+		{"pen p; p := pensquare rotated 45; z = penoffset (1,0) of p;", arithm.P(0, -0.70711)},
+	} {
+		intp := run("pair z; "+x.program, t)
+		v := intp.Evaluator().ValueOf("z")
+		if !v.IsKnown() || !closeTo(v.Self().AsPair().AsPair(), x.z) {
+			t.Errorf("%q: expected z=%v, is %v", x.program, x.z, v.Self())
+		}
+	}
+	intp := run("n = length makepath pensquare; pickup pencircle scaled 2; linecap := butt;", t)
+	if n := intp.Evaluator().ValueOf("n"); !n.IsKnown() || n.Self().AsNumeric().AsFloat() != 4 {
+		t.Errorf("expected pensquare to have 4 vertices, is %v", n.Self())
+	}
+	stroke := intp.Evaluator().CurrentStroke()
+	if stroke.Cap != pmmp.ButtCap || stroke.Join != pmmp.RoundJoin ||
+		stroke.Pen.String() != "pencircle transformed (0,0,2,0,0,2)" {
+		t.Errorf("expected butt-capped, round-joined stroke with pencircle scaled 2, is %+v", stroke)
+	}
+}
+
+func TestPictures(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	square := "picture p; p := nullpicture; addto p contour (0,0)--(4,0)--(4,4)--(0,4)--cycle; "
+	for _, x := range []struct {
+		program string
+		z       arithm.Pair
+	}{
+		{"z = llcorner currentpicture;", arithm.P(0, 0)},
+		{"addto currentpicture doublepath (0,0)--(2,0) withpen pencircle; z = llcorner currentpicture;",
+			arithm.P(-0.5, -0.5)},
+		{"pickup pencircle scaled 2; addto currentpicture doublepath (0,0)--(2,0); z = urcorner currentpicture;",
+			arithm.P(3, 1)},
+		{square + "z = center p;", arithm.P(2, 2)},
+		{square + "clip p to (1,1)--(2,1)--(2,2)--(1,2)--cycle; z = llcorner p;", arithm.P(1, 1)},
+		{square + "setbounds p to (1,1)--(2,1)--(2,2)--(1,2)--cycle; z = urcorner (p shifted (1,0));",
+			arithm.P(3, 2)},
+		{square + "z = urcorner (p rotated 90);", arithm.P(0, 4)},
+		{square + "z = llcorner bbox p;", arithm.P(-2, -2)},
+		{"z = lrcorner ((0,0)..(1,1)..(2,0));", arithm.P(2, 0)},
+		{"z = ulcorner (((0,0)--(1,1)) shifted (1,0));", arithm.P(1, 1)},
+		{"z = urcorner (pencircle scaled 2);", arithm.P(1, 1)},
+	} {
+		intp := run("pair z; "+x.program, t)
+		v := intp.Evaluator().ValueOf("z")
+		if !v.IsKnown() || !closeTo(v.Self().AsPair().AsPair(), x.z) {
+			t.Errorf("%q: expected z=%v, is %v", x.program, x.z, v.Self())
+		}
+	}
+	intp := run(square+"addto currentpicture doublepath (0,0)--(1,1); "+
+		"addto currentpicture also p withcolor (1,0,0);", t)
+	pic := intp.Evaluator().ValueOf("currentpicture").Self().AsPicture()
+	c := pic.Components()
+	if len(c) != 2 || c[0].Kind != pmmp.StrokeComponent || c[1].Kind != pmmp.FillComponent {
+		t.Fatalf("expected a stroke and a fill, have %v", pic)
+	}
+	if red, _ := c[1].Color.Part(pmmp.RedPart); red.AsFloat() != 1 {
+		t.Errorf("expected the fill to be red, is %v", c[1].Color)
+	}
+}
+
+func TestDrawing(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, x := range []struct {
+		program string
+		n       int         // number of components of currentpicture
+		ur      arithm.Pair // its upper right corner
+	}{
+		{"draw (0,0)--(2,0);", 1, arithm.P(2.25, 0.25)},
+		{"fill (0,0)--(1,0)--(1,1)--cycle withcolor red;", 1, arithm.P(1, 1)},
+		{"filldraw (0,0)--(1,0)--(1,1)--cycle withpen pencircle scaled 2;", 1, arithm.P(2, 2)},
+		{"draw (0,0)--(1,0); picture q; q := currentpicture; draw q shifted (0,1);", 2, arithm.P(1.25, 1.25)},
+		{"drawarrow (0,0)--(10,0);", 2, arithm.P(10.25, 1.78073)},
+		{"drawdblarrow (0,0)--(10,0);", 3, arithm.P(10.25, 1.78073)},
+		{"unfill (0,0)--(1,0)--(1,1)--cycle; cutdraw (0,0)--(1,1);", 2, arithm.P(1.25, 1.25)},
+	} {
+		intp := run(x.program, t)
+		pic := intp.Evaluator().ValueOf("currentpicture").Self().AsPicture()
+		_, ur := pic.BBox()
+		if len(pic.Components()) != x.n || !closeTo(ur, x.ur) {
+			t.Errorf("%q: expected %d components up to %v, have %v", x.program, x.n, x.ur, pic)
+		}
+	}
+	intp := run("undraw (0,0)--(1,0); filldraw (0,0)--(1,0)--(1,1)--cycle withcolor blue; "+
+		"cutdraw (0,0)--(1,1) withcolor green;", t)
+	c := intp.Evaluator().ValueOf("currentpicture").Self().AsPicture().Components()
+	if len(c) != 3 {
+		t.Fatalf("expected 3 components, have %d", len(c))
+	}
+	for i, part := range []pmmp.ColorPart{pmmp.RedPart, pmmp.BluePart, pmmp.GreenPart} {
+		if x, _ := c[i].Color.Part(part); x.AsFloat() != 1 {
+			t.Errorf("expected component %d to have %v 1, has color %v", i, part, c[i].Color)
+		}
+	}
+	if c[1].Kind != pmmp.FillComponent || c[1].Stroke == nil {
+		t.Errorf("expected filldraw to add a stroked contour, have %v", c[1])
+	}
+	if c[2].Stroke.Cap != pmmp.ButtCap {
+		t.Errorf("expected cutdraw to use butt caps, has %v", c[2].Stroke.Cap)
+	}
+}
+
+func TestDashes(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, x := range []struct {
+		program string
+		dash    []float64
+		offset  float64
+	}{
+		{"draw (0,0)--(10,0) dashed evenly;", []float64{3, 3}, 0},
+		{"draw (0,0)--(10,0) dashed evenly scaled 2;", []float64{6, 6}, 0},
+		{"draw (0,0)--(10,0) dashed withdots;", []float64{0, 5}, 2.5},
+		{"draw (0,0)--(10,0) dashed dashpattern(on 2 off 1 on 1 off 1);", []float64{2, 1, 1, 1}, 0},
+		{"draw (0,0)--(10,0) dashed evenly; currentpicture := currentpicture scaled 2;", []float64{6, 6}, 0},
+		{"picture q; q := nullpicture; addto q doublepath (0,0)--(1,0); " +
+			"addto currentpicture also q dashed evenly;", []float64{3, 3}, 0},
+	} {
+		intp := run(x.program, t)
+		c := intp.Evaluator().ValueOf("currentpicture").Self().AsPicture().Components()
+		if len(c) != 1 || c[0].Stroke == nil {
+			t.Errorf("%q: expected a single stroke, have %v", x.program, c)
+			continue
+		}
+		dash := c[0].Stroke.Dash
+		if !reflect.DeepEqual(dash.Array, x.dash) || dash.Offset != x.offset {
+			t.Errorf("%q: expected dash pattern %v offset %g, have %v", x.program, x.dash, x.offset, dash)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	// "x" in goregular is 5bp wide and 5.30273bp high
+	for _, x := range []struct {
+		program string
+		z       arithm.Pair
+	}{
+		{`z = urcorner ("x" infont "goregular");`, arithm.P(5, 5.30273)},
+		{`label("x", (0,0)); z = llcorner currentpicture;`, arithm.P(-2.5, -2.65137)},
+		{`label.rt("x", (0,0)); z = llcorner currentpicture;`, arithm.P(3, -2.65137)},
+		{`label.top("x", (0,0)); z = llcorner currentpicture;`, arithm.P(-2.5, 3)},
+		{`defaultscale := 2; label.urt("x", (0,0)); z = urcorner currentpicture;`, arithm.P(12.1, 12.70547)},
+		{`picture q; q := thelabel.lft("x", (10,0)); z = urcorner q;`, arithm.P(7, 2.65137)},
+		{`dotlabel.bot("x", (0,0)); z = urcorner currentpicture;`, arithm.P(2.5, 1.5)},
+	} {
+		intp := run("pair z; "+x.program, t)
+		v := intp.Evaluator().ValueOf("z")
+		if !v.IsKnown() || !closeTo(v.Self().AsPair().AsPair(), x.z) {
+			t.Errorf("%q: expected z=%v, is %v", x.program, x.z, v.Self())
+		}
+	}
+	intp := run(`dotlabel("x", (0,0)) withcolor red;`, t)
+	c := intp.Evaluator().ValueOf("currentpicture").Self().AsPicture().Components()
+	if len(c) != 2 || c[0].Kind != pmmp.TextComponent || c[1].Kind != pmmp.StrokeComponent {
+		t.Fatalf("expected a text and a dot, have %v", c)
+	}
+	if red, _ := c[0].Color.Part(pmmp.RedPart); red.AsFloat() != 1 || c[0].Text.Font != "goregular" {
+		t.Errorf("expected red text in goregular, have %v", c[0])
+	}
+}
+
+func TestUnits(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, x := range []struct {
+		program string
+		a       float64
+	}{
+		{"a = cm;", 28.34646},
+		{"a = mm;", 2.83465},
+		{"a = in;", 72},
+		{"a = pt;", 0.99626},
+		{"a = pc;", 11.95517},
+		{"a = cc - dd;", 11.72612},
+		{"a = bp;", 1},
+		{"a = 3cm;", 85.03937},
+		{"a = 2.5mm;", 7.08661},
+		{"a = cc/dd;", 12},
+	} {
+		intp := run(x.program, t)
+		v := intp.Evaluator().ValueOf("a")
+		if !v.IsKnown() || math.Abs(v.Self().AsNumeric().AsFloat()-x.a) > 1e-4 {
+			t.Errorf("%q: expected a=%g, is %v", x.program, x.a, v.Self())
+		}
+	}
+	program := "pair z; a = cm; z = urcorner currentpen;"
+	ast, _, err := grammar.Parse(strings.NewReader(program))
+	if err != nil {
+		t.Fatalf("cannot parse %q: %v", program, err)
+	}
+	intp := newInterpreter(t, evaluator.BaseUnit("mm"))
+	if _, err := intp.Start(ast, corelang.LoadStandardLanguage()); err != nil {
+		t.Fatalf("error executing %q: %v", program, err)
+	}
+	if a := intp.Evaluator().ValueOf("a"); math.Abs(a.Self().AsNumeric().AsFloat()-10) > 1e-4 {
+		t.Errorf("expected 1cm to be 10mm, is %v", a.Self())
+	}
+	// currentpen is pencircle scaled .5bp
+	if z := intp.Evaluator().ValueOf("z"); !closeTo(z.Self().AsPair().AsPair(), arithm.P(0.0882, 0.0882)) {
+		t.Errorf("expected currentpen to have a radius of .25bp, has %v", z.Self())
+	}
+	if _, err := evaluator.NewInterpreter(evaluator.BaseUnit("furlong")); err == nil {
+		t.Errorf("expected base unit furlong to be rejected")
+	}
+}
+
+func TestUnitConversion(t *testing.T) {
+	if bp, ok := evaluator.ScaleDimension(2.54, "cm"); !ok || math.Abs(bp-72) > 1e-9 {
+		t.Errorf("expected 2.54cm to be 72bp, is %g", bp)
+	}
+	if _, ok := evaluator.Unit2numeric("furlong"); ok {
+		t.Errorf("expected unit furlong to be unknown")
+	}
+}
+
+func TestMath(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, x := range []struct {
+		program string
+		a       float64
+	}{
+		{"a = sqrt 2;", math.Sqrt2},
+		{"a = sind 30 - cosd 60;", 0},
+		{"a = mlog 2;", 177.44568},
+		{"a = mexp 256;", math.E},
+		{"a = floor 1.5 - ceiling 1.2 - round 2.5;", -4},
+		{"a = angle (1,1) - angle (-1,0);", -135},
+		{"a = xpart dir 60 - ypart unitvector (3,4);", -0.3},
+		{"a = length (3,4) - abs (0-2);", 1},
+		{"a = 3 ++ 4;", 5},
+		{"a = 5 +-+ 3;", 4},
+		{"a = 2**10;", 1024},
+		{"a = 7 div 2 - 7 mod 2 - (0-7) mod 3;", 0},
+		{"a = min(3, 1, 2) - max(3, 1, 2);", -2},
+		{"a = ypart max((1,2), (1,3));", 3},
+	} {
+		intp := run(x.program, t)
+		v := intp.Evaluator().ValueOf("a")
+		if !v.IsKnown() || math.Abs(v.Self().AsNumeric().AsFloat()-x.a) > 1e-4 {
+			t.Errorf("%q: expected a=%g, is %v", x.program, x.a, v.Self())
+		}
+	}
+	for _, program := range []string{"a = sqrt b;", "a = b ++ 1;", "a = max(1, b);", "a = sqrt (0-1);"} {
+		ast, _, err := grammar.Parse(strings.NewReader(program))
+		if err != nil {
+			t.Fatalf("cannot parse %q: %v", program, err)
+		}
+		intp := newInterpreter(t)
+		r, _ := intp.Start(ast, corelang.LoadStandardLanguage())
+		if r == nil || r.Car.Type() != terex.ErrorType {
+			t.Errorf("%q: expected an error for a nonlinear operation", program)
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	draw := func(seed string) (float64, float64) {
+		intp := run("randomseed := "+seed+"; a = uniformdeviate 10; b = normaldeviate;", t)
+		a := intp.Evaluator().ValueOf("a").Self().AsNumeric().AsFloat()
+		b := intp.Evaluator().ValueOf("b").Self().AsNumeric().AsFloat()
+		return a, b
+	}
+	a1, b1 := draw("42")
+	a2, b2 := draw("42")
+	if a1 != a2 || b1 != b2 {
+		t.Errorf("expected equal seeds to give equal numbers, have %g, %g and %g, %g", a1, b1, a2, b2)
+	}
+	if a1 < 0 || a1 >= 10 {
+		t.Errorf("expected uniformdeviate 10 to be in [0,10), is %g", a1)
+	}
+	if a3, b3 := draw("43"); a3 == a1 && b3 == b1 {
+		t.Errorf("expected different seeds to give different numbers")
+	}
+	// macro arguments are evaluated once, drawing a single random number
+	for _, program := range []string{
+		"def diff(expr x) = x - x enddef; randomseed := 7; a = diff(normaldeviate);",
+		"def id(expr x) = x enddef; randomseed := 7; b = normaldeviate; randomseed := 7; a = id(normaldeviate) - b;",
+	} {
+		intp := run(program, t)
+		if a := intp.Evaluator().ValueOf("a"); !a.IsKnown() || a.Self().AsNumeric().AsFloat() != 0 {
+			t.Errorf("%q: expected a=0, is %v", program, a.Self())
+		}
+	}
+}
+
+func TestAlgebra(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, x := range []struct {
+		program string
+		a       float64
+	}{
+		{"a = -3 + -(1,2) dotprod (1,0);", -4},
+		{"a = +2 - -3;", 5},
+		{"a = (1,2) dotprod (3,4);", 11},
+		{"a = 7/2 + xpart ((3,4)/2);", 5},
+		{"-a = 2b; b = 3;", -6},
+		{"a + b = 3; a - b = 1;", 2},
+		{"z dotprod (1,1) = 3; ypart z = 2; a = xpart z;", 1},
+		{"a = xpart (-((1,2) transformed identity));", -1},
+	} {
+		intp := run(x.program, t)
+		v := intp.Evaluator().ValueOf("a")
+		if !v.IsKnown() || math.Abs(v.Self().AsNumeric().AsFloat()-x.a) > 1e-4 {
+			t.Errorf("%q: expected a=%g, is %v", x.program, x.a, v.Self())
+		}
+	}
+	for _, program := range []string{
+		"a = b*c;", "a = b/c;", "a = 1/0;", "z = (1,2)*(3,4);",
+		"a = z dotprod w;", "a = b * (c,1) dotprod (1,0);", "a = -\"x\";",
+	} {
+		ast, _, err := grammar.Parse(strings.NewReader(program))
+		if err != nil {
+			t.Fatalf("cannot parse %q: %v", program, err)
+		}
+		intp := newInterpreter(t)
+		r, _ := intp.Start(ast, corelang.LoadStandardLanguage())
+		if r == nil || r.Car.Type() != terex.ErrorType {
+			t.Errorf("%q: expected an error", program)
+		}
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	decls := "path p, q; pair z, w; string s; transform T; color c; "
+	for _, x := range []struct {
+		predicate string
+		result    bool
+	}{
+		{"known 1", true},
+		{"known a", false},
+		{"unknown a", true},
+		{"known (a-a)", true},
+		{"known b", true},
+		{"known (b+a)", false},
+		{"known z", false},
+		{"known w", true},
+		{"known xpart z", true},
+		{"unknown ypart z", true},
+		{"known p", true},
+		{"unknown q", true},
+		{"known s", false},
+		{"numeric a", true},
+		{"numeric z", false},
+		{"pair z", true},
+		{"pair (1,a)", true},
+		{"path p", true},
+		{"path q", true},
+		{"path z", false},
+		{"pen currentpen", true},
+		{"picture currentpicture", true},
+		{"string s", true},
+		{"string \"s\"", true},
+		{"boolean (1<2)", true},
+		{"transform T", true},
+		{"transform identity", true},
+		{"color c", true},
+		{"color (1,0,0)", true},
+		{"rgbcolor (1,0,0)", true},
+		{"cmykcolor (1,0,0)", false},
+		{"cycle p", true},
+		{"cycle q", false},
+		{"cycle z", false},
+	} {
+		program := decls + "p := (0,0)--(1,1)--cycle; b = 2; xpart z = 1; w = (1,2); " +
+			"n = if " + x.predicate + ": 1 else: 0 fi;"
+		intp := run(program, t)
+		n := intp.Evaluator().ValueOf("n")
+		if !n.IsKnown() || (n.Self().AsNumeric().AsFloat() == 1) != x.result {
+			t.Errorf("expected %q to be %v, is %v", x.predicate, x.result, n.Self())
+		}
+	}
+}
+
+func TestGroups(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, x := range []struct {
+		program string
+		b, c    float64
+	}{
+		{"a = 1; b = begingroup save a; a = 2; a + 1 endgroup; c = a;", 3, 1},
+		{"pair z; z = (1,2); b = begingroup save z; pair z; z = (3,4); xpart z endgroup; c = xpart z;", 3, 1},
+		{"a = 1; b = begingroup save a; a = 2; begingroup save a; a = 3; a endgroup + a endgroup; c = a;", 5, 1},
+		{"b = begingroup save t; 2t = a; t endgroup; a = 4; c = a;", 2, 4},
+		{"b = begingroup save t; t endgroup; c = begingroup save t; t endgroup; b + c = 2; b - c = 0;", 1, 1},
+		{"z = whatever[(0,0),(2,2)]; z = whatever[(0,2),(2,0)]; b = xpart z; c = ypart z;", 1, 1},
+		{"vardef half(expr x) = save t; 2t = x; t enddef; b = half(6); c = half(8);", 3, 4},
+		{"vardef half(expr x) = save t; 2t = x; t enddef; t = 10; b = half(t); c = t;", 5, 10},
+		{"def half(expr x) = begingroup save t; 2t = x; t endgroup enddef; t = 10; b = half(t); c = t;", 5, 10},
+		{"def twice(expr x) = x + x enddef; def both(expr x) = (x, twice(x)) enddef; z = both(whatever); xpart z = 3; b = ypart z; c = xpart z;", 6, 3},
+		{"def diff(expr x) = x - x enddef; b = diff(whatever) + 1; c = 0;", 1, 0},
+		{"a = 1; save a; b = if known a: 1 else: 0 fi; c = if numeric a: 1 else: 0 fi;", 0, 1},
+		{"b = begingroup save b; b = 1; b endgroup + 1; c = begingroup save x, y; x + y = 3; x - y = 1; x endgroup;", 2, 2},
+	} {
+		intp := run(x.program, t)
+		b, c := intp.Evaluator().ValueOf("b"), intp.Evaluator().ValueOf("c")
+		if !b.IsKnown() || !c.IsKnown() ||
+			math.Abs(b.Self().AsNumeric().AsFloat()-x.b) > 1e-4 || math.Abs(c.Self().AsNumeric().AsFloat()-x.c) > 1e-4 {
+			t.Errorf("%q: expected b=%g and c=%g, have %v and %v", x.program, x.b, x.c, b.Self(), c.Self())
+		}
+	}
+}
+
+func closeTo(a, b arithm.Pair) bool {
+	return math.Abs(a.X()-b.X()) < 1e-4 && math.Abs(a.Y()-b.Y()) < 1e-4
+}
+
+func TestOperatorDefinitions(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
+	defer teardown()
+	//
+	for _, c := range []struct {
+		program string
+		a       float64
+	}{
+		{"primarydef x less y = x-y enddef; a = 2 less 3 - 1;", -2},
+		{"primarydef x p y = x-y enddef; secondarydef x s y = x-y enddef; a = 8 s 4 p 1;", 5},
+		{"primarydef x neg y = b:=x-y; 0-b enddef; a = 4 neg 6;", 2},
+		{"primarydef x d y = x-y enddef; primarydef x d y = y-x enddef; a = 2 d 3;", 1},
+		{"primarydef x times y = x*y enddef; a = 2 times 3 + 1;", 7},
+		{"secondarydef x plus y = x+y enddef; a = 2 plus 3*4;", 14},
+		{"primarydef x avg y = b:=x+y; b/2 enddef; a = 4 avg 6;", 5},
+	} {
+		intp := run(c.program, t)
+		v := intp.Evaluator().ValueOf("a")
+		if !v.IsKnown() || v.Self().AsNumeric().AsFloat() != c.a {
+			t.Errorf("%q: expected a=%g, is %v", c.program, c.a, v.Self())
+		}
+	}
+}
+
 // --- Helpers ---------------------------------------------------------------
 
 type testTok struct {
@@ -71,6 +1081,30 @@ type testTok struct {
 	Value string
 }
 
+func run(program string, t *testing.T) *evaluator.Interpreter {
+	ast, _, err := grammar.Parse(strings.NewReader(program))
+	if err != nil {
+		t.Fatalf("cannot parse %q: %v", program, err)
+	}
+	intp := newInterpreter(t)
+	r, err := intp.Start(ast, corelang.LoadStandardLanguage())
+	if err != nil {
+		t.Fatalf("error executing %q: %v", program, err)
+	}
+	if r != nil && r.Car.Type() == terex.ErrorType {
+		t.Errorf("error executing %q: %v", program, r.Car)
+	}
+	return intp
+}
+
+func newInterpreter(t *testing.T, opts ...evaluator.Option) *evaluator.Interpreter {
+	intp, err := evaluator.NewInterpreter(opts...)
+	if err != nil {
+		t.Fatalf("error creating interpreter: %v", err)
+	}
+	return intp
+}
+
 func wrap(opname string, cat string) terex.Atom {
 	tok := grammar.MakeMPToken(grammar.SecondaryOp, opname, opname)
 	return terex.Atomize(pmmp.NewTokenOperator(&tok))
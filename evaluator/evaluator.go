@@ -2,30 +2,55 @@ package evaluator
 
 import (
 	"fmt"
+	"math/rand"
 
 	"github.com/npillmayer/arithm/polyn"
 	"github.com/npillmayer/gorgo/runtime"
+	"github.com/npillmayer/gorgo/terex"
 	"github.com/npillmayer/pmmp"
 	"github.com/npillmayer/pmmp/variables"
 )
 
 // Evaluator is a runtime environment for a PMMP interpreter.
 type Evaluator struct {
-	*runtime.Runtime                      // interpreter runtime environment
-	leq              *polyn.LinEqSolver   // solver for linear equations system
-	resolver         map[int]*runtime.Tag // used to resolve variable names from IDs
+	*runtime.Runtime                                          // interpreter runtime environment
+	leq              *polyn.LinEqSolver                       // solver for linear equations system
+	resolver         map[int]*runtime.Tag                     // used to resolve variable names from IDs
+	capsules         map[string]terex.Element                 // values of macro arguments
+	evaluated        map[*runtime.DynamicMemoryFrame][]string // capsules evaluated within a group
+	links            map[int32]*varRing                       // unknown non-numeric variables equated to each other
+	unit             float64                                  // size of the base unit of lengths, in bp
+	random           *rand.Rand                               // random numbers of this evaluator
 }
 
+// Option configures an evaluator when it is created, see NewEvaluator.
+type Option func(*Evaluator) error
+
 // NewEvaluator creates an evaluating runtime environment.
-// It is fully initialized and empty.
-func NewEvaluator() *Evaluator {
+// It is fully initialized, with only the predefined variables present.
+// Options are applied before the variables are predefined.
+func NewEvaluator(opts ...Option) (*Evaluator, error) {
 	ev := &Evaluator{
-		Runtime:  runtime.NewRuntimeEnvironment(nil),
-		leq:      polyn.CreateLinEqSolver(),
-		resolver: make(map[int]*runtime.Tag),
+		Runtime:   runtime.NewRuntimeEnvironment(nil),
+		leq:       polyn.CreateLinEqSolver(),
+		resolver:  make(map[int]*runtime.Tag),
+		capsules:  make(map[string]terex.Element),
+		evaluated: make(map[*runtime.DynamicMemoryFrame][]string),
+		links:     make(map[int32]*varRing),
 	}
 	ev.leq.SetVariableResolver(ev)
-	return ev
+	ev.seedRandom()
+	unit := DefaultBaseUnit
+	if pmmp.Configuration != nil && pmmp.Configuration.String("unit") != "" {
+		unit = pmmp.Configuration.String("unit")
+	}
+	for _, opt := range append([]Option{BaseUnit(unit)}, opts...) {
+		if err := opt(ev); err != nil {
+			return nil, err
+		}
+	}
+	ev.predefine()
+	return ev, nil
 }
 
 // GetVariableName returns
@@ -39,6 +64,9 @@ func (ev *Evaluator) GetVariableName(id int) string {
 	if !ok {
 		return fmt.Sprintf("?%04d", id)
 	}
+	if ppv, ok := v.UData.(*variables.PairPartValue); ok {
+		return ppv.Name()
+	}
 	return v.Name()
 }
 
@@ -63,6 +91,10 @@ func (ev *Evaluator) IsCapsule(id int) bool {
 func (ev *Evaluator) SetVariableSolved(id int, val float64) {
 	v, ok := ev.resolver[id]
 	if ok { // yes, we know about this variable
+		if ppv, ok := v.UData.(*variables.PairPartValue); ok {
+			ppv.Value = pmmp.FromFloat(val)
+			return
+		}
 		variables.VarFromTag(v).Set(pmmp.FromFloat(val))
 	}
 }
@@ -86,6 +118,9 @@ func (ev *Evaluator) EncapsuleVarsInMemory(mf *runtime.DynamicMemoryFrame) {
 		vref := variables.VarFromTag(sym)
 		tracer().P("var", vref.FullName()).Debugf("encapsule")
 		ev.EncapsuleVariable(vref.ID()) // vref is now capsule
+		for _, part := range vref.Parts() {
+			ev.EncapsuleVariable(part.ID())
+		}
 	})
 }
 
@@ -167,6 +202,7 @@ func (ev *Evaluator) Declare(decl *variables.VarDecl) {
 		tracer().P("tag", tag).Debugf("declare: found tag in scope %s", scope.Name)
 		tracer().P("decl", tag).Debugf("variable already declared - re-declaring")
 		// Erase all existing variables and re-define symbol
+		ev.eraseVariables(tagname, scope)
 		scope.Tags().InsertTag(decl.AsTag())
 	} else { // enter new symbol in global scope
 		scope = ev.ScopeTree.Globals()
@@ -175,6 +211,27 @@ func (ev *Evaluator) Declare(decl *variables.VarDecl) {
 	tracer().P("decl", decl.Name()).Debugf("declared symbol in %s", scope.Name)
 }
 
+// eraseVariables removes all variables of a tag from the memory frame of a
+// scope. Erased variables are encapsulated, as they may still be part of
+// equations.
+func (ev *Evaluator) eraseVariables(tagname string, scope *runtime.Scope) {
+	mf := ev.MemFrameStack.FindMemoryFrameForScope(scope)
+	if mf == nil {
+		return
+	}
+	for name, t := range mf.SymbolTable.Table {
+		v, ok := t.UData.(*variables.VarRef)
+		if !ok || v.Declaration().Name() != tagname {
+			continue
+		}
+		ev.EncapsuleVariable(v.ID())
+		for _, part := range v.Parts() {
+			ev.EncapsuleVariable(part.ID())
+		}
+		delete(mf.SymbolTable.Table, name)
+	}
+}
+
 // Variable creates a variable reference in a memory frame.
 // Parameters are the declaration for the variable,
 // a value and a flag, indicating if this variable should go to global memory.
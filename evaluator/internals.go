@@ -0,0 +1,129 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/npillmayer/pmmp"
+	"github.com/npillmayer/pmmp/variables"
+)
+
+// DefaultBaseUnit is the unit of length numerics are measured in, unless
+// another one is configured with key "unit" or given with option BaseUnit.
+const DefaultBaseUnit = "bp"
+
+// BaseUnit is an option for NewEvaluator and NewInterpreter: it sets the
+// unit of length numerics are measured in, i.e. the unit of length equal
+// to 1. The units of length and the lengths of plain MetaPost are
+// predefined in the base unit.
+func BaseUnit(unit string) Option {
+	return func(ev *Evaluator) error {
+		size, ok := Unit2numeric(unit)
+		if !ok {
+			return fmt.Errorf("unit of length %q not known, known units are %s",
+				unit, strings.Join(Units(), ", "))
+		}
+		ev.unit = size
+		return nil
+	}
+}
+
+// Length converts a length given in bp to the base unit.
+func (ev *Evaluator) Length(bp float64) float64 {
+	return bp / ev.unit
+}
+
+// predefine declares the variables which are predefined for every program:
+// currentpen, currentpicture, the units of length, the internal numerics
+// for stroking paths, for bounding boxes, for arrowheads and for labels,
+// MetaPost's names for their values, the colors and dash patterns of plain
+// MetaPost, and defaultfont.
+func (ev *Evaluator) predefine() {
+	half := pmmp.FromFloat(ev.Length(0.5))
+	pen, _ := pmmp.PenCircle().Transformed(pmmp.Scaling(half, half))
+	ev.Predefine("currentpen", pen)
+	ev.Predefine("currentpicture", pmmp.NullPicture())
+	for u, size := range units {
+		ev.Predefine(u, pmmp.FromFloat(size/ev.unit))
+	}
+	for _, n := range []struct {
+		tag   string
+		value float64
+	}{
+		{"linecap", float64(pmmp.RoundCap)},
+		{"linejoin", float64(pmmp.RoundJoin)},
+		{"miterlimit", 10},
+		{"butt", float64(pmmp.ButtCap)},
+		{"rounded", float64(pmmp.RoundCap)},
+		{"squared", float64(pmmp.SquareCap)},
+		{"mitered", float64(pmmp.MiterJoin)},
+		{"beveled", float64(pmmp.BevelJoin)},
+		{"bboxmargin", ev.Length(2)},
+		{"ahlength", ev.Length(4)},
+		{"ahangle", 45},
+		{"labeloffset", ev.Length(3)},
+		{"dotlabeldiam", ev.Length(3)},
+		{"defaultscale", 1},
+	} {
+		ev.Predefine(n.tag, pmmp.FromFloat(n.value))
+	}
+	zero, one := pmmp.FromFloat(0), pmmp.FromFloat(1)
+	for _, c := range []struct {
+		tag   string
+		value pmmp.Color
+	}{
+		{"black", pmmp.Greyscale(zero)},
+		{"white", pmmp.Greyscale(one)},
+		{"red", pmmp.NewColor(one, zero, zero)},
+		{"green", pmmp.NewColor(zero, one, zero)},
+		{"blue", pmmp.NewColor(zero, zero, one)},
+		{"background", pmmp.Greyscale(one)},
+	} {
+		ev.Predefine(c.tag, c.value)
+	}
+	on := func(l float64) pmmp.DashSegment { return pmmp.DashSegment{On: true, Length: ev.Length(l)} }
+	off := func(l float64) pmmp.DashSegment { return pmmp.DashSegment{Length: ev.Length(l)} }
+	ev.Predefine("evenly", pmmp.DashPattern(on(3), off(3)))
+	ev.Predefine("withdots", pmmp.DashPattern(off(2.5), on(0), off(2.5)))
+	ev.Predefine("defaultfont", pmmp.NewString(pmmp.DefaultFont))
+}
+
+// Predefine declares a global variable and sets it to a known value.
+func (ev *Evaluator) Predefine(tag string, v pmmp.Value) {
+	ev.Declare(variables.NewVarDecl(tag, v.Type()))
+	ev.findVariable(tag, nil).Set(v)
+}
+
+// Pickup is the MetaPost pickup command: make a pen the current pen.
+func (ev *Evaluator) Pickup(pen pmmp.Pen) error {
+	if !pen.IsKnown() {
+		return fmt.Errorf("pickup needs a known pen")
+	}
+	return ev.Assign(ev.findVariable("currentpen", nil), pen)
+}
+
+// CurrentStroke returns the attributes for stroking paths, as given by the
+// current values of currentpen, linecap, linejoin and miterlimit. Values
+// which are unknown or of the wrong type are replaced by their defaults.
+func (ev *Evaluator) CurrentStroke() pmmp.Stroke {
+	stroke := pmmp.Stroke{
+		Pen:        pmmp.PenCircle(),
+		Cap:        pmmp.LineCap(ev.internal("linecap", float64(pmmp.RoundCap))),
+		Join:       pmmp.LineJoin(ev.internal("linejoin", float64(pmmp.RoundJoin))),
+		MiterLimit: ev.internal("miterlimit", 10),
+	}
+	if v := ev.valueOf(ev.findVariable("currentpen", nil)); v.IsKnown() && v.Self().IsPen() {
+		stroke.Pen = v.Self().AsPen()
+	}
+	return stroke
+}
+
+// internal returns the value of a numeric variable, or a default if it is
+// not a known numeric.
+func (ev *Evaluator) internal(tag string, dflt float64) float64 {
+	v := ev.valueOf(ev.findVariable(tag, nil))
+	if !v.IsKnown() || !v.Self().IsNumeric() {
+		return dflt
+	}
+	return v.Self().AsNumeric().AsFloat()
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/npillmayer/gorgo"
 	"github.com/npillmayer/gorgo/runtime"
 	"github.com/npillmayer/gorgo/terex"
 	"github.com/npillmayer/pmmp"
@@ -17,27 +18,43 @@ type Interpreter struct {
 	evaluator *Evaluator   // expression evaluator and interpreter runtime
 	ast       *terex.GCons // program code to execute
 	env       *terex.Environment
-	thread0   *Thread // initial execution 'thread'
+	thread0   *Thread                    // initial execution 'thread'
+	operators map[string]*binaryOperator // user-defined operators
 }
 
-// NewInterpreter creates a new interpreter for the PMMP language.
-func NewInterpreter() *Interpreter {
+// NewInterpreter creates a new interpreter for the PMMP language. Options
+// are passed on to the interpreter's evaluator, see NewEvaluator.
+func NewInterpreter(opts ...Option) (*Interpreter, error) {
+	ev, err := NewEvaluator(opts...)
+	if err != nil {
+		return nil, err
+	}
 	intp := &Interpreter{
-		evaluator: NewEvaluator(),
+		evaluator: ev,
+		operators: make(map[string]*binaryOperator),
 	}
-	return intp
+	return intp, nil
+}
+
+// Evaluator returns the interpreter's evaluator, which holds the runtime
+// environment of the program executed.
+func (intp *Interpreter) Evaluator() *Evaluator {
+	return intp.evaluator
 }
 
 // Thread is an entity for fetch-decode-excuting AST elements.
 type Thread struct {
-	PC       *terex.GCons                // program counter
-	IR       instruction                 // instruction register
-	mem      *runtime.DynamicMemoryFrame // TODO ?
-	args     *terex.GCons                // input args
-	argsCh   chan *terex.GCons           // channel for input args
-	resultCh chan *terex.GCons           // channel for result
-	intp     *Interpreter                // life-line to interpreter
-	envLocal *terex.Environment          // thread local data
+	PC           *terex.GCons                // program counter
+	IR           instruction                 // instruction register
+	mem          *runtime.DynamicMemoryFrame // TODO ?
+	args         *terex.GCons                // input args
+	argsCh       chan *terex.GCons           // channel for input args
+	resultCh     chan *terex.GCons           // channel for result
+	intp         *Interpreter                // life-line to interpreter
+	envLocal     *terex.Environment          // thread local data
+	loops        int                         // nesting depth of loops
+	exiting      bool                        // exitif has been triggered
+	suffixParams []suffixBinding             // bindings of suffix parameters
 }
 
 // Fork splits an FDE-thread and starts the child thread, processing pc.
@@ -86,16 +103,27 @@ func (th *Thread) run() {
 // FetchDecodeExecute processes a fragment of the AST.
 func (th *Thread) FetchDecodeExecute(e terex.Element) terex.Element {
 	var err error
-	if e.Type() == terex.NumType { // TODO pack this into package pmmp
+	if e.IsNil() {
+		return e
+	}
+	switch e.Type() {
+	case terex.NumType: // TODO pack this into package pmmp
 		return terex.Elem(pmmp.FromFloat(e.AsAtom().Data.(float64)))
-	} else if e.Type() == terex.StringType {
-		// TODO string Value
+	case terex.StringType:
+		return terex.Elem(pmmp.NewString(e.AsAtom().Data.(string)))
+	case terex.TokenType: // numbers or nullary operators
+		return th.executeToken(e.AsAtom().Data.(gorgo.Token))
+	case terex.UserType, terex.BoolType, terex.ErrorType:
+		return e // already evaluated
+	case terex.ConsType:
+		if l := e.AsList(); l.Car.Type() != terex.OperatorType {
+			return th.executeSequence(l) // list of statements
+		}
 	}
 	th.IR, err = th.intp.fetch(e.AsList()) // fetch
 	if err != nil {
 		tracer().Errorf("FDE error: " + err.Error())
-		th.intp.env.Error(err)
-		return terex.Elem(terex.ErrorAtom(err.Error()))
+		return th.error(err)
 	}
 	// decode
 	tracer().Debugf("decode instruction %v", th.IR)
@@ -103,6 +131,39 @@ func (th *Thread) FetchDecodeExecute(e terex.Element) terex.Element {
 	return result
 }
 
+// executeToken processes a bare token of the AST. Numeric tokens evaluate to
+// numeric values, other tokens are executed as an operator without arguments.
+func (th *Thread) executeToken(tok gorgo.Token) terex.Element {
+	if f, ok := tok.Value().(float64); ok {
+		return terex.Elem(pmmp.FromFloat(f))
+	}
+	op := terex.Atomize(pmmp.NewTokenOperator(tok))
+	return th.FetchDecodeExecute(terex.Elem(terex.Cons(op, nil)))
+}
+
+// executeSequence processes a list of AST fragments one after the other,
+// stopping at the first error or if a loop is exited. Returns the result of the last fragment.
+func (th *Thread) executeSequence(l *terex.GCons) terex.Element {
+	result := terex.Elem(nil)
+	for ; l != nil; l = l.Cdr {
+		if l.Car.Data == nil { // empty statement
+			continue
+		}
+		result = th.FetchDecodeExecute(terex.Elem(l.Car))
+		if result.Type() == terex.ErrorType || th.exiting {
+			break
+		}
+	}
+	return result
+}
+
+// error flags an error to the interpreter's environment and wraps it into
+// an error atom, to be returned as the result of an instruction.
+func (th *Thread) error(err error) terex.Element {
+	th.intp.env.Error(err)
+	return terex.Elem(terex.ErrorAtom(err.Error()))
+}
+
 // Start expects a list (AST #eof)
 func (intp *Interpreter) Start(program *terex.GCons, env *terex.Environment) (*terex.GCons, error) {
 	intp.ast = program
@@ -134,6 +195,10 @@ func (intp *Interpreter) Start(program *terex.GCons, env *terex.Environment) (*t
 // operators in the environment (or completely swapping environments with
 // different operator sets pre-loaded).
 //
+// Statements and control structures are built into the interpreter and
+// will be found before any operator from the environment. Operators defined
+// by the program come next, i.e. they override operators of the environment.
+//
 // Will return a NOP if operator is not found in environment.
 //
 func (intp *Interpreter) fetch(astNode *terex.GCons) (instruction, error) {
@@ -142,8 +207,15 @@ func (intp *Interpreter) fetch(astNode *terex.GCons) (instruction, error) {
 		tracer().Errorf("fetch saw non-operator")
 		return nop, fmt.Errorf("op fetch saw: %v", astNode.Car)
 	}
-	op := e.First().AsAtom().Data.(pmmp.TokenOperator)
-	opname := op.Token().Lexeme()
+	opname := operatorName(e.AsAtom())
+	if builtin, ok := builtins[opname]; ok {
+		tracer().Debugf("fetch of built-in operator %s", opname)
+		return builtin, nil
+	}
+	if op, ok := intp.operators[opname]; ok {
+		tracer().Debugf("fetch of user-defined operator %s", opname)
+		return op.call, nil
+	}
 	opsym := intp.env.FindSymbol(opname, true)
 	if opsym == nil {
 		tracer().Errorf("Cannot find operation %s", opname)
@@ -159,6 +231,16 @@ func (intp *Interpreter) fetch(astNode *terex.GCons) (instruction, error) {
 	return operator.Call, nil
 }
 
+// operatorName returns the name of an AST operator. Token operators are
+// named by their lexeme, other operators (e.g., for grammar rules like
+// "equation") by their string representation.
+func operatorName(a terex.Atom) string {
+	if op, ok := a.Data.(pmmp.TokenOperator); ok {
+		return op.Token().Lexeme()
+	}
+	return a.Data.(terex.Operator).String()
+}
+
 // GetEvaluator resolves an Evaluator from an environment. This is to be
 // used by operators, which will have been passed an environment which
 // includes a symbol for the calling interpreter's evaluator.
@@ -0,0 +1,151 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/npillmayer/arithm"
+	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
+)
+
+// labelPosition holds the placement of labels with a given suffix, as in
+// plain MetaPost: the direction in which a label is offset from its point
+// (laboff), and the fractions of its width and height which lie to the left
+// of and below its point (labxf, labyf).
+type labelPosition struct {
+	laboff       arithm.Pair
+	labxf, labyf float64
+}
+
+var labelPositions = map[string]labelPosition{
+	"":     {arithm.P(0, 0), .5, .5},
+	"lft":  {arithm.P(-1, 0), 1, .5},
+	"rt":   {arithm.P(1, 0), 0, .5},
+	"top":  {arithm.P(0, 1), .5, 0},
+	"bot":  {arithm.P(0, -1), .5, 1},
+	"ulft": {arithm.P(-.7, .7), 1, 0},
+	"urt":  {arithm.P(.7, .7), 0, 0},
+	"llft": {arithm.P(-.7, -.7), 1, 1},
+	"lrt":  {arithm.P(.7, -.7), 0, 1},
+}
+
+// evalTheLabel evaluates
+//
+//     ( thelabel "suffix" ⟨tertiary⟩ ⟨tertiary⟩ )
+//
+// to the picture of a label.
+func evalTheLabel(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	pic, _, err := th.label(e.AsList())
+	if err != nil {
+		return th.error(err)
+	}
+	return terex.Elem(pic)
+}
+
+// evalLabel executes
+//
+//     ( label|dotlabel "suffix" ⟨tertiary⟩ ⟨tertiary⟩ ⟨drawing option⟩ … )
+//
+// which draws a label into currentpicture. dotlabel draws a dot of diameter
+// dotlabeldiam at the point of the label as well.
+func evalLabel(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	ev := th.intp.evaluator
+	l := e.AsList()
+	cmd := operatorName(l.Car)
+	vref := ev.findVariable("currentpicture", nil)
+	pic, err := ev.pictureOf(cmd, vref)
+	if err != nil {
+		return th.error(err)
+	}
+	lab, z, err := th.label(l)
+	if err != nil {
+		return th.error(err)
+	}
+	opts, err := th.options(l.Cddr().Cddr(), drawingOptions{})
+	if err != nil {
+		return th.error(err)
+	}
+	pic, err = ev.addTo(pic, "also", lab, opts)
+	if err == nil && cmd == "dotlabel" {
+		d := pmmp.FromFloat(ev.internal("dotlabeldiam", ev.Length(3)))
+		pen, _ := pmmp.PenCircle().Transformed(pmmp.Scaling(d, d))
+		round := pmmp.RoundCap
+		opts.pen, opts.cap = &pen, &round
+		pic, err = ev.addTo(pic, "doublepath", pmmp.ConvPair(z), opts)
+	}
+	if err == nil {
+		err = ev.Assign(vref, pic)
+	}
+	if err != nil {
+		return th.error(err)
+	}
+	return terex.Elem(nil)
+}
+
+// label evaluates the arguments of a label, given as
+//
+//     ( op "suffix" ⟨tertiary⟩ ⟨tertiary⟩ … )
+//
+// and returns the picture of the label and its point. The label is either
+// a picture or a string, which is typeset in defaultfont and scaled by
+// defaultscale. The picture is placed as plain MetaPost's thelabel does:
+// its bounding box is positioned next to the point, according to the suffix,
+// at a distance of labeloffset.
+func (th *Thread) label(l *terex.GCons) (pmmp.Picture, arithm.Pair, error) {
+	ev := th.intp.evaluator
+	suffix, _ := l.Cdar().Data.(string)
+	pos, ok := labelPositions[suffix]
+	if !ok {
+		return pmmp.Picture{}, 0, fmt.Errorf("label suffix %q not known", suffix)
+	}
+	s, err := th.value(l.Cddar())
+	if err != nil {
+		return pmmp.Picture{}, 0, err
+	}
+	zv, err := th.value(l.Cddr().Cdar())
+	if err != nil {
+		return pmmp.Picture{}, 0, err
+	}
+	if !zv.IsKnown() || !zv.Self().IsPair() {
+		return pmmp.Picture{}, 0, fmt.Errorf("label needs a known pair, have %v", zv.Self())
+	}
+	z := zv.Self().AsPair().AsPair()
+	var pic pmmp.Picture
+	switch {
+	case s.IsKnown() && s.Self().IsPicture():
+		pic = s.Self().AsPicture()
+	case s.IsKnown() && s.Self().IsString():
+		font := pmmp.DefaultFont
+		if f := ev.valueOf(ev.findVariable("defaultfont", nil)); f.IsKnown() && f.Self().IsString() {
+			font = f.Self().AsString().AsString()
+		}
+		if pic, err = ev.InFont(s.Self().AsString().AsString(), font); err != nil {
+			return pmmp.Picture{}, 0, err
+		}
+		scale := pmmp.FromFloat(ev.internal("defaultscale", 1))
+		if pic, err = pic.Transformed(pmmp.Scaling(scale, scale)); err != nil {
+			return pmmp.Picture{}, 0, err
+		}
+	default:
+		return pmmp.Picture{}, 0, fmt.Errorf("label needs a known string or picture, have %v", s.Self())
+	}
+	ll, ur := pic.BBox()
+	lr, ul := arithm.P(ur.X(), ll.Y()), arithm.P(ll.X(), ur.Y())
+	ref := lr.Scaled(pos.labxf) + ul.Scaled(pos.labyf) + ll.Scaled(1-pos.labxf-pos.labyf)
+	shift := z + pos.laboff.Scaled(ev.internal("labeloffset", ev.Length(3))) - ref
+	pic, err = pic.Transformed(pmmp.Shifting(pmmp.FromFloat(shift.X()), pmmp.FromFloat(shift.Y())))
+	return pic, z, err
+}
+
+// InFont is MetaPost's s infont f, with the size of the text converted to
+// the base unit.
+func (ev *Evaluator) InFont(chars string, font string) (pmmp.Picture, error) {
+	pic, err := pmmp.InFont(chars, font)
+	if err != nil || ev.unit == 1 {
+		return pic, err
+	}
+	scale := pmmp.FromFloat(ev.Length(1))
+	return pic.Transformed(pmmp.Scaling(scale, scale))
+}
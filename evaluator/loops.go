@@ -0,0 +1,283 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/npillmayer/gorgo"
+	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
+	"github.com/npillmayer/pmmp/variables"
+)
+
+// suffixBinding binds a tag to a list of suffixes, e.g. the loop variable
+// of forsuffixes.
+type suffixBinding struct {
+	tag      string
+	suffixes []varSuffix
+}
+
+// evalLoop executes loops, given as
+//
+//     ( #for TAG ( #step ⟨start⟩ ⟨step⟩ ⟨limit⟩ ) ⟨body⟩ )
+//     ( #for TAG ( #list ⟨tertiary⟩ … ) ⟨body⟩ )
+//     ( #forsuffixes TAG ( #list ⟨suffix⟩ … ) ⟨body⟩ )
+//     ( #forever ⟨body⟩ )
+//
+// Every iteration executes the body within a group of its own, with a fresh
+// loop variable. Loops are terminated by exitif/exitunless.
+//
+// The result of a loop is the list of the results of its iterations, which
+// is needed for loops within path expressions.
+func evalLoop(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	th.loops++
+	defer func() { th.loops-- }()
+	l := e.AsList()
+	body := l.Last().Car
+	it := &loopIterations{th: th, body: body}
+	if operatorName(l.Car) == "forever" {
+		for it.next(nil) {
+		}
+		return it.result()
+	}
+	tag, err := tagName(l.Cdar())
+	if err != nil {
+		return th.error(err)
+	}
+	values, ok := l.Cddar().Data.(*terex.GCons)
+	if !ok {
+		return th.error(fmt.Errorf("loop without values for %s", tag))
+	}
+	if operatorName(l.Car) == "forsuffixes" {
+		for x := values.Cdr; x != nil; x = x.Cdr {
+			sfx, err := th.collectSuffixes(terex.Cons(x.Car, nil), nil)
+			if err != nil {
+				return th.error(err)
+			}
+			th.suffixParams = append(th.suffixParams, suffixBinding{tag: tag, suffixes: sfx})
+			goon := it.next(nil)
+			th.suffixParams = th.suffixParams[:len(th.suffixParams)-1]
+			if !goon {
+				break
+			}
+		}
+		return it.result()
+	}
+	if operatorName(values.Car) == "step" { // progression
+		start, step, limit, err := th.progression(values)
+		if err != nil {
+			return th.error(err)
+		}
+		eps := math.Abs(step) * 1e-9 // tolerate rounding errors for fractional steps
+		for i := 0; ; i++ {
+			x := start + float64(i)*step
+			if (step > 0 && x > limit+eps) || (step < 0 && x < limit-eps) {
+				break
+			}
+			if !it.next(th.bindValue(tag, pmmp.FromFloat(x))) {
+				break
+			}
+		}
+		return it.result()
+	}
+	for x := values.Cdr; x != nil; x = x.Cdr { // for list
+		v, err := th.value(x.Car)
+		if err != nil {
+			return th.error(err)
+		}
+		if !it.next(th.bindValue(tag, v)) {
+			break
+		}
+	}
+	return it.result()
+}
+
+// evalExit executes
+//
+//     ( #exitif ⟨boolean expression⟩ )   or   ( #exitunless ⟨boolean expression⟩ )
+//
+// and signals the innermost loop to terminate.
+func evalExit(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	l := e.AsList()
+	if th.loops == 0 {
+		return th.error(fmt.Errorf("%s outside of a loop", operatorName(l.Car)))
+	}
+	cond := th.FetchDecodeExecute(terex.Elem(l.Cdar()))
+	if cond.Type() == terex.ErrorType {
+		return cond
+	}
+	b, err := truthValue(cond)
+	if err != nil {
+		return th.error(err)
+	}
+	th.exiting = b == (operatorName(l.Car) == "exitif")
+	return terex.Elem(nil)
+}
+
+// evalGroup executes
+//
+//     ( #begingroup ( #statements ⟨statement⟩ … ) ⟨tertiary⟩ )
+//
+// within a new scope and memory frame. The result is the value of the
+// tertiary.
+func evalGroup(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	ev := th.intp.evaluator
+	Begingroup(ev.Runtime, "group")
+	defer ev.Endgroup()
+	return th.groupBody(e.AsList())
+}
+
+// evalSave executes
+//
+//     ( save ( #TAG ( #suffix "a" ) ) SymTok … )
+//
+// which saves symbolic tokens until the end of the current group.
+func evalSave(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	for l := e.AsList().Cdr; l != nil; l = l.Cdr {
+		tag, err := symbolicToken(l.Car)
+		if err != nil {
+			return th.error(err)
+		}
+		th.intp.evaluator.Save(tag)
+	}
+	return terex.Elem(nil)
+}
+
+// symbolicToken returns the name of a symbolic token of a save command,
+// either a tag without suffixes or a SymTok.
+func symbolicToken(a terex.Atom) (string, error) {
+	switch x := a.Data.(type) {
+	case gorgo.Token:
+		return x.Lexeme(), nil
+	case *terex.GCons: // ( #TAG ( #suffix "a" ) … )
+		if x.Length() == 2 {
+			if sfx, ok := x.Cdar().Data.(*terex.GCons); ok {
+				if tag, ok := sfx.Cdar().Data.(string); ok {
+					return tag, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("save needs symbolic tokens, have %v", a)
+}
+
+// evalWhatever evaluates whatever to a new capsule.
+func evalWhatever(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	return terex.Elem(th.intp.evaluator.Whatever())
+}
+
+// groupBody executes the statements of a group node and returns the value
+// of its tertiary.
+func (th *Thread) groupBody(l *terex.GCons) terex.Element {
+	r := th.FetchDecodeExecute(terex.Elem(l.Cdar()))
+	if r.Type() == terex.ErrorType || th.exiting {
+		return r
+	}
+	return th.FetchDecodeExecute(terex.Elem(l.Cddar()))
+}
+
+// loopIterations executes the iterations of a loop and collects their
+// results.
+type loopIterations struct {
+	th      *Thread
+	body    terex.Atom
+	results *terex.GCons
+	err     terex.Element
+}
+
+// next executes the loop body once, within a group of its own. bind is
+// called after the group has been entered, to bind the loop variable.
+// next returns false if the loop has to be terminated.
+func (it *loopIterations) next(bind func() error) bool {
+	ev := it.th.intp.evaluator
+	Begingroup(ev.Runtime, "loop")
+	defer ev.Endgroup()
+	if bind != nil {
+		if err := bind(); err != nil {
+			it.err = it.th.error(err)
+			return false
+		}
+	}
+	r := it.th.FetchDecodeExecute(terex.Elem(it.body))
+	if r.Type() == terex.ErrorType {
+		it.err = r
+		return false
+	}
+	if !r.IsNil() {
+		it.results = it.results.Append(terex.Cons(r.AsAtom(), nil))
+	}
+	if it.th.exiting {
+		it.th.exiting = false
+		return false
+	}
+	return true
+}
+
+func (it *loopIterations) result() terex.Element {
+	if !it.err.IsNil() {
+		return it.err
+	}
+	return terex.Elem(it.results)
+}
+
+// bindValue returns a function to bind a tag, e.g. a loop variable or a
+// parameter, to a value in the current scope. Unknown numeric values are
+// bound by an equation. Unknown values of the non-numeric types carry no
+// reference to their variable, so the tag is left unknown.
+func (th *Thread) bindValue(tag string, v pmmp.Value) func() error {
+	return func() error {
+		ev := th.intp.evaluator
+		typ := v.Type()
+		switch typ {
+		case pmmp.VardefType, pmmp.SubscriptType, pmmp.SuffixType:
+			return fmt.Errorf("binding a value of type %v to %s not supported", v.Type(), tag)
+		}
+		decl := variables.NewVarDecl(tag, typ)
+		ev.ScopeTree.Current().Tags().InsertTag(decl.AsTag())
+		vref := ev.findVariable(tag, nil)
+		if v.IsKnown() {
+			vref.Set(v)
+			return nil
+		}
+		if isNonnumeric(v) {
+			return nil
+		}
+		return ev.Equation(ev.valueOf(vref), v)
+	}
+}
+
+// progression evaluates ( #step ⟨start⟩ ⟨step⟩ ⟨limit⟩ ).
+func (th *Thread) progression(l *terex.GCons) (start, step, limit float64, err error) {
+	var x [3]float64
+	for i, a := range []terex.Atom{l.Nth(2), l.Nth(3), l.Nth(4)} {
+		var v pmmp.Value
+		if v, err = th.value(a); err != nil {
+			return
+		}
+		if !v.IsKnown() || !v.Self().IsNumeric() {
+			err = fmt.Errorf("progression needs known numerics, have %v", v.Self())
+			return
+		}
+		x[i] = v.Self().AsNumeric().AsFloat()
+	}
+	if x[1] == 0 {
+		err = fmt.Errorf("progression with step 0")
+	}
+	return x[0], x[1], x[2], err
+}
+
+// tagName returns the name of a loop variable or parameter, given as a TAG
+// token.
+func tagName(a terex.Atom) (string, error) {
+	if tok, ok := a.Data.(gorgo.Token); ok {
+		if tag, ok := tok.Value().([]string); ok && len(tag) == 1 {
+			return tag[0], nil
+		}
+	}
+	return "", fmt.Errorf("illegal tag: %v", a)
+}
@@ -0,0 +1,73 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
+)
+
+// binaryOperator is an operator defined by primarydef, secondarydef or
+// tertiarydef. The lexer has classified its name as an operator of the
+// respective level, so calls of it are parsed like calls of built-in
+// operators.
+type binaryOperator struct {
+	name   string
+	params [2]string    // left and right parameter
+	body   *terex.GCons // ( #begingroup ( #statements … ) ⟨tertiary⟩ )
+}
+
+// evalOperatorDef executes
+//
+//     ( #primarydef TAG TAG TAG ⟨body⟩ )
+//
+// i.e., the definition of an operator from its left parameter, its name and
+// its right parameter. Definitions of secondarydef and tertiarydef are
+// handled the same way. An existing definition will be replaced.
+func evalOperatorDef(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	l := e.AsList()
+	op := &binaryOperator{}
+	var err error
+	for i, s := range []*string{&op.params[0], &op.name, &op.params[1]} {
+		if *s, err = tagName(l.Nth(i + 2)); err != nil {
+			return th.error(err)
+		}
+	}
+	var ok bool
+	if op.body, ok = l.Nth(5).Data.(*terex.GCons); !ok {
+		return th.error(fmt.Errorf("%s %s: missing replacement text", operatorName(l.Car), op.name))
+	}
+	tracer().Debugf("define operator %s", op.name)
+	th.intp.operators[op.name] = op
+	return terex.Elem(nil)
+}
+
+// call executes
+//
+//     ( #op ⟨left⟩ ⟨right⟩ )
+//
+// for a user-defined operator. The operands are evaluated and bound to the
+// parameters of the operator within a group of their own; the result is the
+// value of the replacement text.
+func (op *binaryOperator) call(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	l := e.AsList()
+	var args [2]pmmp.Value
+	for i := range args {
+		v, err := th.value(l.Nth(i + 2))
+		if err != nil {
+			return th.error(err)
+		}
+		args[i] = v
+	}
+	ev := th.intp.evaluator
+	Begingroup(ev.Runtime, op.name)
+	defer ev.Endgroup()
+	for i, v := range args {
+		if err := th.bindValue(op.params[i], v)(); err != nil {
+			return th.error(err)
+		}
+	}
+	return th.groupBody(op.body)
+}
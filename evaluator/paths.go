@@ -0,0 +1,273 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/npillmayer/arithm"
+	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
+)
+
+// cycleKnot is the knot item for 'cycle' in a path expression.
+type cycleKnot struct{}
+
+// evalPath evaluates
+//
+//     ( #make-path ⟨knot⟩ ⟨join⟩ ⟨knot⟩ … )
+//
+// to a path value. Conditional path segments and segment loops are unrolled
+// into knots and joins first.
+func evalPath(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	items, err := th.pathItems(e.AsList().Cdr, nil)
+	if err != nil {
+		return th.error(err)
+	}
+	p, err := buildPath(items)
+	if err != nil {
+		return th.error(err)
+	}
+	return terex.Elem(p)
+}
+
+// evalSegment evaluates
+//
+//     ( #segment ⟨join⟩ ⟨knot⟩ … )
+//
+// i.e., the body of a conditional path segment or a segment loop, to the
+// list of its path items. The items are knot values, joins and cycle.
+func evalSegment(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	items, err := th.pathItems(e.AsList().Cdr, nil)
+	if err != nil {
+		return th.error(err)
+	}
+	var l *terex.GCons
+	for _, item := range items {
+		l = l.Append(terex.Cons(terex.Atomize(item), nil))
+	}
+	return terex.Elem(l)
+}
+
+// pathItems evaluates the items of a path expression or a path segment.
+// Conditionals and loops are executed and their results are spliced into
+// the list of items.
+func (th *Thread) pathItems(l *terex.GCons, items []interface{}) ([]interface{}, error) {
+	var err error
+	for ; l != nil; l = l.Cdr {
+		if l.Car.Data == nil { // empty path segment
+			continue
+		}
+		if node, ok := l.Car.Data.(*terex.GCons); ok && node.Car.Type() == terex.OperatorType {
+			switch operatorName(node.Car) {
+			case "cycle":
+				if node.Cdr == nil { // not the cycle predicate
+					items = append(items, cycleKnot{})
+					continue
+				}
+			case "--", "---", "..", "...":
+				var j pmmp.Join
+				if j, err = th.pathJoin(node, pmmp.NewJoin(operatorName(node.Car))); err != nil {
+					return nil, err
+				}
+				items = append(items, j)
+				continue
+			case "if", "for", "forsuffixes", "forever", "segment":
+				r := th.FetchDecodeExecute(terex.Elem(l.Car))
+				if r.Type() == terex.ErrorType {
+					return nil, fmt.Errorf("%v", r.AsAtom().Data)
+				}
+				if items, err = unrollItems(r.AsAtom(), items); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		v, err := th.value(l.Car)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+// unrollItems appends the result of a conditional or a loop to a list of
+// path items. Loop results are lists of segments, which are lists of items
+// themselves.
+func unrollItems(a terex.Atom, items []interface{}) ([]interface{}, error) {
+	var err error
+	switch item := a.Data.(type) {
+	case nil:
+	case *terex.GCons:
+		for ; item != nil; item = item.Cdr {
+			if items, err = unrollItems(item.Car, items); err != nil {
+				return nil, err
+			}
+		}
+	case pmmp.Value, pmmp.Join, cycleKnot:
+		items = append(items, item)
+	default:
+		return nil, fmt.Errorf("not a path item: %v", a)
+	}
+	return items, nil
+}
+
+// pathJoin evaluates a join, given as
+//
+//     ( #-- )    or    ( #.. ⟨direction⟩ ( #.. [⟨tension⟩ | ⟨controls⟩] ) ⟨direction⟩ )
+//
+func (th *Thread) pathJoin(node *terex.GCons, j pmmp.Join) (pmmp.Join, error) {
+	dirs := 0
+	for x := node.Cdr; x != nil; x = x.Cdr {
+		sub, ok := x.Car.Data.(*terex.GCons)
+		if !ok || sub.Car.Type() != terex.OperatorType {
+			continue
+		}
+		var err error
+		switch name := operatorName(sub.Car); name {
+		case "auto", "dir", "curl":
+			var d pmmp.Direction
+			if d, err = th.direction(sub); err != nil {
+				return j, err
+			}
+			if dirs == 0 {
+				j.Pre = d
+			} else {
+				j.Post = d
+			}
+			dirs++
+		case "tension":
+			var t []float64
+			if t, err = th.knownNumerics(sub.Cdr); err != nil {
+				return j, err
+			}
+			j.Tension = [2]float64{t[0], t[len(t)-1]}
+		case "controls":
+			if j.Controls, err = th.knownPairs(sub.Cdr); err != nil {
+				return j, err
+			}
+			if len(j.Controls) == 1 {
+				j.Controls = append(j.Controls, j.Controls[0])
+			}
+		default: // basic path join
+			j.Type = name
+			if j, err = th.pathJoin(sub, j); err != nil {
+				return j, err
+			}
+		}
+	}
+	return j, nil
+}
+
+// direction evaluates a direction specifier
+//
+//     ( #auto )   or   ( #dir ⟨tertiary⟩ )   or   ( #curl ⟨tertiary⟩ )
+//
+func (th *Thread) direction(node *terex.GCons) (pmmp.Direction, error) {
+	switch operatorName(node.Car) {
+	case "dir":
+		z, err := th.knownPairs(node.Cdr)
+		if err != nil {
+			return pmmp.Direction{}, err
+		}
+		return pmmp.Direction{Kind: pmmp.DirGiven, Dir: z[0]}, nil
+	case "curl":
+		c, err := th.knownNumerics(node.Cdr)
+		if err != nil {
+			return pmmp.Direction{}, err
+		}
+		return pmmp.Direction{Kind: pmmp.DirCurl, Curl: c[0]}, nil
+	}
+	return pmmp.Direction{Kind: pmmp.DirAuto}, nil
+}
+
+// knownNumerics evaluates a list of expressions, which have to result in
+// known numerics.
+func (th *Thread) knownNumerics(l *terex.GCons) ([]float64, error) {
+	var r []float64
+	for ; l != nil; l = l.Cdr {
+		v, err := th.value(l.Car)
+		if err != nil {
+			return nil, err
+		}
+		if !v.IsKnown() || !v.Self().IsNumeric() {
+			return nil, fmt.Errorf("known numeric expected, have %v", v.Self())
+		}
+		r = append(r, v.Self().AsNumeric().AsFloat())
+	}
+	return r, nil
+}
+
+// knownPairs evaluates a list of expressions, which have to result in
+// known pairs.
+func (th *Thread) knownPairs(l *terex.GCons) ([]arithm.Pair, error) {
+	var r []arithm.Pair
+	for ; l != nil; l = l.Cdr {
+		v, err := th.value(l.Car)
+		if err != nil {
+			return nil, err
+		}
+		if !v.IsKnown() || !v.Self().IsPair() {
+			return nil, fmt.Errorf("known pair expected, have %v", v.Self())
+		}
+		r = append(r, v.Self().AsPair().AsPair())
+	}
+	return r, nil
+}
+
+// buildPath creates a path from a list of path items, which have to
+// alternate between knots and joins. Knots have to be known pairs or paths;
+// paths are concatenated, keeping the control points already chosen for
+// them. cycle may only appear as the last knot.
+func buildPath(items []interface{}) (pmmp.Path, error) {
+	var knots []arithm.Pair
+	var joins []pmmp.Join
+	cycle, joined := false, true // a path starts with a knot
+	for i, item := range items {
+		if cycle {
+			return pmmp.Path{}, fmt.Errorf("cycle has to be the last knot of a path")
+		}
+		if j, ok := item.(pmmp.Join); ok {
+			if joined {
+				return pmmp.Path{}, fmt.Errorf("path join without a knot in front of it")
+			}
+			joins = append(joins, j)
+			joined = true
+			continue
+		}
+		if !joined {
+			return pmmp.Path{}, fmt.Errorf("path knots need a join between them")
+		}
+		joined = false
+		switch k := item.(type) {
+		case cycleKnot:
+			if i == 0 {
+				return pmmp.Path{}, fmt.Errorf("path cannot start with cycle")
+			}
+			cycle = true
+		case pmmp.Value:
+			switch {
+			case k.IsKnown() && k.Self().IsPair():
+				knots = append(knots, k.Self().AsPair().AsPair())
+			case k.IsKnown() && k.Self().IsPath():
+				p := k.Self().AsPath()
+				if p.IsCycle() {
+					return pmmp.Path{}, fmt.Errorf("cannot append to a cyclic path")
+				}
+				for n := 0; n < p.N(); n++ {
+					knots = append(knots, p.Knot(n))
+					if n < p.N()-1 {
+						joins = append(joins, p.ExplicitJoin(n))
+					}
+				}
+			default:
+				return pmmp.Path{}, fmt.Errorf("path knot is not a known pair: %v", k.Self())
+			}
+		}
+	}
+	if joined {
+		return pmmp.Path{}, fmt.Errorf("path ends with a join")
+	}
+	return pmmp.NewPath(knots, joins, cycle)
+}
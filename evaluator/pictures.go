@@ -0,0 +1,324 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/npillmayer/arithm"
+	"github.com/npillmayer/gorgo"
+	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
+	"github.com/npillmayer/pmmp/variables"
+)
+
+// evalAddto executes
+//
+//     ( addto ⟨variable⟩ also|contour|doublepath ⟨tertiary⟩ ⟨drawing option⟩ … )
+//
+// The picture variable is set to its picture with the new components added.
+func evalAddto(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	ev := th.intp.evaluator
+	l := e.AsList()
+	vref, pic, err := th.pictureVariable("addto", l.Cdar())
+	if err != nil {
+		return th.error(err)
+	}
+	mode, ok := l.Cddar().Data.(gorgo.Token)
+	if !ok {
+		return th.error(fmt.Errorf("addto without also, contour or doublepath: %v", l.Cddar()))
+	}
+	arg, err := th.value(l.Cddr().Cdar())
+	if err != nil {
+		return th.error(err)
+	}
+	opts, err := th.options(l.Cddr().Cddr(), drawingOptions{})
+	if err == nil {
+		pic, err = ev.addTo(pic, mode.Lexeme(), arg, opts)
+	}
+	if err == nil {
+		err = ev.Assign(vref, pic)
+	}
+	if err != nil {
+		return th.error(err)
+	}
+	return terex.Elem(nil)
+}
+
+// evalDraw executes the drawing commands of plain MetaPost
+//
+//     ( draw|fill|filldraw|… ⟨path expression⟩ ⟨drawing option⟩ … )
+//
+// which add to currentpicture. Paths are stroked with the current pen and
+// contours are filled; draw adds pictures as a whole. The un-commands paint
+// in the color background, unless another color is given. Arrows are drawn
+// with arrowheads of size ahlength and ahangle, filled and stroked with the
+// pen of the arrow.
+func evalDraw(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	ev := th.intp.evaluator
+	l := e.AsList()
+	cmd := operatorName(l.Car)
+	vref := ev.findVariable("currentpicture", nil)
+	pic, err := ev.pictureOf(cmd, vref)
+	if err != nil {
+		return th.error(err)
+	}
+	arg, err := th.value(l.Cdar())
+	if err != nil {
+		return th.error(err)
+	}
+	var opts drawingOptions
+	switch cmd {
+	case "undraw", "unfill", "unfilldraw":
+		if bg := ev.valueOf(ev.findVariable("background", nil)); bg.IsKnown() && bg.Self().IsColor() {
+			c := bg.Self().AsColor()
+			opts.color = &c
+		}
+	case "cutdraw":
+		butt := pmmp.ButtCap
+		opts.cap = &butt
+	}
+	if opts, err = th.options(l.Cddr(), opts); err != nil {
+		return th.error(err)
+	}
+	pen := ev.CurrentStroke().Pen
+	if opts.pen != nil {
+		pen = *opts.pen
+	}
+	switch cmd {
+	case "draw", "undraw", "cutdraw":
+		if arg.Self().IsPicture() {
+			pic, err = ev.addTo(pic, "also", arg, opts)
+		} else {
+			pic, err = ev.addTo(pic, "doublepath", arg, opts)
+		}
+	case "fill", "unfill":
+		pic, err = ev.addTo(pic, "contour", arg, opts)
+	case "filldraw", "unfilldraw":
+		opts.pen = &pen
+		pic, err = ev.addTo(pic, "contour", arg, opts)
+	case "drawarrow", "drawdblarrow":
+		var p pmmp.Path
+		if p, err = pathValue(arg); err != nil {
+			return th.error(fmt.Errorf("%s: %v", cmd, err))
+		}
+		pic, err = ev.addTo(pic, "doublepath", p, opts)
+		ahlength, ahangle := ev.internal("ahlength", ev.Length(4)), ev.internal("ahangle", 45)
+		heads := []pmmp.Path{p.Arrowhead(ahlength, ahangle)}
+		if cmd == "drawdblarrow" {
+			heads = append(heads, p.Reverse().Arrowhead(ahlength, ahangle))
+		}
+		opts.pen = &pen
+		for _, head := range heads {
+			if err == nil {
+				pic, err = ev.addTo(pic, "contour", head, opts)
+			}
+		}
+	default:
+		err = fmt.Errorf("drawing command %s not known", cmd)
+	}
+	if err == nil {
+		err = ev.Assign(vref, pic)
+	}
+	if err != nil {
+		return th.error(err)
+	}
+	return terex.Elem(nil)
+}
+
+// addTo adds a picture, a contour or a path to be stroked to a picture, as
+// MetaPost's addto with mode also, contour or doublepath does. Components
+// are black, unless a color is given. Contours are stroked only if a pen is
+// given. Paths are stroked with the current pen, unless another pen is
+// given, and are dashed if a dash pattern is given.
+func (ev *Evaluator) addTo(pic pmmp.Picture, mode string, arg pmmp.Value, opts drawingOptions) (
+	pmmp.Picture, error) {
+	//
+	color := pmmp.Greyscale(pmmp.FromFloat(0))
+	if opts.color != nil {
+		color = *opts.color
+	}
+	if mode == "also" {
+		if !arg.Self().IsPicture() {
+			return pmmp.Picture{}, fmt.Errorf("addto also needs a picture, have %v", arg.Type())
+		}
+		q := arg.Self().AsPicture()
+		if opts.color != nil || opts.pen != nil || opts.dash != nil {
+			q = q.Restyled(opts.color, opts.pen, opts.dash)
+		}
+		return pic.Also(q)
+	}
+	p, err := pathValue(arg)
+	if err != nil {
+		return pmmp.Picture{}, fmt.Errorf("addto %s: %v", mode, err)
+	}
+	stroke := ev.CurrentStroke()
+	if opts.pen != nil {
+		stroke.Pen = *opts.pen
+	}
+	if opts.cap != nil {
+		stroke.Cap = *opts.cap
+	}
+	switch mode {
+	case "doublepath":
+		if opts.dash != nil {
+			stroke.Dash = *opts.dash
+		}
+		return pic.AddDoublePath(p, color, stroke)
+	case "contour":
+		if opts.pen == nil {
+			return pic.AddContour(p, color, nil)
+		}
+		return pic.AddContour(p, color, &stroke)
+	}
+	return pmmp.Picture{}, fmt.Errorf("addto %s not known", mode)
+}
+
+// evalBounds executes
+//
+//     ( clip|setbounds ⟨variable⟩ ⟨path expression⟩ )
+//
+func evalBounds(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	l := e.AsList()
+	cmd := operatorName(l.Car)
+	vref, pic, err := th.pictureVariable(cmd, l.Cdar())
+	if err != nil {
+		return th.error(err)
+	}
+	arg, err := th.value(l.Cddar())
+	if err != nil {
+		return th.error(err)
+	}
+	p, err := pathValue(arg)
+	if err != nil {
+		return th.error(fmt.Errorf("%s: %v", cmd, err))
+	}
+	if cmd == "clip" {
+		pic, err = pic.Clipped(p)
+	} else {
+		pic, err = pic.Bounded(p)
+	}
+	if err == nil {
+		err = th.intp.evaluator.Assign(vref, pic)
+	}
+	if err != nil {
+		return th.error(err)
+	}
+	return terex.Elem(nil)
+}
+
+// evalDashPattern evaluates
+//
+//     ( #dashpattern on|off ⟨secondary⟩ … )
+//
+// to the picture of a dash pattern, as plain MetaPost's dashpattern does.
+func evalDashPattern(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	var segments []pmmp.DashSegment
+	on := false
+	for l := e.AsList().Cdr; l != nil; l = l.Cdr {
+		if tok, ok := l.Car.Data.(gorgo.Token); ok && (tok.Lexeme() == "on" || tok.Lexeme() == "off") {
+			on = tok.Lexeme() == "on"
+			continue
+		}
+		v, err := th.value(l.Car)
+		if err != nil {
+			return th.error(err)
+		}
+		if !v.IsKnown() || !v.Self().IsNumeric() {
+			return th.error(fmt.Errorf("dashpattern needs known numeric lengths, have %v", v.Self()))
+		}
+		segments = append(segments, pmmp.DashSegment{On: on, Length: v.Self().AsNumeric().AsFloat()})
+	}
+	return terex.Elem(pmmp.DashPattern(segments...))
+}
+
+// pictureVariable finds the variable a picture command operates on, which
+// has to be a picture variable with a known value.
+func (th *Thread) pictureVariable(cmd string, a terex.Atom) (*variables.VarRef, pmmp.Picture, error) {
+	node, ok := a.Data.(*terex.GCons)
+	if !ok {
+		return nil, pmmp.Picture{}, fmt.Errorf("%s needs a picture variable, have %v", cmd, a)
+	}
+	vref, err := th.variable(node)
+	if err != nil {
+		return nil, pmmp.Picture{}, err
+	}
+	pic, err := th.intp.evaluator.pictureOf(cmd, vref)
+	return vref, pic, err
+}
+
+// pictureOf returns the value of a picture variable, which has to be known.
+func (ev *Evaluator) pictureOf(cmd string, vref *variables.VarRef) (pmmp.Picture, error) {
+	v := ev.valueOf(vref)
+	if !v.IsKnown() || !v.Self().IsPicture() {
+		return pmmp.Picture{}, fmt.Errorf("%s needs a known picture variable, have %s = %v",
+			cmd, vref.FullName(), v.Self())
+	}
+	return v.Self().AsPicture(), nil
+}
+
+// drawingOptions holds the values of the drawing options of a command.
+// Options not given are nil.
+type drawingOptions struct {
+	color *pmmp.Color
+	pen   *pmmp.Pen
+	dash  *pmmp.Dash
+	cap   *pmmp.LineCap // set by cutdraw only
+}
+
+// options evaluates a list of drawing options, given as
+//
+//     ( withcolor ⟨tertiary⟩ ) ( withpen ⟨tertiary⟩ ) ( dashed ⟨tertiary⟩ ) …
+//
+// If an option is given more than once, the last one wins. The picture of a
+// dashed option is converted to a dash pattern.
+func (th *Thread) options(l *terex.GCons, opts drawingOptions) (drawingOptions, error) {
+	for ; l != nil; l = l.Cdr {
+		node, ok := l.Car.Data.(*terex.GCons)
+		if !ok || node == nil {
+			continue
+		}
+		if node.Car.Type() != terex.OperatorType { // nested list of options
+			var err error
+			if opts, err = th.options(node, opts); err != nil {
+				return opts, err
+			}
+			continue
+		}
+		v, err := th.value(l.Car)
+		if err != nil {
+			return opts, err
+		}
+		switch {
+		case v.Self().IsColor():
+			c := v.Self().AsColor()
+			opts.color = &c
+		case v.Self().IsPen():
+			pen := v.Self().AsPen()
+			opts.pen = &pen
+		case v.Self().IsPicture():
+			dash, err := v.Self().AsPicture().Dash()
+			if err != nil {
+				return opts, err
+			}
+			opts.dash = &dash
+		default:
+			return opts, fmt.Errorf("drawing option %s not yet implemented", operatorName(node.Car))
+		}
+	}
+	return opts, nil
+}
+
+// pathValue converts a value to a path. A known pair is a path consisting of
+// a single knot.
+func pathValue(v pmmp.Value) (pmmp.Path, error) {
+	if v.IsKnown() && v.Self().IsPair() {
+		return pmmp.NewPath([]arithm.Pair{v.Self().AsPair().AsPair()}, nil, false)
+	}
+	if !v.IsKnown() || !v.Self().IsPath() {
+		return pmmp.Path{}, fmt.Errorf("need a known path, have %v", v.Self())
+	}
+	return v.Self().AsPath(), nil
+}
@@ -0,0 +1,62 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
+)
+
+// evalPredicate evaluates
+//
+//     ( known|unknown|cycle|⟨type⟩ ⟨primary⟩ )
+//
+// to a boolean. known and unknown test if the primary has a known value,
+// the type names (numeric, pair, path, …) test its type, and cycle tests if
+// it is a known cyclic path. Variables are tested by their declared type
+// and by their current value, which is known if the LEQ solver has solved
+// it or it has been assigned to. Other expressions are tested by the type
+// of their value and by it being constant.
+func evalPredicate(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	l := e.AsList()
+	op := operatorName(l.Car)
+	if l.Length() != 2 {
+		return th.error(fmt.Errorf("%s needs a single argument", op))
+	}
+	typ, known, v, err := th.inspect(l.Cdar())
+	if err != nil {
+		return th.error(err)
+	}
+	var b bool
+	switch op {
+	case "known":
+		b = known
+	case "unknown":
+		b = !known
+	case "cycle":
+		b = known && typ == pmmp.PathType && v.Self().AsPath().IsCycle()
+	default:
+		b = typ == pmmp.TypeFromString(op)
+	}
+	return terex.Elem(pmmp.NewBoolean(b))
+}
+
+// inspect evaluates an AST fragment and returns the type of the result and
+// if it is known, together with its value. For variables the declared type
+// and the variable's knowledge about its value are returned.
+func (th *Thread) inspect(a terex.Atom) (pmmp.ValueType, bool, pmmp.Value, error) {
+	if node, ok := a.Data.(*terex.GCons); ok && node != nil && node.Car.Type() == terex.OperatorType &&
+		operatorName(node.Car) == "variable" {
+		vref, err := th.variable(node)
+		if err != nil {
+			return pmmp.Undefined, false, nil, err
+		}
+		return vref.Type(), vref.HasKnownValue(), th.intp.evaluator.valueOf(vref), nil
+	}
+	v, err := th.value(a)
+	if err != nil {
+		return pmmp.Undefined, false, nil, err
+	}
+	return v.Type(), v.IsKnown(), v, nil
+}
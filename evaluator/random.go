@@ -0,0 +1,42 @@
+package evaluator
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/npillmayer/pmmp"
+)
+
+// seedRandom sets up the generator for random numbers every evaluator owns.
+// Its seed is taken from configuration key "seed", if set to a value other
+// than 0, which makes runs reproducible. Otherwise it is seeded from the time
+// of day, as MetaPost does.
+func (ev *Evaluator) seedRandom() {
+	var seed int64
+	if pmmp.Configuration != nil {
+		seed = pmmp.Configuration.Int64("seed")
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	ev.random = rand.New(rand.NewSource(seed))
+}
+
+// SetRandomSeed is MetaPost's randomseed := x. Fractional parts of the seed
+// are significant down to 1/65536.
+func (ev *Evaluator) SetRandomSeed(x float64) {
+	ev.random.Seed(int64(math.Round(x * 65536)))
+}
+
+// UniformDeviate is MetaPost's uniformdeviate x: a random number between 0
+// and x.
+func (ev *Evaluator) UniformDeviate(x float64) float64 {
+	return ev.random.Float64() * x
+}
+
+// NormalDeviate is MetaPost's normaldeviate: a random number with a normal
+// distribution of mean 0 and standard deviation 1.
+func (ev *Evaluator) NormalDeviate() float64 {
+	return ev.random.NormFloat64()
+}
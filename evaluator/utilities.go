@@ -1,19 +1,40 @@
 package evaluator
 
+import "sort"
+
+// units holds the units of length known to MetaPost, in PostScript points
+// (bp).
+var units = map[string]float64{
+	"bp": 1,
+	"pt": 72 / 72.27,
+	"mm": 72 / 25.4,
+	"cm": 72 / 2.54,
+	"in": 72,
+	"pc": 12 * 72 / 72.27,
+	"dd": 1238.0 / 1157 * 72 / 72.27,
+	"cc": 12 * 1238.0 / 1157 * 72 / 72.27,
+}
+
 // Unit2numeric converts a unit of length (cm, mm, pt, in, …)
-// to internal scaled points.
-//
-// TODO complete this.
-func Unit2numeric(u string) float64 {
-	switch u {
-	case "in":
-		return 0.01388888
-	}
-	return 1.0
+// to PostScript points (bp). It returns false for unknown units.
+func Unit2numeric(u string) (float64, bool) {
+	size, ok := units[u]
+	return size, ok
 }
 
-// ScaleDimension scales a numeric value by a unit.
-func ScaleDimension(dimen float64, unit string) float64 {
-	u := Unit2numeric(unit)
-	return dimen * u
+// ScaleDimension scales a numeric value by a unit, resulting in a length
+// in bp. It returns false for unknown units.
+func ScaleDimension(dimen float64, unit string) (float64, bool) {
+	u, ok := Unit2numeric(unit)
+	return dimen * u, ok
+}
+
+// Units returns the names of the units of length, sorted by name.
+func Units() []string {
+	names := make([]string, 0, len(units))
+	for u := range units {
+		names = append(names, u)
+	}
+	sort.Strings(names)
+	return names
 }
@@ -0,0 +1,516 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/npillmayer/arithm"
+	"github.com/npillmayer/arithm/polyn"
+	"github.com/npillmayer/gorgo"
+	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
+	"github.com/npillmayer/pmmp/variables"
+)
+
+// varSuffix is a part of a variable reference following the base tag,
+// i.e. either a tag suffix or a subscript.
+type varSuffix struct {
+	tag         string
+	subscript   float64
+	isSubscript bool
+}
+
+// evalVariable evaluates
+//
+//     ( #variable ⟨suffix⟩ … )
+//
+// to the value of the variable referenced.
+func evalVariable(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	vref, err := th.variable(e.AsList())
+	if err != nil {
+		return th.error(err)
+	}
+	return terex.Elem(th.intp.evaluator.valueOf(vref))
+}
+
+// evalStr evaluates
+//
+//     ( #str ( #variable ⟨suffix⟩ … ) )
+//
+// to a string value of the name of the variable, e.g. "x.r1". Subscripts
+// are written in brackets, unless they are non-negative integers following
+// a tag.
+func evalStr(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	node, _ := e.AsList().Cdar().Data.(*terex.GCons)
+	if node == nil {
+		return th.error(fmt.Errorf("str needs a suffix"))
+	}
+	suffixes, err := th.collectSuffixes(node.Cdr, nil)
+	if err != nil {
+		return th.error(err)
+	}
+	var b strings.Builder
+	for i, s := range suffixes {
+		switch {
+		case !s.isSubscript:
+			if i > 0 && !suffixes[i-1].isSubscript {
+				b.WriteByte('.')
+			}
+			b.WriteString(s.tag)
+		case i > 0 && !suffixes[i-1].isSubscript && s.subscript >= 0 && s.subscript == math.Trunc(s.subscript):
+			b.WriteString(fmt.Sprintf("%g", s.subscript))
+		default:
+			b.WriteString(fmt.Sprintf("[%g]", s.subscript))
+		}
+	}
+	return terex.Elem(pmmp.NewString(b.String()))
+}
+
+// evalEquation executes
+//
+//     ( #equation ⟨tertiary⟩ ⟨tertiary⟩ )
+//
+func evalEquation(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	l := e.AsList()
+	lhs, err := th.value(l.Cdar())
+	if err != nil {
+		return th.error(err)
+	}
+	rhs, err := th.value(l.Cddar())
+	if err != nil {
+		return th.error(err)
+	}
+	if isNonnumeric(lhs) || isNonnumeric(rhs) {
+		err = th.nonnumericEquation(l.Cdar(), l.Cddar(), lhs, rhs)
+	} else {
+		err = th.intp.evaluator.Equation(lhs, rhs)
+	}
+	if err != nil {
+		return th.error(err)
+	}
+	return terex.Elem(nil)
+}
+
+// isNonnumeric is a predicate: is v a boolean, a string, a path, a pen or a
+// picture? Equations between these are not handled by the LEQ solver.
+func isNonnumeric(v pmmp.Value) bool {
+	switch v.Type() {
+	case pmmp.BooleanType, pmmp.StringType, pmmp.PathType, pmmp.PenType, pmmp.PictureType:
+		return true
+	}
+	return false
+}
+
+// nonnumericEquation solves an equation between booleans, strings, paths,
+// pens or pictures, following MetaPost's rules: an unknown variable equated
+// to a known value takes this value, together with all the variables it has
+// been equated to before. Equations between two unknown variables link them,
+// and equations between two known values have to be consistent. A known pair
+// equated to a path is treated as a path consisting of a single knot.
+func (th *Thread) nonnumericEquation(left, right terex.Atom, lhs, rhs pmmp.Value) error {
+	lhs, rhs = pairAsPath(lhs, rhs), pairAsPath(rhs, lhs)
+	if lhs.Type() != rhs.Type() {
+		return fmt.Errorf("equation between %v and %v", lhs.Type(), rhs.Type())
+	}
+	switch {
+	case lhs.IsKnown() && rhs.IsKnown():
+		eq, err := lhs.Self().Equals(rhs)
+		if err != nil {
+			return err
+		}
+		if !eq {
+			return fmt.Errorf("inconsistent equation: %v = %v", lhs.Self(), rhs.Self())
+		}
+		return nil
+	case lhs.IsKnown():
+		left, rhs = right, lhs
+	case !rhs.IsKnown():
+		v, err := th.unknownVariable(left, lhs.Type())
+		if err != nil {
+			return err
+		}
+		w, err := th.unknownVariable(right, rhs.Type())
+		if err != nil {
+			return err
+		}
+		th.intp.evaluator.Link(v, w)
+		return nil
+	}
+	vref, err := th.unknownVariable(left, rhs.Type())
+	if err != nil {
+		return err
+	}
+	th.intp.evaluator.SetLinked(vref, rhs)
+	return nil
+}
+
+// pairAsPath converts a known pair v to a path of a single knot, if it is
+// equated to a path w. Other values are returned unchanged.
+func pairAsPath(v, w pmmp.Value) pmmp.Value {
+	if w.Type() != pmmp.PathType || v.Type() != pmmp.PairType || !v.IsKnown() {
+		return v
+	}
+	p, err := pmmp.NewPath([]arithm.Pair{v.Self().AsPair().AsPair()}, nil, false)
+	if err != nil {
+		return v
+	}
+	return p
+}
+
+// unknownVariable returns the variable of an unknown side of a non-numeric
+// equation. Unknown expressions other than variables cannot be solved.
+func (th *Thread) unknownVariable(a terex.Atom, typ pmmp.ValueType) (*variables.VarRef, error) {
+	node, _ := a.Data.(*terex.GCons)
+	if node == nil || node.Car.Type() != terex.OperatorType || operatorName(node.Car) != "variable" {
+		return nil, fmt.Errorf("unknown %v is not a variable: %v", typ, a)
+	}
+	return th.variable(node)
+}
+
+// evalAssignment executes
+//
+//     ( #assignment ⟨variable⟩ ⟨tertiary⟩ )
+//
+func evalAssignment(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	l := e.AsList()
+	rhs, err := th.value(l.Cddar())
+	if err != nil {
+		return th.error(err)
+	}
+	lhs, ok := l.Cdar().Data.(*terex.GCons)
+	if !ok {
+		return th.error(fmt.Errorf("left side of assignment is not a variable: %v", l.Cdar()))
+	}
+	vref, err := th.variable(lhs)
+	if err != nil {
+		return th.error(err)
+	}
+	if err = th.intp.evaluator.Assign(vref, rhs); err != nil {
+		return th.error(err)
+	}
+	return terex.Elem(nil)
+}
+
+// evalDeclaration executes
+//
+//     ( #vardecl Type ( #generic_variable ⟨suffix⟩ … ) … )
+//
+// Re-declaring a tag erases all of its variables.
+func evalDeclaration(e terex.Element, env *terex.Environment) terex.Element {
+	th := GetThread(env)
+	l := e.AsList()
+	tok, ok := l.Cdar().Data.(gorgo.Token)
+	if !ok {
+		return th.error(fmt.Errorf("declaration without a type: %v", l.Cdar()))
+	}
+	typ := pmmp.TypeFromString(tok.Lexeme())
+	if typ == pmmp.Undefined {
+		return th.error(fmt.Errorf("declaration of type %s not yet implemented", tok.Lexeme()))
+	}
+	for _, tags := range genericVariables(l.Cddr(), nil) {
+		if len(tags) == 0 || tags[0] == "[]" {
+			return th.error(fmt.Errorf("declared variable does not start with a tag"))
+		}
+		decl := variables.NewVarDecl(tags[0], typ)
+		sfx := decl.AsSuffix()
+		for _, t := range tags[1:] {
+			if t == "[]" {
+				sfx = variables.CreateSuffix("<[]>", pmmp.SubscriptType, sfx)
+			} else {
+				sfx = variables.CreateSuffix(t, pmmp.SuffixType, sfx)
+			}
+		}
+		th.intp.evaluator.Declare(decl)
+	}
+	return terex.Elem(nil)
+}
+
+// genericVariables collects the tags of the generic variables of a
+// declaration, with "[]" for array suffixes, e.g. x[]r ⇒ "x", "[]", "r".
+func genericVariables(l *terex.GCons, vars [][]string) [][]string {
+	for ; l != nil; l = l.Cdr {
+		sub, ok := l.Car.Data.(*terex.GCons)
+		if !ok {
+			continue
+		}
+		if sub.Car.Type() == terex.OperatorType && operatorName(sub.Car) == "generic_variable" {
+			vars = append(vars, genericSuffixes(sub.Cdr, nil))
+		} else {
+			vars = genericVariables(sub, vars)
+		}
+	}
+	return vars
+}
+
+func genericSuffixes(l *terex.GCons, tags []string) []string {
+	for ; l != nil; l = l.Cdr {
+		switch a := l.Car; a.Type() {
+		case terex.StringType: // ( #suffix "r" )
+			tags = append(tags, a.Data.(string))
+		case terex.OperatorType: // ( #suffix #[] )
+			if operatorName(a) == "[]" {
+				tags = append(tags, "[]")
+			}
+		case terex.ConsType:
+			tags = genericSuffixes(a.Data.(*terex.GCons), tags)
+		}
+	}
+	return tags
+}
+
+// value evaluates an AST fragment, which is expected to result in a value.
+func (th *Thread) value(a terex.Atom) (pmmp.Value, error) {
+	e := th.FetchDecodeExecute(terex.Elem(a))
+	if e.Type() == terex.ErrorType {
+		return nil, fmt.Errorf("%v", e.AsAtom().Data)
+	}
+	if v, ok := e.AsAtom().Data.(pmmp.Value); ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("expression does not evaluate to a value: %v", a)
+}
+
+// variable finds the variable reference for a #variable-node of the AST.
+func (th *Thread) variable(node *terex.GCons) (*variables.VarRef, error) {
+	if node == nil {
+		return nil, fmt.Errorf("not a variable")
+	}
+	suffixes, err := th.collectSuffixes(node.Cdr, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(suffixes) == 0 || suffixes[0].isSubscript {
+		return nil, fmt.Errorf("variable does not start with a tag: %v", terex.Elem(node))
+	}
+	return th.intp.evaluator.findVariable(suffixes[0].tag, suffixes[1:]), nil
+}
+
+// collectSuffixes walks the AST of a variable, collecting its tag suffixes
+// and subscripts. Subscripts may be expressions, which have to evaluate to
+// known numerics.
+func (th *Thread) collectSuffixes(l *terex.GCons, suffixes []varSuffix) ([]varSuffix, error) {
+	var err error
+	for ; l != nil; l = l.Cdr {
+		switch a := l.Car; a.Type() {
+		case terex.StringType: // ( #suffix "r" )
+			suffixes = th.appendTag(suffixes, a.Data.(string))
+		case terex.TokenType: // TAG tokens are duplicated by ( #suffix … ) nodes
+			if v, ok := a.Data.(gorgo.Token).Value().(float64); ok {
+				suffixes = append(suffixes, varSuffix{subscript: v, isSubscript: true})
+			}
+		case terex.ConsType:
+			sub := a.Data.(*terex.GCons)
+			if sub.Car.Type() == terex.OperatorType && operatorName(sub.Car) == "subscript" {
+				var x float64
+				if x, err = th.subscript(sub); err != nil {
+					return nil, err
+				}
+				suffixes = append(suffixes, varSuffix{subscript: x, isSubscript: true})
+			} else if suffixes, err = th.collectSuffixes(sub, suffixes); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return suffixes, nil
+}
+
+// appendTag appends a tag to a list of suffixes. If the tag is bound to a
+// suffix parameter, e.g. by forsuffixes, the bound suffixes are appended
+// instead.
+func (th *Thread) appendTag(suffixes []varSuffix, tag string) []varSuffix {
+	for i := len(th.suffixParams) - 1; i >= 0; i-- {
+		if th.suffixParams[i].tag == tag {
+			return append(suffixes, th.suffixParams[i].suffixes...)
+		}
+	}
+	return append(suffixes, varSuffix{tag: tag})
+}
+
+// subscript evaluates ( #subscript ⟨tertiary⟩ ) to a float.
+func (th *Thread) subscript(node *terex.GCons) (float64, error) {
+	v, err := th.value(node.Cdar())
+	if err != nil {
+		return 0, err
+	}
+	if !v.IsKnown() || !v.Self().IsNumeric() {
+		return 0, fmt.Errorf("subscript is not a known numeric: %v", v.Self())
+	}
+	return v.Self().AsNumeric().AsFloat(), nil
+}
+
+// findVariable returns the current incarnation of a variable, given by its
+// base tag and a list of suffixes, e.g. x[2].r ⇒ "x", [2], "r".
+//
+// Tags which have not been declared will be declared as numerics (MetaFont
+// semantics). The same holds for tags which have been saved in a group.
+// If the variable does not yet live in memory, it will be allocated.
+//
+func (ev *Evaluator) findVariable(base string, suffixes []varSuffix) *variables.VarRef {
+	sym, scope := ev.ScopeTree.Current().ResolveTag(base)
+	var decl *variables.VarDecl
+	if sym != nil {
+		decl, _ = sym.UData.(*variables.VarDecl)
+	}
+	if decl == nil { // undeclared or saved tag
+		decl = variables.NewVarDecl(base, pmmp.NumericType)
+		if sym == nil {
+			scope = ev.ScopeTree.Globals()
+		}
+		scope.Tags().InsertTag(decl.AsTag())
+		tracer().P("decl", base).Debugf("declared numeric in %s", scope.Name)
+	}
+	sfx := decl.AsSuffix()
+	var subscripts []float64
+	for _, s := range suffixes {
+		if s.isSubscript {
+			sfx = variables.CreateSuffix("<[]>", pmmp.SubscriptType, sfx)
+			subscripts = append(subscripts, s.subscript)
+		} else {
+			sfx = variables.CreateSuffix(s.tag, pmmp.SuffixType, sfx)
+		}
+	}
+	vref := variables.CreateVarRef(sfx, nil, subscripts)
+	vref, _ = ev.FindVariableReferenceInMemory(vref, true)
+	ev.registerVariable(vref)
+	return vref
+}
+
+// Link equates two unknown variables of a non-numeric type. Linked
+// variables stay unknown until one of them is set with SetLinked, then all
+// of them become known together. A variable which has been assigned to after
+// linking is a new incarnation and is no longer part of the link.
+func (ev *Evaluator) Link(v, w *variables.VarRef) {
+	r1, r2 := ev.linkRing(v), ev.linkRing(w)
+	if r1 == r2 {
+		return
+	}
+	for _, m := range r2.members {
+		r1.members = append(r1.members, m)
+		ev.links[m.id] = r1
+	}
+}
+
+// SetLinked sets the value of a variable, and of all the variables linked
+// to it.
+func (ev *Evaluator) SetLinked(vref *variables.VarRef, val pmmp.Value) {
+	vref.Set(val)
+	r, ok := ev.links[vref.ID()]
+	if !ok {
+		return
+	}
+	for _, m := range r.members {
+		delete(ev.links, m.id)
+		if m.vref.ID() == m.id { // still the incarnation which was linked
+			m.vref.Set(val)
+		}
+	}
+}
+
+// linkRing returns the ring of variables linked to a variable, creating a
+// ring for the variable alone if it is not linked yet.
+func (ev *Evaluator) linkRing(vref *variables.VarRef) *varRing {
+	if r, ok := ev.links[vref.ID()]; ok {
+		return r
+	}
+	r := &varRing{members: []linkedVar{{vref: vref, id: vref.ID()}}}
+	ev.links[vref.ID()] = r
+	return r
+}
+
+// varRing is a set of unknown variables which have been equated, see Link.
+type varRing struct {
+	members []linkedVar
+}
+
+// linkedVar is a member of a varRing: a variable in the incarnation which
+// has been linked.
+type linkedVar struct {
+	vref *variables.VarRef
+	id   int32
+}
+
+// registerVariable makes a variable known to the variable resolver, i.e.
+// the variable is no capsule. For pairs, both the x-part and the y-part
+// are registered.
+func (ev *Evaluator) registerVariable(vref *variables.VarRef) {
+	if parts := vref.Parts(); parts != nil { // pair, transform or color
+		for _, part := range parts {
+			ev.resolver[int(part.ID())] = part.AsTag()
+		}
+		return
+	}
+	ev.resolver[int(vref.ID())] = vref.AsTag()
+}
+
+// valueOf returns the value of a variable. Numeric variables and pair parts
+// without a known value are represented by a polynomial consisting of
+// the variable itself, as needed for linear equations. Variables of other
+// types without a value have the zero value of their type, which is unknown.
+func (ev *Evaluator) valueOf(vref *variables.VarRef) pmmp.Value {
+	switch vref.Type() {
+	case pmmp.NumericType:
+		return numericOrUnknown(vref.Value, vref.ID())
+	case pmmp.PairType:
+		x, y := vref.XPart(), vref.YPart()
+		return pmmp.NewPair(numericOrUnknown(x.Value, x.ID()), numericOrUnknown(y.Value, y.ID()))
+	case pmmp.TransformType:
+		var parts [6]pmmp.Numeric
+		for i, part := range vref.Parts() {
+			parts[i] = numericOrUnknown(part.Value, part.ID())
+		}
+		return pmmp.NewTransform(parts)
+	case pmmp.ColorType, pmmp.CMYKColorType:
+		parts := make([]pmmp.Numeric, 4)
+		for i, part := range vref.Parts() {
+			parts[i] = numericOrUnknown(part.Value, part.ID())
+		}
+		if vref.Type() == pmmp.CMYKColorType {
+			return pmmp.NewCMYKColor(parts[0], parts[1], parts[2], parts[3])
+		}
+		return pmmp.NewColor(parts[0], parts[1], parts[2])
+	case pmmp.PathType:
+		if vref.Value == nil {
+			return pmmp.Path{}
+		}
+	case pmmp.PenType:
+		if vref.Value == nil {
+			return pmmp.Pen{}
+		}
+	case pmmp.PictureType:
+		if vref.Value == nil {
+			return pmmp.Picture{}
+		}
+	case pmmp.BooleanType:
+		if vref.Value == nil {
+			return pmmp.Boolean{}
+		}
+	case pmmp.StringType:
+		if vref.Value == nil {
+			return pmmp.String{}
+		}
+	}
+	return vref.Get()
+}
+
+func numericOrUnknown(v pmmp.Value, id int32) pmmp.Numeric {
+	if v != nil && v.IsKnown() {
+		return v.Self().AsNumeric()
+	}
+	return pmmp.Numeric(polyn.NewConstantPolynomial(0).SetTerm(int(id), 1))
+}
+
+// ValueOf returns the current value of a variable, given by its base tag
+// and (optional) tag suffixes, e.g. "x", "r" for x.r. Unknown numerics
+// are represented by a polynomial consisting of the variable itself.
+func (ev *Evaluator) ValueOf(tag string, suffixes ...string) pmmp.Value {
+	sfx := make([]varSuffix, len(suffixes))
+	for i, s := range suffixes {
+		sfx[i] = varSuffix{tag: s}
+	}
+	return ev.valueOf(ev.findVariable(tag, sfx))
+}
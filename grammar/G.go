@@ -15,14 +15,16 @@ func createGrammarRules(b *lr.GrammarBuilder) {
 	b.LHS("statement").N("function_definition").End()
 	b.LHS("statement").N("if_statement").End()
 	b.LHS("statement").N("loop_statement").End()
+	b.LHS("statement").N("exit_statement").End()
+	b.LHS("statement").N("capsule").End()
 	b.LHS("if_statement").T(S("if")).N("boolean_expression").T(":", 58).N("statement_list").N("alternatives").T(S("fi")).End()
 	b.LHS("alternatives").Epsilon()
-	b.LHS("alternatives").T(S("else:")).N("statement_list").End()
+	b.LHS("alternatives").T(S("else")).T(":", 58).N("statement_list").End()
 	b.LHS("alternatives").T(S("elseif")).N("boolean_expression").T(":", 58).N("statement_list").N("alternatives").End()
-	b.LHS("loop").N("loop_header").T(":", 58).N("statement_list").T(S("endfor")).End()
-	b.LHS("loop_header").T(S("for")).N("symbolic_token").T("=", 61).N("progression").End()
-	b.LHS("loop_header").T(S("for")).N("symbolic_token").T("=", 61).N("for_list").End()
-	b.LHS("loop_header").T(S("forsuffixes")).N("symbolic_token").T("=", 61).N("suffix_list").End()
+	b.LHS("loop_statement").N("loop_header").T(":", 58).N("statement_list").T(S("endfor")).End()
+	b.LHS("loop_header").T(S("for")).T(S("TAG")).T("=", 61).N("progression").End()
+	b.LHS("loop_header").T(S("for")).T(S("TAG")).T("=", 61).N("for_list").End()
+	b.LHS("loop_header").T(S("forsuffixes")).T(S("TAG")).T("=", 61).N("suffix_list").End()
 	b.LHS("loop_header").T(S("forever")).End()
 	b.LHS("progression").N("tertiary").T(S("upto")).N("tertiary").End()
 	b.LHS("progression").N("tertiary").T(S("downto")).N("tertiary").End()
@@ -31,8 +33,14 @@ func createGrammarRules(b *lr.GrammarBuilder) {
 	b.LHS("for_list").N("for_list").T(",", 44).N("tertiary").End()
 	b.LHS("suffix_list").N("suffix").End()
 	b.LHS("suffix_list").N("suffix_list").T(",", 44).N("suffix").End()
+	b.LHS("exit_statement").T(S("exitif")).N("boolean_expression").End()
+	b.LHS("exit_statement").T(S("exitunless")).N("boolean_expression").End()
     // --- Expressions -----------------------------------------------------------
-	b.LHS("boolean_expression").N("tertiary").T(S("RelationOp")).N("tertiary").End()
+	b.LHS("boolean_expression").N("tertiary").End()
+	b.LHS("boolean_expression").N("relation").End()
+	b.LHS("boolean_expression").N("boolean_expression").T("=", 61).N("tertiary").End()
+	b.LHS("relation").N("tertiary").T(S("RelationOp")).N("tertiary").End()
+	b.LHS("relation").N("relation").T(S("RelationOp")).N("tertiary").End()
 	b.LHS("tertiary_list").N("tertiary").End()
 	b.LHS("tertiary_list").N("tertiary_list").T(",", 44).N("tertiary").End()
 	b.LHS("tertiary").N("secondary").End()
@@ -40,10 +48,15 @@ func createGrammarRules(b *lr.GrammarBuilder) {
 	b.LHS("tertiary").N("tertiary").T(S("PlusOrMinus")).N("secondary").End()
 	b.LHS("secondary").N("primary").End()
 	b.LHS("secondary").N("secondary").T(S("PrimaryOp")).N("primary").End()
+	b.LHS("secondary").N("secondary").T(S("and")).N("primary").End()
 	b.LHS("secondary").N("secondary").N("transformer").End()
 	b.LHS("primary").N("atom").End()
 	b.LHS("primary").T("(", 40).N("tertiary").T(",", 44).N("tertiary").T(")", 41).End()
+	b.LHS("primary").T("(", 40).N("tertiary").T(",", 44).N("tertiary").T(",", 44).N("tertiary").T(")", 41).End()
+	b.LHS("primary").T("(", 40).N("tertiary").T(",", 44).N("tertiary").T(",", 44).N("tertiary").T(",", 44).N("tertiary").T(")", 41).End()
 	b.LHS("primary").T(S("UnaryOp")).N("primary").End()
+	b.LHS("primary").T(S("Type")).N("primary").End()
+	b.LHS("primary").T(S("cycle")).N("atom").End()
 	b.LHS("primary").T(S("PlusOrMinus")).N("primary").End()
 	b.LHS("primary").T(S("OfOp")).N("tertiary").T(S("of")).N("primary").End()
 	b.LHS("primary").N("atom").T("[", 91).N("tertiary").T(",", 44).N("tertiary").T("]", 93).End()
@@ -51,15 +64,26 @@ func createGrammarRules(b *lr.GrammarBuilder) {
 	b.LHS("atom").N("variable").End()
 	b.LHS("atom").T(S("Unsigned")).N("variable").End()
 	b.LHS("atom").T(S("Unsigned")).End()
+	b.LHS("atom").T(S("STRING")).End()
 	b.LHS("atom").T(S("NullaryOp")).End()
+	b.LHS("atom").T(S("str")).N("variable").End()
 	b.LHS("atom").T(S("begingroup")).N("statement_list").N("tertiary").T(S("endgroup")).End()
 	b.LHS("atom").N("function_call").End()
-	b.LHS("atom").T("(", 40).N("tertiary").T(")", 41).End()
+	b.LHS("atom").T("(", 40).N("boolean_expression").T(")", 41).End()
+	b.LHS("atom").T("(", 40).N("path_expression").N("path_join").N("path_knot").T(")", 41).End()
+	b.LHS("atom").T(S("dashpattern")).T("(", 40).N("dash_list").T(")", 41).End()
+	b.LHS("atom").T(S("thelabel")).T("(", 40).N("tertiary").T(",", 44).N("tertiary").T(")", 41).End()
+	b.LHS("atom").T(S("thelabel")).T(S("TAG")).T("(", 40).N("tertiary").T(",", 44).N("tertiary").T(")", 41).End()
+	b.LHS("atom").N("capsule").End()
+	b.LHS("capsule").T(S("Capsule")).N("atom").End()
+	b.LHS("dash_list").Epsilon()
+	b.LHS("dash_list").N("dash_list").T(S("on")).N("secondary").End()
+	b.LHS("dash_list").N("dash_list").T(S("off")).N("secondary").End()
 	b.LHS("transformer").T(S("UnaryTransform")).N("primary").End()
 	b.LHS("transformer").T(S("BinaryTransform")).T("(", 40).N("tertiary").T(",", 44).N("tertiary").T(")", 41).End()
 	b.LHS("conditional_primary").T(S("if")).N("boolean_expression").T(":", 58).N("primary").N("primary_alternatives").T(S("fi")).End()
 	b.LHS("primary_alternatives").Epsilon()
-	b.LHS("primary_alternatives").T(S("else:")).N("primary").End()
+	b.LHS("primary_alternatives").T(S("else")).T(":", 58).N("primary").End()
 	b.LHS("primary_alternatives").T(S("elseif")).N("boolean_expression").T(":", 58).N("primary").N("primary_alternatives").End()
     // --- Paths -----------------------------------------------------------------
 	b.LHS("path_expression").N("tertiary").End()
@@ -67,6 +91,11 @@ func createGrammarRules(b *lr.GrammarBuilder) {
 	b.LHS("path_expression").N("path_expression").N("conditional_path_segment").End()
 	b.LHS("path_expression").N("path_expression").N("segment_loop").End()
 	b.LHS("path_knot").N("tertiary").End()
+	b.LHS("path_knot").T(S("cycle")).End()
+	b.LHS("path_segment").Epsilon()
+	b.LHS("path_segment").N("path_segment").N("path_join").N("path_knot").End()
+	b.LHS("path_segment").N("path_segment").N("conditional_path_segment").End()
+	b.LHS("path_segment").N("path_segment").N("segment_loop").End()
 	b.LHS("path_join").T(S("--")).End()
 	b.LHS("path_join").N("direction_specifier").N("basic_path_join").N("direction_specifier").End()
 	b.LHS("direction_specifier").Epsilon()
@@ -81,11 +110,11 @@ func createGrammarRules(b *lr.GrammarBuilder) {
 	b.LHS("tension").T(S("tension")).N("primary").T(S("and")).N("primary").End()
 	b.LHS("controls").T(S("controls")).N("primary").End()
 	b.LHS("controls").T(S("controls")).N("primary").T(S("and")).N("primary").End()
-	b.LHS("conditional_path_segment").T(S("if")).N("boolean_expression").T(":", 58).N("path_expression").N("segment_alternatives").T(S("fi")).End()
+	b.LHS("conditional_path_segment").T(S("if")).N("boolean_expression").T(":", 58).N("path_segment").N("segment_alternatives").T(S("fi")).End()
 	b.LHS("segment_alternatives").Epsilon()
-	b.LHS("segment_alternatives").T(S("else:")).N("path_expression").End()
-	b.LHS("segment_alternatives").T(S("elseif")).N("boolean_expression").T(":", 58).N("path_expression").N("segment_alternatives").End()
-	b.LHS("segment_loop").N("loop_header").T(":", 58).N("path_expression").T(S("endfor")).End()
+	b.LHS("segment_alternatives").T(S("else")).T(":", 58).N("path_segment").End()
+	b.LHS("segment_alternatives").T(S("elseif")).N("boolean_expression").T(":", 58).N("path_segment").N("segment_alternatives").End()
+	b.LHS("segment_loop").N("loop_header").T(":", 58).N("path_segment").T(S("endfor")).End()
     // --- Function calls --------------------------------------------------------
 	b.LHS("function_call").T(S("Function")).T("(", 40).N("tertiary_list").T(")", 41).End()
 	b.LHS("variable").T(S("TAG")).N("suffix").End()
@@ -97,7 +126,8 @@ func createGrammarRules(b *lr.GrammarBuilder) {
     // --- Equations -------------------------------------------------------------
 	b.LHS("equation").N("tertiary").T("=", 61).N("right_hand_side").End()
 	b.LHS("assignment").N("variable").T(S(":=")).N("right_hand_side").End()
-	b.LHS("right_hand_side").N("tertiary").End()
+	b.LHS("right_hand_side").N("path_expression").End()
+	b.LHS("right_hand_side").N("relation").End()
 	b.LHS("right_hand_side").N("equation").End()
 	b.LHS("right_hand_side").N("assignment").End()
     // --- Declarations ----------------------------------------------------------
@@ -109,9 +139,13 @@ func createGrammarRules(b *lr.GrammarBuilder) {
 	b.LHS("generic_suffix").N("generic_suffix").T(S("TAG")).End()
 	b.LHS("generic_suffix").N("generic_suffix").T(S("[]")).End()
     // --- Commands --------------------------------------------------------------
-	b.LHS("command").T(S("pickup")).N("primary").End()
+	b.LHS("command").T(S("pickup")).N("secondary").End()
 	b.LHS("command").T(S("save")).N("symbolic_token_list").End()
+	b.LHS("command").T(S("randomseed")).T(S(":=")).N("tertiary").End()
 	b.LHS("command").N("drawing_command").End()
+	b.LHS("command").N("addto_command").End()
+	b.LHS("command").N("bounds_command").End()
+	b.LHS("command").N("label_command").End()
 	b.LHS("command").N("show_command").End()
 	b.LHS("show_command").T(S("show")).N("tertiary").End()
 	b.LHS("symbolic_token_list").T(S("TAG")).End()
@@ -119,6 +153,15 @@ func createGrammarRules(b *lr.GrammarBuilder) {
 	b.LHS("symbolic_token_list").T(S("TAG")).T(",", 44).N("symbolic_token_list").End()
 	b.LHS("symbolic_token_list").T(S("SymTok")).T(",", 44).N("symbolic_token_list").End()
 	b.LHS("drawing_command").T(S("DrawCmd")).N("path_expression").N("option_list").End()
+	b.LHS("addto_command").T(S("addto")).N("variable").T(S("also")).N("tertiary").N("option_list").End()
+	b.LHS("addto_command").T(S("addto")).N("variable").T(S("contour")).N("path_expression").N("option_list").End()
+	b.LHS("addto_command").T(S("addto")).N("variable").T(S("doublepath")).N("path_expression").N("option_list").End()
+	b.LHS("bounds_command").T(S("clip")).N("variable").T(S("to")).N("path_expression").End()
+	b.LHS("bounds_command").T(S("setbounds")).N("variable").T(S("to")).N("path_expression").End()
+	b.LHS("label_command").T(S("label")).T("(", 40).N("tertiary").T(",", 44).N("tertiary").T(")", 41).N("option_list").End()
+	b.LHS("label_command").T(S("label")).T(S("TAG")).T("(", 40).N("tertiary").T(",", 44).N("tertiary").T(")", 41).N("option_list").End()
+	b.LHS("label_command").T(S("dotlabel")).T("(", 40).N("tertiary").T(",", 44).N("tertiary").T(")", 41).N("option_list").End()
+	b.LHS("label_command").T(S("dotlabel")).T(S("TAG")).T("(", 40).N("tertiary").T(",", 44).N("tertiary").T(")", 41).N("option_list").End()
 	b.LHS("option_list").Epsilon()
 	b.LHS("option_list").N("drawing_option").N("option_list").End()
 	b.LHS("drawing_option").T(S("DrawOption")).N("tertiary").End()
@@ -62,6 +62,7 @@ var primaryOp *mpTermR      // for primary -> … productions
 var secondaryOp *mpTermR    // for secondary -> … productions
 var tertiaryOp *mpTermR     // for tertiary -> … productions
 var exprOp *mpTermR         // for expression -> … productions
+var relationOp *mpTermR     // for relation -> … productions
 var declOp *mpTermR         // for declaration -> … productions
 var declvarOp *mpTermR      // for generic_variable -> … productions
 var declsuffixOp *mpTermR   // for generic_suffix -> … productions
@@ -78,19 +79,46 @@ var controlsOp *mpTermR     // for controls -> … productions
 var dirOp *mpTermR          // for direction_specifier -> … productions
 var joinOp *mpTermR         // for path_join -> … productions
 var pathExprOp *mpTermR     // for path_expression -> … productions
+var pathKnotOp *mpTermR     // for path_knot -> … productions
+var pathSegmentOp *mpTermR  // for path_segment -> … productions
+var dashListOp *mpTermR     // for dash_list -> … productions
 var commandOp *mpTermR      // for command -> … productions
 var drawOptOp *mpTermR      // for drawing_option -> … productions
+var ifOp *mpTermR           // for if_statement -> … productions
+var altOp *mpTermR          // for alternatives -> … productions
+var condPrimaryOp *mpTermR  // for conditional_primary -> … productions
+var primAltOp *mpTermR      // for primary_alternatives -> … productions
+var condSegmentOp *mpTermR  // for conditional_path_segment -> … productions
+var segAltOp *mpTermR       // for segment_alternatives -> … productions
+var segLoopOp *mpTermR      // for segment_loop -> … productions
+var loopOp *mpTermR         // for loop_statement -> … productions
+var loopHeaderOp *mpTermR   // for loop_header -> … productions
+var progressionOp *mpTermR  // for progression -> … productions
+var forListOp *mpTermR      // for for_list -> … productions
+var suffixListOp *mpTermR   // for suffix_list -> … productions
+var exitOp *mpTermR         // for exit_statement -> … productions
+var capsuleOp *mpTermR      // for capsule -> … productions
+var funcDefOp *mpTermR      // for function_definition -> … productions
+var replTextOp *mpTermR     // for replacement_text -> … productions
 
 func initRewriters() {
 	atomOp = makeASTTermR("atom", "atom")
 	atomOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
-		// ⟨atom⟩ → ⟨variable⟩ | Unsigned | NullaryOp
+		// ⟨atom⟩ → ⟨variable⟩ | Unsigned | STRING | NullaryOp
 		//     | Unsigned ⟨variable⟩
+		//     | str ⟨variable⟩
 		//     | begingroup ⟨statement list⟩ ⟨tertiary⟩ endgroup
 		//     | ( ⟨expression⟩ )
+		//     | ( ⟨path expression⟩ ⟨path join⟩ ⟨path knot⟩ )
+		//     | dashpattern ( ⟨dash list⟩ )
+		//     | thelabel [TAG] ( ⟨tertiary⟩ , ⟨tertiary⟩ )
+		//     | ⟨capsule⟩
 		tracer().Infof("atom tree = ")
 		terex.Elem(l).Dump(tracing.LevelInfo)
 		if singleArg(l) { // ⟨variable⟩
+			if tokenArg(l) && l.Cdar().Data.(gorgo.Token).TokType() == String {
+				return terex.Elem(terex.Atomize(l.Cdar().Data.(gorgo.Token).Value())) // STRING ⇒ "…"
+			}
 			if keywordArg(l) { // Unsigned | NullaryOp
 				setTerminalTokenValue(terex.Elem(l.Cdar()), env)
 				return terex.Elem(l.Cdar())
@@ -107,12 +135,30 @@ func initRewriters() {
 			l = terex.List(opAtom, stmts, expr)       // return closure node
 			return terex.Elem(l)
 		}
+		if isToken(l.Cdar(), "str") { // str ⟨variable⟩ ⇒ ( str ⟨variable⟩ )
+			opAtom := terex.Atomize(wrapOpToken(l.Cdar()))
+			return terex.Elem(terex.List(opAtom, l.Cddar()))
+		}
+		if isToken(l.Cdar(), "dashpattern") { // ⇒ ( #dashpattern on|off ⟨secondary⟩ … )
+			if l.Nth(4).Data == nil { // empty dash list
+				op := wrapOpToken(terex.Atomize(makeLMToken("PseudoOp", "dashpattern")))
+				return terex.Elem(terex.Cons(terex.Atomize(op), nil))
+			}
+			return terex.Elem(l.Nth(4))
+		}
+		if isToken(l.Cdar(), "thelabel") { // ⇒ ( thelabel "suffix" ⟨tertiary⟩ ⟨tertiary⟩ )
+			opAtom := terex.Atomize(wrapOpToken(l.Cdar()))
+			return terex.Elem(terex.Cons(opAtom, labelArgs(l.Cddr())))
+		}
 		if tokenArg(l) { // Unsigned ⟨variable⟩ ⇒ (* Unsigned ⟨variable⟩ )
 			// invent an ad-hoc multiplication token
 			op := wrapOpToken(terex.Atomize(makeLMToken("PrimaryOp", "*")))
 			prefix := setTerminalTokenValue(terex.Elem(l.Cdar()), env)
 			return terex.Elem(terex.List(op, prefix.AsAtom(), l.Cddar()))
 		}
+		if l.Length() == 6 { // ( ⟨path expression⟩ ⟨path join⟩ ⟨path knot⟩ ) ⇒ ( #make-path … )
+			return terex.Elem(pathItems(terex.Cons(l.Car, l.Cddr().FirstN(3)), "make-path"))
+		}
 		return terex.Elem(l.Cddar()) // ( ⟨expression⟩ ) ⇒ ⟨expression⟩
 	}
 	suffixOp = makeASTTermR("suffix", "suffix")
@@ -167,9 +213,10 @@ func initRewriters() {
 	}
 	primaryOp = makeASTTermR("primary", "primary")
 	primaryOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
-		// ⟨primary⟩ → ⟨atom⟩ | UnaryOp ⟨primary⟩
+		// ⟨primary⟩ → ⟨atom⟩ | UnaryOp ⟨primary⟩ | Type ⟨primary⟩ | cycle ⟨atom⟩
 		//     | ⟨scalar multiplication op⟩  ⟨primary⟩
 		//     | ( ⟨numeric expression⟩ , ⟨numeric expression⟩ )
+		//     | ( ⟨numeric expression⟩ , … , ⟨numeric expression⟩ )
 		//     | ⟨atom⟩ [ ⟨expression⟩ , ⟨expression⟩ ]
 		//     | OfOp ⟨expression⟩ of ⟨primary⟩
 		tracer().Infof("primary tree = ")
@@ -177,13 +224,32 @@ func initRewriters() {
 		if !singleArg(l) {
 			if l.Length() == 3 {
 				// ⟨primary⟩ → UnaryOp ⟨primary⟩
+				// ⟨primary⟩ → Type ⟨primary⟩
+				// ⟨primary⟩ → cycle ⟨atom⟩
 				// ⟨primary⟩ → ⟨scalar multiplication op⟩  ⟨primary⟩
+				// ⟨primary⟩ → PlusOrMinus ⟨primary⟩
+				if isToken(l.Cdar(), "+") { // + ⟨primary⟩ ⇒ ⟨primary⟩
+					return terex.Elem(l.Cddar())
+				}
+				if isToken(l.Cdar(), "-") { // - ⟨primary⟩ ⇒ ( #negate ⟨primary⟩ )
+					op := wrapOpToken(terex.Atomize(makeLMToken("PseudoOp", "negate")))
+					return terex.Elem(terex.List(op, l.Cddar()))
+				}
 				opAtom := terex.Atomize(wrapOpToken(l.Cdar()))
 				return terex.Elem(terex.Cons(opAtom, l.Cddr())) // UnaryOp ⟨primary⟩
 			}
 			setTerminalTokenValue(terex.Elem(l.Cdar()), env)
 			if tokenArgEq(l, '(') {
 				// ⟨primary⟩ → ( ⟨numeric expression⟩ , ⟨numeric expression⟩ )
+				//     | ( ⟨numeric expression⟩ , … , ⟨numeric expression⟩ )
+				switch l.Length() {
+				case 8: // RGB color
+					op := wrapOpToken(terex.Atomize(makeLMToken("PseudoOp", "make-color")))
+					return terex.Elem(terex.List(op, l.Cddar(), l.Nth(5), l.Nth(7)))
+				case 10: // CMYK color
+					op := wrapOpToken(terex.Atomize(makeLMToken("PseudoOp", "make-cmykcolor")))
+					return terex.Elem(terex.List(op, l.Cddar(), l.Nth(5), l.Nth(7), l.Nth(9)))
+				}
 				op := wrapOpToken(terex.Atomize(makeLMToken("PseudoOp", "make-pair")))
 				return terex.Elem(terex.List(op, l.Cddar(), l.Nth(5)))
 			}
@@ -202,6 +268,7 @@ func initRewriters() {
 	secondaryOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
 		// ⟨secondary⟩ → ⟨primary⟩
 		//     | ⟨secondary⟩ PrimaryOp ⟨primary⟩
+		//     | ⟨secondary⟩ and ⟨primary⟩
 		//     | ⟨secondary⟩  ⟨transformer⟩
 		tracer().Infof("secondary tree = ")
 		terex.Elem(l).Dump(tracing.LevelInfo)
@@ -214,7 +281,7 @@ func initRewriters() {
 			l := terex.Cons(transf, terex.Cons(l.Cdar(), targ))
 			return terex.Elem(l)
 		}
-		// ⟨secondary⟩ PrimaryOp ⟨primary⟩ ⇒ ( PrimaryOp ⟨secondary⟩ ⟨primary⟩ )
+		// ⟨secondary⟩ PrimaryOp ⟨primary⟩ ⇒ ( PrimaryOp ⟨secondary⟩ ⟨primary⟩ ), same for and
 		opAtom := terex.Atomize(wrapOpToken(l.Cddar()))
 		c := terex.Cons(opAtom, terex.Cons(l.Cdar(), l.Last()))
 		return terex.Elem(c)
@@ -236,15 +303,27 @@ func initRewriters() {
 		c := terex.Cons(opAtom, terex.Cons(l.Cdar(), l.Last()))
 		return terex.Elem(c)
 	}
-	exprOp = makeASTTermR("expression", "expr")
+	exprOp = makeASTTermR("boolean_expression", "expr")
 	exprOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
-		// ⟨expression⟩ → ⟨subexpression⟩ | ⟨expression⟩  RelationOp  ⟨tertiary⟩
-		tracer().Infof("expression tree = ")
+		// ⟨boolean expression⟩ → ⟨tertiary⟩ | ⟨relation⟩
+		//     | ⟨boolean expression⟩ = ⟨tertiary⟩
+		tracer().Infof("boolean expression tree = ")
 		terex.Elem(l).Dump(tracing.LevelInfo)
 		if singleArg(l) {
-			return terex.Elem(l.Cdar()) // ⟨expression⟩ → ⟨subexpression⟩
+			return terex.Elem(l.Cdar()) // ⟨boolean expression⟩ → ⟨tertiary⟩ | ⟨relation⟩
 		}
-		// ⟨expression⟩ RelationOp ⟨tertiary⟩ ⇒ ( RelationOp ⟨expression⟩ ⟨tertiary⟩ )
+		// ⟨boolean expression⟩ = ⟨tertiary⟩ ⇒ ( = ⟨boolean expression⟩ ⟨tertiary⟩ )
+		opAtom := terex.Atomize(wrapOpToken(l.Cddar()))
+		c := terex.Cons(opAtom, terex.Cons(l.Cdar(), l.Last()))
+		return terex.Elem(c)
+	}
+	relationOp = makeASTTermR("relation", "relation")
+	relationOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨relation⟩ → ⟨tertiary⟩  RelationOp  ⟨tertiary⟩
+		//     | ⟨relation⟩  RelationOp  ⟨tertiary⟩
+		tracer().Infof("relation tree = ")
+		terex.Elem(l).Dump(tracing.LevelInfo)
+		// ⟨tertiary⟩ RelationOp ⟨tertiary⟩ ⇒ ( RelationOp ⟨tertiary⟩ ⟨tertiary⟩ )
 		opAtom := terex.Atomize(wrapOpToken(l.Cddar()))
 		c := terex.Cons(opAtom, terex.Cons(l.Cdar(), l.Last()))
 		return terex.Elem(c)
@@ -471,25 +550,49 @@ func initRewriters() {
 	pathExprOp = makeASTTermR("path_expression", "pathexpr")
 	pathExprOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
 		// ⟨path expression⟩ → ⟨tertiary⟩ | ⟨path expression⟩ ⟨path join⟩ ⟨path knot⟩
-		p := wrapOpToken(terex.Atomize(makeLMToken("PseudoOp", "make-path")))
+		//     | ⟨path expression⟩ ⟨conditional path segment⟩
+		//     | ⟨path expression⟩ ⟨segment loop⟩
+		if singleArg(l) {
+			return terex.Elem(l.Cdar()) // ⟨path expression⟩ → ⟨tertiary⟩
+		}
+		return terex.Elem(pathItems(l, "make-path"))
+	}
+	pathKnotOp = makeASTTermR("path_knot", "knot")
+	pathKnotOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨path knot⟩ → ⟨tertiary⟩ | cycle
+		if isToken(l.Cdar(), "cycle") {
+			op := wrapOpToken(terex.Atomize(makeLMToken("PseudoOp", "cycle")))
+			return terex.Elem(terex.Cons(terex.Atomize(op), nil))
+		}
+		return terex.Elem(l.Cdar())
+	}
+	pathSegmentOp = makeASTTermR("path_segment", "segment")
+	pathSegmentOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨path segment⟩ → ⟨empty⟩ | ⟨path segment⟩ ⟨path join⟩ ⟨path knot⟩
+		//     | ⟨path segment⟩ ⟨conditional path segment⟩
+		//     | ⟨path segment⟩ ⟨segment loop⟩
 		if withoutArgs(l) {
-			l = terex.Cons(terex.Atomize(p), l.Cdr)
-		} else {
-			sub := terex.Elem(l.Cdr).Sublist().AsList()
-			if isToken(sub.Car, "make-path") {
-				x := terex.Cons(terex.Atomize(p), sub.Cdr)
-				l = x.Append(l.Cddr())
-			} else {
-				l = terex.Cons(terex.Atomize(p), l.Cdr)
-			}
+			return terex.Elem(nil)
 		}
-		return terex.Elem(l)
+		return terex.Elem(pathItems(l, "segment"))
+	}
+	dashListOp = makeASTTermR("dash_list", "dashpattern")
+	dashListOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨dash list⟩ → ⟨empty⟩ | ⟨dash list⟩ on ⟨secondary⟩ | ⟨dash list⟩ off ⟨secondary⟩
+		if withoutArgs(l) {
+			return terex.Elem(nil)
+		}
+		return terex.Elem(pathItems(l, "dashpattern"))
 	}
 	commandOp = makeASTTermR("command", "command")
 	commandOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
-		// ⟨command⟩ → pickup ⟨primary⟩
+		// ⟨command⟩ → pickup ⟨secondary⟩
 		//     | save ⟨symbolic token list⟩
+		//     | randomseed := ⟨tertiary⟩
 		//     | ⟨drawing command⟩
+		//     | ⟨addto command⟩
+		//     | ⟨bounds command⟩
+		//     | ⟨label command⟩
 		//     | ⟨show command⟩
 		if isToken(l.Cdar(), "save") {
 			opAtom := terex.Atomize(wrapOpToken(l.Cdar()))
@@ -517,9 +620,24 @@ func initRewriters() {
 		} else if isToken(l.Cdar(), "pickup") {
 			opAtom := terex.Atomize(wrapOpToken(l.Cdar()))
 			l = terex.Cons(opAtom, l.Cddr())
+		} else if isToken(l.Cdar(), "randomseed") { // ( randomseed ⟨tertiary⟩ ), without ':='
+			opAtom := terex.Atomize(wrapOpToken(l.Cdar()))
+			l = terex.Cons(opAtom, l.Cddr().Cdr)
 		} else if isToken(l.Cdar(), "show") {
 			opAtom := terex.Atomize(wrapOpToken(l.Cdar()))
 			l = terex.Cons(opAtom, l.Cddr())
+		} else if isToken(l.Cdar(), "addto") {
+			// ( addto ⟨variable⟩ also|contour|doublepath ⟨tertiary⟩ ⟨drawing option⟩ … )
+			opAtom := terex.Atomize(wrapOpToken(l.Cdar()))
+			l = terex.Cons(opAtom, l.Cddr())
+		} else if isToken(l.Cdar(), "clip") || isToken(l.Cdar(), "setbounds") {
+			// ( clip|setbounds ⟨variable⟩ ⟨path expression⟩ ), without 'to'
+			opAtom := terex.Atomize(wrapOpToken(l.Cdar()))
+			l = terex.Cons(opAtom, terex.Cons(l.Cddar(), l.Cddr().Cddr()))
+		} else if isToken(l.Cdar(), "label") || isToken(l.Cdar(), "dotlabel") {
+			// ( label|dotlabel "suffix" ⟨tertiary⟩ ⟨tertiary⟩ ⟨drawing option⟩ … )
+			opAtom := terex.Atomize(wrapOpToken(l.Cdar()))
+			l = terex.Cons(opAtom, labelArgs(l.Cddr()))
 		} else if isToken(l.Cdar(), "DrawCmd") {
 			opAtom := terex.Atomize(wrapOpToken(l.Cdar()))
 			return terex.Elem(terex.Cons(opAtom, l.Cddr()))
@@ -535,6 +653,296 @@ func initRewriters() {
 		l = terex.Cons(opAtom, l.Cddr())
 		return terex.Elem(l)
 	}
+	ifOp = makeASTTermR("if_statement", "if")
+	ifOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨if statement⟩ → if ⟨boolean expression⟩ : ⟨statement list⟩ ⟨alternatives⟩ fi
+		tracer().Infof("if statement tree = ")
+		terex.Elem(l).Dump(tracing.LevelInfo)
+		return terex.Elem(conditional(l, statements))
+	}
+	altOp = makeASTTermR("alternatives", "alternatives")
+	altOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨alternatives⟩ → ⟨empty⟩ | else : ⟨statement list⟩
+		//     | elseif ⟨boolean expression⟩ : ⟨statement list⟩ ⟨alternatives⟩
+		return alternatives(l, statements)
+	}
+	condPrimaryOp = makeASTTermR("conditional_primary", "if")
+	condPrimaryOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨conditional primary⟩ → if ⟨boolean expression⟩ : ⟨primary⟩ ⟨primary alternatives⟩ fi
+		tracer().Infof("conditional primary tree = ")
+		terex.Elem(l).Dump(tracing.LevelInfo)
+		return terex.Elem(conditional(l, nil))
+	}
+	primAltOp = makeASTTermR("primary_alternatives", "alternatives")
+	primAltOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨primary alternatives⟩ → ⟨empty⟩ | else : ⟨primary⟩
+		//     | elseif ⟨boolean expression⟩ : ⟨primary⟩ ⟨primary alternatives⟩
+		return alternatives(l, nil)
+	}
+	condSegmentOp = makeASTTermR("conditional_path_segment", "if")
+	condSegmentOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨conditional path segment⟩ → if ⟨boolean expression⟩ : ⟨path segment⟩
+		//     ⟨segment alternatives⟩ fi
+		tracer().Infof("conditional path segment tree = ")
+		terex.Elem(l).Dump(tracing.LevelInfo)
+		return terex.Elem(conditional(l, nil))
+	}
+	segAltOp = makeASTTermR("segment_alternatives", "alternatives")
+	segAltOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨segment alternatives⟩ → ⟨empty⟩ | else : ⟨path segment⟩
+		//     | elseif ⟨boolean expression⟩ : ⟨path segment⟩ ⟨segment alternatives⟩
+		return alternatives(l, nil)
+	}
+	segLoopOp = makeASTTermR("segment_loop", "loop")
+	segLoopOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨segment loop⟩ → ⟨loop header⟩ : ⟨path segment⟩ endfor
+		tracer().Infof("segment loop tree = ")
+		terex.Elem(l).Dump(tracing.LevelInfo)
+		return terex.Elem(loop(l, nil))
+	}
+	loopOp = makeASTTermR("loop_statement", "loop")
+	loopOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨loop statement⟩ → ⟨loop header⟩ : ⟨statement list⟩ endfor
+		tracer().Infof("loop statement tree = ")
+		terex.Elem(l).Dump(tracing.LevelInfo)
+		return terex.Elem(loop(l, statements))
+	}
+	loopHeaderOp = makeASTTermR("loop_header", "loop_header")
+	loopHeaderOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨loop header⟩ → for TAG = ⟨progression⟩ | for TAG = ⟨for list⟩
+		//     | forsuffixes TAG = ⟨suffix list⟩ | forever
+		opAtom := terex.Atomize(wrapOpToken(l.Cdar()))
+		if singleArg(l) { // forever
+			return terex.Elem(terex.Cons(opAtom, nil))
+		}
+		tag := setTerminalTokenValue(terex.Elem(l.Cddar()), env).AsAtom()
+		return terex.Elem(terex.List(opAtom, tag, l.Nth(5))) // ( #for TAG ⟨values⟩ )
+	}
+	progressionOp = makeASTTermR("progression", "progression")
+	progressionOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨progression⟩ → ⟨tertiary⟩ upto ⟨tertiary⟩ | ⟨tertiary⟩ downto ⟨tertiary⟩
+		//     | ⟨tertiary⟩ step ⟨tertiary⟩ until ⟨tertiary⟩
+		// ⇒ ( #step ⟨start⟩ ⟨step⟩ ⟨limit⟩ )
+		op := wrapOpToken(terex.Atomize(makeLMToken("PseudoOp", "step")))
+		if isToken(l.Cddar(), "upto") {
+			return terex.Elem(terex.List(op, l.Cdar(), terex.Atomize(1.0), l.Nth(4)))
+		} else if isToken(l.Cddar(), "downto") {
+			return terex.Elem(terex.List(op, l.Cdar(), terex.Atomize(-1.0), l.Nth(4)))
+		}
+		return terex.Elem(terex.List(op, l.Cdar(), l.Nth(4), l.Nth(6)))
+	}
+	forListOp = makeASTTermR("for_list", "for_list")
+	forListOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨for list⟩ → ⟨tertiary⟩ | ⟨for list⟩ , ⟨tertiary⟩
+		return terex.Elem(list(l))
+	}
+	suffixListOp = makeASTTermR("suffix_list", "suffix_list")
+	suffixListOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨suffix list⟩ → ⟨suffix⟩ | ⟨suffix list⟩ , ⟨suffix⟩
+		return terex.Elem(list(l))
+	}
+	exitOp = makeASTTermR("exit_statement", "exit")
+	exitOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨exit statement⟩ → exitif ⟨boolean expression⟩ | exitunless ⟨boolean expression⟩
+		opAtom := terex.Atomize(wrapOpToken(l.Cdar()))
+		return terex.Elem(terex.Cons(opAtom, l.Cddr()))
+	}
+	capsuleOp = makeASTTermR("capsule", "capsule")
+	capsuleOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨capsule⟩ → Capsule ⟨atom⟩ ⇒ ( #capsule ⟨atom⟩ )
+		// The operator carries the name of the capsule as its value.
+		name := l.Cdar().Data.(gorgo.Token).Lexeme()
+		op := wrapOpToken(terex.Atomize(MakeMPToken(PseudoOp, "capsule", name)))
+		return terex.Elem(terex.List(op, l.Cddar()))
+	}
+	funcDefOp = makeASTTermR("function_definition", "funcdef")
+	funcDefOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨function definition⟩ → ⟨function heading⟩ = ⟨replacement text⟩ enddef
+		// ⟨function heading⟩ → ⟨binary def⟩ ⟨parameter⟩ TAG ⟨parameter⟩
+		// ⇒ ( #primarydef TAG TAG TAG ⟨replacement text⟩ )
+		// Headings of def and vardef are consumed by the scanner.
+		heading := tokenAtoms(l.Cdar(), nil)
+		if len(heading) != 4 {
+			tracer().Errorf("unexpected function heading: %v", terex.Elem(l.Cdar()))
+			return terex.Elem(l)
+		}
+		opAtom := terex.Atomize(wrapOpToken(heading[0]))
+		for _, param := range heading[1:] {
+			setTerminalTokenValue(terex.Elem(param), env)
+		}
+		return terex.Elem(terex.List(opAtom, heading[1], heading[2], heading[3], l.Nth(4)))
+	}
+	replTextOp = makeASTTermR("replacement_text", "repltext")
+	replTextOp.rewrite = func(l *terex.GCons, env *terex.Environment) terex.Element {
+		// ⟨replacement text⟩ → ⟨statement list⟩ ⟨tertiary⟩
+		// ⇒ ( #begingroup ( #statements ⟨statement⟩ … ) ⟨tertiary⟩ )
+		op := wrapOpToken(terex.Atomize(makeLMToken("begingroup", "begingroup")))
+		var stmts terex.Atom
+		if !singleArg(l) {
+			stmts = l.Cdar()
+		}
+		return terex.Elem(terex.List(op, statements(stmts), l.Last().Car))
+	}
+}
+
+// conditional creates an AST node for conditionals, given as
+//
+//     ( op if|elseif ⟨boolean expression⟩ : ⟨body⟩ ⟨alternatives⟩ [fi] )
+//
+// The result is ( #if ⟨boolean expression⟩ ⟨body⟩ ⟨else part⟩ ), with the
+// else part omitted if there are no alternatives. ⟨alternatives⟩ have already
+// been rewritten to ( #else ⟨else part⟩ ) by function alternatives, with an
+// elseif-branch being a nested #if-node.
+//
+// If wrap is non-nil, it will be applied to the body, e.g. for converting a
+// statement list into a #statements-node.
+//
+func conditional(l *terex.GCons, wrap func(terex.Atom) terex.Atom) *terex.GCons {
+	ifop := wrapOpToken(terex.Atomize(makeLMToken("if", "if")))
+	cond := l.Nth(3)
+	var body, otherwise terex.Atom
+	for x := l.Cddr().Cddr(); x != nil; x = x.Cdr { // skip op, if, cond and ':'
+		if x.Car.Data == nil || isToken(x.Car, "fi") {
+			continue
+		}
+		if isSubAST(x.Car, "else") {
+			otherwise = terex.Elem(x.Car).Sublist().AsList().Cdar()
+		} else {
+			body = x.Car
+		}
+	}
+	if wrap != nil {
+		body = wrap(body)
+	}
+	if otherwise.Data == nil {
+		return terex.List(ifop, cond, body)
+	}
+	return terex.List(ifop, cond, body, otherwise)
+}
+
+// alternatives rewrites the else-part of a conditional to
+//
+//     ( #else ⟨body⟩ )     or     ( #else ( #if ⟨boolean expression⟩ … ) )
+//
+// for an elseif-branch. An empty alternative is dropped.
+func alternatives(l *terex.GCons, wrap func(terex.Atom) terex.Atom) terex.Element {
+	if withoutArgs(l) {
+		return terex.Elem(nil)
+	}
+	elseop := wrapOpToken(terex.Atomize(makeLMToken("PseudoOp", "else")))
+	if isToken(l.Cdar(), "elseif") {
+		cond := conditional(l, wrap)
+		return terex.Elem(terex.List(elseop, terex.Atomize(cond)))
+	}
+	body := l.Nth(4) // else : ⟨body⟩
+	if wrap != nil {
+		body = wrap(body)
+	}
+	return terex.Elem(terex.List(elseop, body))
+}
+
+// loop creates an AST node for loops, given as
+//
+//     ( op ⟨loop header⟩ : ⟨body⟩ endfor )
+//
+// The loop header has already been rewritten to ( #for TAG ⟨values⟩ ) or
+// ( #forever ) by loopHeaderOp. The result is the loop header with the body
+// appended, e.g.
+//
+//     ( #for TAG ⟨values⟩ ⟨body⟩ )
+//
+// If wrap is non-nil, it will be applied to the body.
+//
+func loop(l *terex.GCons, wrap func(terex.Atom) terex.Atom) *terex.GCons {
+	header := l.Cdar().Data.(*terex.GCons)
+	var body terex.Atom
+	for x := l.Cddr(); x != nil; x = x.Cdr { // skip op and loop header
+		if x.Car.Data == nil || isToken(x.Car, ":") || isToken(x.Car, "endfor") {
+			continue
+		}
+		body = x.Car
+	}
+	if wrap != nil {
+		body = wrap(body)
+	}
+	return header.Append(terex.Cons(body, nil))
+}
+
+// list rewrites left-recursive lists ⟨list⟩ → ⟨item⟩ | ⟨list⟩ , ⟨item⟩ to
+//
+//     ( #list ⟨item⟩ … )
+//
+func list(l *terex.GCons) *terex.GCons {
+	if isSubAST(l.Cdar(), "list") { // ⟨list⟩ , ⟨item⟩
+		items := terex.Elem(l.Cdar()).Sublist().AsList()
+		return items.Append(terex.Cons(l.Last().Car, nil))
+	}
+	op := wrapOpToken(terex.Atomize(makeLMToken("PseudoOp", "list")))
+	return terex.List(op, l.Cdar())
+}
+
+// pathItems rewrites left-recursive path expressions and path segments to
+//
+//     ( #make-path ⟨knot⟩ ⟨join⟩ ⟨knot⟩ … )     or     ( #segment ⟨join⟩ ⟨knot⟩ … )
+//
+// Dash lists are flattened the same way, to ( #dashpattern on|off ⟨secondary⟩ … ).
+// Conditional path segments and segment loops are kept as items of their
+// own; they will be unrolled by the evaluator.
+func pathItems(l *terex.GCons, opname string) *terex.GCons {
+	op := terex.Atomize(wrapOpToken(terex.Atomize(makeLMToken("PseudoOp", opname))))
+	items := l.Cdr
+	if items.Car.Data == nil { // ⟨path segment⟩ → ε …
+		items = items.Cdr
+	} else if isSubAST(items.Car, opname) { // ⟨path expression⟩ ⟨…⟩ ⇒ flatten
+		sub := terex.Elem(items.Car).Sublist().AsList()
+		return terex.Cons(op, sub.Cdr).Append(items.Cdr)
+	}
+	return terex.Cons(op, items)
+}
+
+// labelArgs rewrites the arguments of label commands and of thelabel,
+//
+//     [TAG] ( ⟨tertiary⟩ , ⟨tertiary⟩ ) …     ⇒     "TAG" ⟨tertiary⟩ ⟨tertiary⟩ …
+//
+// The label suffix becomes a string, which is empty if it is missing.
+func labelArgs(l *terex.GCons) *terex.GCons {
+	suffix := ""
+	if tok, ok := l.Car.Data.(gorgo.Token); ok && tok.TokType() == Tag {
+		suffix = tok.Lexeme()
+		l = l.Cdr
+	}
+	args := terex.Cons(l.Cdar(), terex.Cons(l.Cdr.Cddar(), l.Cdr.Cddr().Cddr()))
+	return terex.Cons(terex.Atomize(suffix), args)
+}
+
+// statements wraps a statement list into a node
+//
+//     ( #statements ⟨statement⟩ … )
+//
+// Statement lists are constructed from nested sub-lists (see stmtListOp);
+// statements flattens them.
+func statements(a terex.Atom) terex.Atom {
+	stmtop := wrapOpToken(terex.Atomize(makeLMToken("PseudoOp", "statements")))
+	l := terex.Cons(terex.Atomize(stmtop), flattenStatements(a))
+	return terex.Atomize(l)
+}
+
+func flattenStatements(a terex.Atom) *terex.GCons {
+	if a.Data == nil {
+		return nil
+	}
+	if a.Type() != terex.ConsType {
+		return terex.Cons(a, nil)
+	}
+	l := a.Data.(*terex.GCons)
+	if l.Car.Type() == terex.OperatorType { // a single statement
+		return terex.Cons(a, nil)
+	}
+	var stmts *terex.GCons
+	for ; l != nil; l = l.Cdr {
+		stmts = stmts.Append(flattenStatements(l.Car))
+	}
+	return stmts
 }
 
 func equation(op terex.Operator, l *terex.GCons) *terex.GCons {
@@ -557,6 +965,19 @@ func equation(op terex.Operator, l *terex.GCons) *terex.GCons {
 	return l
 }
 
+// tokenAtoms collects the token atoms of an AST fragment, in order.
+func tokenAtoms(a terex.Atom, toks []terex.Atom) []terex.Atom {
+	switch a.Type() {
+	case terex.TokenType:
+		toks = append(toks, a)
+	case terex.ConsType:
+		for l := a.Data.(*terex.GCons); l != nil; l = l.Cdr {
+			toks = tokenAtoms(l.Car, toks)
+		}
+	}
+	return toks
+}
+
 // ---------------------------------------------------------------------------
 
 // WithoutArgs is a predicate: are there no arguments?
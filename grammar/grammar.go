@@ -3,6 +3,7 @@ package grammar
 import (
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"sync"
 
@@ -27,7 +28,7 @@ var mpGrammar *lr.LRAnalysis
 
 func initGlobalGrammar() {
 	startOnce.Do(func() {
-		mpGrammar = initGrammar("S")
+		mpGrammar = initGrammar("statement_list")
 	})
 }
 
@@ -104,6 +105,38 @@ func parseStatement(lex *lexer, scopes *sframe.ScopeFrameTree) (*sppf.Forest, go
 	return parser.ParseForest(), earleyTokenReceiver(parser), nil
 }
 
+// Parse parses MetaPost input, given as a rune reader, and creates an
+// abstract syntax tree for it. It returns the AST, a TeREx-environment and an
+// error status.
+//
+// Input is expected to be a list of statements, each terminated by ';'.
+// The AST returned is a single node
+//
+//     ( #statements ⟨statement⟩ … )
+//
+func Parse(input io.RuneReader) (*terex.GCons, *terex.Environment, error) {
+	lex := NewLexer(input)
+	var lexErr error // first error of the lexer, e.g. from macro expansion
+	lex.SetErrorHandler(func(err error) {
+		tracer().Errorf("MP scanner error: %s", err.Error())
+		if lexErr == nil {
+			lexErr = err
+		}
+	})
+	tree, retr, err := parseStatement(lex, nil)
+	if lexErr != nil {
+		return nil, nil, lexErr
+	} else if err != nil {
+		return nil, nil, err
+	}
+	ast, env, err := AST(tree, retr)
+	if err != nil {
+		return nil, nil, err
+	}
+	program := statements(terex.Atomize(ast)).Data.(*terex.GCons)
+	return program, env, nil
+}
+
 func earleyTokenReceiver(parser *earley.Parser) gorgo.TokenRetriever {
 	return func(pos uint64) gorgo.Token {
 		return parser.TokenAt(pos)
@@ -189,6 +222,7 @@ func newASTBuilder(grammar *lr.Grammar) *termr.ASTBuilder {
 	ab.AddRewriter(secondaryOp.name, secondaryOp)
 	ab.AddRewriter(tertiaryOp.name, tertiaryOp)
 	ab.AddRewriter(exprOp.name, exprOp)
+	ab.AddRewriter(relationOp.name, relationOp)
 	ab.AddRewriter(declOp.name, declOp)
 	ab.AddRewriter(declvarOp.name, declvarOp)
 	ab.AddRewriter(declsuffixOp.name, declsuffixOp)
@@ -205,8 +239,27 @@ func newASTBuilder(grammar *lr.Grammar) *termr.ASTBuilder {
 	ab.AddRewriter(dirOp.name, dirOp)
 	ab.AddRewriter(joinOp.name, joinOp)
 	ab.AddRewriter(pathExprOp.name, pathExprOp)
+	ab.AddRewriter(pathKnotOp.name, pathKnotOp)
+	ab.AddRewriter(pathSegmentOp.name, pathSegmentOp)
+	ab.AddRewriter(dashListOp.name, dashListOp)
 	ab.AddRewriter(commandOp.name, commandOp)
 	ab.AddRewriter(drawOptOp.name, drawOptOp)
+	ab.AddRewriter(ifOp.name, ifOp)
+	ab.AddRewriter(altOp.name, altOp)
+	ab.AddRewriter(condPrimaryOp.name, condPrimaryOp)
+	ab.AddRewriter(primAltOp.name, primAltOp)
+	ab.AddRewriter(condSegmentOp.name, condSegmentOp)
+	ab.AddRewriter(segAltOp.name, segAltOp)
+	ab.AddRewriter(segLoopOp.name, segLoopOp)
+	ab.AddRewriter(loopOp.name, loopOp)
+	ab.AddRewriter(loopHeaderOp.name, loopHeaderOp)
+	ab.AddRewriter(progressionOp.name, progressionOp)
+	ab.AddRewriter(forListOp.name, forListOp)
+	ab.AddRewriter(suffixListOp.name, suffixListOp)
+	ab.AddRewriter(exitOp.name, exitOp)
+	ab.AddRewriter(capsuleOp.name, capsuleOp)
+	ab.AddRewriter(funcDefOp.name, funcDefOp)
+	ab.AddRewriter(replTextOp.name, replTextOp)
 	return ab
 }
 
@@ -241,13 +294,8 @@ func setTerminalTokenValue(el terex.Element, env *terex.Environment) terex.Eleme
 				tracer().Errorf("   %s", err.Error())
 				return terex.Elem(terex.Atomize(err))
 			}
-		case tokenTypeFromLexeme["STRING"]:
-			if (len(token.Lexeme)) <= 2 {
-				t.Value = ""
-			} else { // trim off "…" ⇒ …
-				t.Value = string(token.Lexeme[1 : len(token.Lexeme)-1])
-			}
 	*/
+	case String: // value has been set by the lexer, "…" ⇒ …
 	case tokenTypeFromLexeme["TAG"]: // return []string value, split at '.'
 		tag := string(token.Lexeme())
 		tags, err := splitTagName(tag)
@@ -8,6 +8,7 @@ import (
 	"unicode"
 
 	"github.com/npillmayer/gorgo"
+	"github.com/npillmayer/pmmp/sframe"
 )
 
 // --- Category codes --------------------------------------------------------
@@ -44,7 +45,7 @@ var catcodeTable = []string{
 }
 
 func cat(r rune) catcode {
-	if unicode.IsLetter(r) {
+	if unicode.IsLetter(r) || r == capsuleMark {
 		return cat0
 	}
 	if unicode.IsDigit(r) {
@@ -64,12 +65,30 @@ type lexer struct {
 	state      scstate
 	stream     runeStream
 	csq        catseq
+	mark       int  // length of output before the current category sequence
+	flushed    bool // has a pending token been flushed at EOF?
+	spaced     bool // has the last token been preceded by white space?
+	lastType   gorgo.TokType
+	input      *nestedReader
+	macros     map[string]sframe.Macro
+	vardefs    map[string][]sframe.Macro // vardef macros by their first tag
+	operators  map[string]gorgo.TokType  // user-defined binary operators
+	queue      []gorgo.Token             // tokens to return before scanning on
+	expansions int                       // number of macro expansions so far
+	capsules   int                       // number of capsules so far
+	openers    []bool                    // open if-statements and loops: at start of a statement?
+	atStmt     bool                      // will the next token start a statement?
 	errHandler func(error)
 }
 
 func NewLexer(reader io.RuneReader) *lexer {
 	l := &lexer{}
-	l.stream.reader = &nestedReader{reader: reader}
+	l.input = &nestedReader{reader: reader}
+	l.stream.reader = l.input
+	l.macros = make(map[string]sframe.Macro)
+	l.vardefs = make(map[string][]sframe.Macro)
+	l.operators = make(map[string]gorgo.TokType)
+	l.atStmt = true
 	return l
 }
 
@@ -125,6 +144,8 @@ func makeToken(state scstate, lexeme string) (gorgo.TokType, gorgo.Token) {
 	if toktype == SymTok {
 		if id, ok := tokenTypeFromLexeme[lexeme]; ok {
 			toktype = id // symbolic token has a pre-defined meaning
+		} else if strings.HasPrefix(lexeme, string(capsuleMark)) {
+			toktype = Capsule // bound to a macro argument
 		} else {
 			// TODO lookup in symbol table
 			// if not entry => Tag
@@ -135,9 +156,18 @@ func makeToken(state scstate, lexeme string) (gorgo.TokType, gorgo.Token) {
 	} else if toktype == Literal {
 		toktype = gorgo.TokType(lexeme[0])
 	}
+	var value interface{} = lexeme
+	if toktype == Tag { // tags carry their suffix parts as []string
+		if tags, err := splitTagName(lexeme); err == nil {
+			value = tags
+		}
+	} else if toktype == String { // strings carry their text without quotes
+		value = strings.TrimSuffix(strings.TrimPrefix(lexeme, `"`), `"`)
+	}
 	return toktype, MPToken{
 		lexeme: lexeme,
 		kind:   toktype,
+		Val:    value,
 	}
 }
 
@@ -148,7 +178,7 @@ func makeToken(state scstate, lexeme string) (gorgo.TokType, gorgo.Token) {
 //     | ⟨‘ ⟨number or fraction⟩ ’ not followed by ‘ ⟨add op⟩  ⟨number⟩ ’⟩
 //
 func numberToken(lexeme string, la rune) (gorgo.TokType, MPToken) {
-	if !unicode.IsLetter(la) {
+	if !unicode.IsLetter(la) && la != '(' && la != capsuleMark {
 		return Unsigned, MPToken{
 			lexeme: lexeme,
 			kind:   Unsigned,
@@ -181,10 +211,10 @@ func unsignedValue(s string) float64 {
 			panic(fmt.Sprintf("malformed fraction: %q", s))
 		}
 		f = f * (float64(nom) / float64(denom))
-	} else if strings.Contains(s, ".") {
+	} else {
 		a, err := strconv.ParseFloat(s, 64)
 		if err != nil {
-			panic(fmt.Sprintf("malformed fraction: %q", s))
+			panic(fmt.Sprintf("malformed number: %q", s))
 		}
 		f = f * a
 	}
@@ -244,20 +274,98 @@ func eofToken(pos uint64) gorgo.Token {
 	}
 }
 
-func (l *lexer) NextToken() (token gorgo.Token) {
-	if l.stream.isEof {
+// NextToken returns the next token of the input. Macro definitions are
+// consumed and macro calls are expanded, i.e. the parser will see the
+// tokens of the replacement texts only. Names of user-defined operators are
+// classified according to their definition.
+func (l *lexer) NextToken() gorgo.Token {
+	for {
+		if len(l.queue) > 0 {
+			token := l.queue[0]
+			l.queue = l.queue[1:]
+			l.track(token)
+			return token
+		}
+		token := l.classify(l.scanToken())
+		if token == nil || token.TokType() == EOF {
+			return token
+		}
+		var err error
+		if token.Lexeme() == "def" || token.Lexeme() == "vardef" {
+			err = l.defineMacro(token.Lexeme())
+		} else if _, ok := binaryDefs[token.Lexeme()]; ok {
+			if err = l.defineOperator(token.Lexeme()); err == nil {
+				l.track(token)
+				return token
+			}
+		} else if !isMacroName(token) {
+			l.track(token)
+			return token
+		} else if m, ok := l.macros[token.Lexeme()]; ok {
+			err = l.expandMacro(m, nil)
+		} else if vardefs, ok := l.vardefs[token.Lexeme()]; ok {
+			var expanded bool
+			if expanded, err = l.expandVardef(token, vardefs); err == nil && !expanded {
+				l.track(token)
+				return token
+			}
+		} else {
+			l.track(token)
+			return token
+		}
+		if err != nil { // stop scanning
+			l.handleError(err)
+			l.stream.isEof = true
+			return eofToken(l.stream.start)
+		}
+	}
+}
+
+// track notes if the token following t will start a statement. This is
+// the case after a semicolon, after begingroup and after the colon of
+// if-statements and loops, but not within conditional expressions or path
+// segments.
+func (l *lexer) track(t gorgo.Token) {
+	switch t.Lexeme() {
+	case "if", "for", "forsuffixes", "forever":
+		l.openers = append(l.openers, l.atStmt)
+	case "fi", "endfor":
+		if n := len(l.openers); n > 0 {
+			l.openers = l.openers[:n-1]
+		}
+	}
+	switch t.Lexeme() {
+	case ";", "begingroup":
+		l.atStmt = true
+	case ":":
+		n := len(l.openers)
+		l.atStmt = n > 0 && l.openers[n-1]
+	default:
+		l.atStmt = false
+	}
+}
+
+// scanToken returns the next token of the input, without expanding macros.
+func (l *lexer) scanToken() (token gorgo.Token) {
+	l.spaced = false
+	if l.stream.isEof && l.csq.l == 0 {
 		return eofToken(l.stream.start)
 	}
 	var err error
 	for {
 		if l.csq.l == 0 {
+			l.mark = l.stream.writer.Len()
 			l.csq, err = nextCategorySequence(&l.stream)
 			if err != nil && err != io.EOF {
 				// TODO make token an error token
 				l.handleError(err)
 				return nil
-			} else if err == io.EOF {
-				return eofToken(l.stream.start)
+			} else if err == io.EOF && l.csq.l == 0 {
+				if l.state == state_start || l.flushed {
+					return eofToken(l.stream.start)
+				}
+				l.flushed = true // accept a pending token at EOF
+				l.csq = catseq{c: catSpace, l: 1}
 			}
 			tracer().Debugf("scanner category sequence: %v", l.csq)
 		}
@@ -270,11 +378,24 @@ func (l *lexer) NextToken() (token gorgo.Token) {
 		if newstate == accept_skip {
 			l.stream.ResetOutput()
 			l.state = state_start
+			l.spaced = true
 		} else if isAccept(newstate) {
 			token = nil
+			lexeme, pending := l.stream.OutputString(), ""
+			if mustBacktrack(newstate) { // current category sequence is not part of the token
+				lexeme, pending = lexeme[:l.mark], lexeme[l.mark:]
+			}
 			if newstate == accept_unsigned || newstate == accept_unsigned_bt {
-				r, _ := l.stream.lookahead()
-				_, token = numberToken(l.stream.OutputString(), r)
+				var r rune
+				if pending != "" {
+					r = []rune(pending)[0]
+				}
+				var num MPToken
+				_, num = numberToken(strings.TrimSuffix(lexeme, "."), r)
+				if l.lastType == Tag { // subscript, e.g. x1r
+					num.kind = Unsigned
+				}
+				token = num
 				tracer().Debugf("MetaPost lexer produces :numtoken(%v)", token)
 			} else if newstate == accept_macro_def {
 				if _, token, err = l.storeReplacementText(); err != nil {
@@ -284,14 +405,17 @@ func (l *lexer) NextToken() (token gorgo.Token) {
 				}
 				tracer().Debugf("MetaPost lexer stores macro %v", token)
 			} else {
-				_, token = makeToken(newstate, l.stream.OutputString())
+				_, token = makeToken(newstate, lexeme)
 				tracer().Debugf("MetaPost lexer produces :token(%v)", token)
 			}
 			l.stream.ResetOutput()
+			l.stream.writer.WriteString(pending)
+			l.mark = 0
 			l.state = state_start
 			if token == nil {
 				panic("scanner token is nil")
 			}
+			l.lastType = token.TokType()
 			return token
 		}
 	}
@@ -358,6 +482,9 @@ func next(s scstate, csq catseq) scstate {
 		}
 		switch csq.c {
 		case cat13: // "
+			if csq.l == 2 { // empty string
+				return accept_string
+			}
 			return state_string
 		case cat14: // digit
 			return state_num
@@ -383,6 +510,9 @@ func next(s scstate, csq catseq) scstate {
 		if csq.c == cat14 {
 			return accept_unsigned
 		}
+		if s == state_frac { // trailing '.', e.g. z1.left
+			return accept_unsigned_bt
+		}
 		return state_err
 	case state_comment:
 		if csq.c == catNL {
@@ -401,6 +531,8 @@ func nextCategorySequence(stream *runeStream) (csq catseq, err error) {
 	if err != nil && err != io.EOF {
 		csq.l = 0
 		return csq, fmt.Errorf("scanner cannot read sequence (%w)", err)
+	} else if err == io.EOF {
+		return csq, err
 	}
 	csq.c = cat(r)
 	cc := csq.c
@@ -1,12 +1,32 @@
 package grammar
 
 import (
+	"fmt"
 	"io"
+	"strings"
+
+	"github.com/npillmayer/gorgo"
+	"github.com/npillmayer/pmmp/sframe"
+)
+
+// maxMacroDepth limits the nesting of macro expansions, maxMacroExpansions
+// limits their total number. Runaway recursion will hit one of them.
+const (
+	maxMacroDepth      = 256
+	maxMacroExpansions = 100000
 )
 
+// capsuleMark starts the names of capsules, which bind the arguments of
+// value parameters. It is a character from Unicode's private use area, which
+// the scanner treats as a letter.
+const capsuleMark = '\uE000'
+
+// nestedReader reads runes from a stack of readers. Pushed readers, e.g.
+// for macro expansions, are read first. Exhausted readers are dropped.
 type nestedReader struct {
 	reader io.RuneReader
 	parent *nestedReader
+	depth  int
 }
 
 func (nr *nestedReader) ReadRune() (r rune, size int, err error) {
@@ -16,39 +36,574 @@ func (nr *nestedReader) ReadRune() (r rune, size int, err error) {
 			return
 		}
 		if err == io.EOF && nr.parent != nil {
-			nr = nr.parent
+			*nr = *nr.parent
 			continue
 		}
 		return
 	}
 }
 
-func (nr *nestedReader) Push(rr io.RuneReader) *nestedReader {
-	subnr := &nestedReader{
-		reader: rr,
-		parent: nr,
+// Push makes rr the current reader. When rr is exhausted, reading continues
+// with the previous reader.
+func (nr *nestedReader) Push(rr io.RuneReader) {
+	parent := *nr
+	nr.reader = rr
+	nr.parent = &parent
+	nr.depth = parent.depth + 1
+}
+
+// --- Macros ----------------------------------------------------------------
+
+// paramKinds maps parameter types of macro definitions to tag types.
+var paramKinds = map[string]sframe.TagType{
+	"expr":      sframe.SparkExpr,
+	"suffix":    sframe.SparkSuffix,
+	"text":      sframe.SparkText,
+	"primary":   sframe.SparkPrimary,
+	"secondary": sframe.SparkSecondary,
+	"tertiary":  sframe.SparkTertiary,
+}
+
+// rawToken is a token read without expanding macros, e.g. as part of a
+// macro argument.
+type rawToken struct {
+	gorgo.Token
+	spaced bool // preceded by white space?
+}
+
+func (l *lexer) nextRaw() rawToken {
+	t := l.scanToken()
+	return rawToken{Token: t, spaced: l.spaced}
+}
+
+func (t rawToken) isEOF() bool {
+	return t.Token == nil || t.TokType() == EOF
+}
+
+// defineMacro reads a macro definition, following the keyword def or vardef:
+//
+//     def ⟨name⟩ ( expr a, b ) ( suffix s ) … text t = ⟨replacement text⟩ enddef
+//     vardef ⟨generic variable⟩ @# ( expr a ) … = ⟨replacement text⟩ enddef
+//
+// The macro is stored in the lexer's macro table. The replacement text of a
+// vardef is enclosed in begingroup … endgroup.
+func (l *lexer) defineMacro(keyword string) error {
+	name, suffixed, t, err := l.macroName(keyword)
+	if err != nil {
+		return err
+	}
+	var params []sframe.TagDeclaration
+	for t.Lexeme() == "(" { // delimited parameters
+		kind := l.nextRaw().Lexeme()
+		if kind != "expr" && kind != "suffix" && kind != "text" {
+			return fmt.Errorf("%s %s: illegal parameter type %q", keyword, name[0], kind)
+		}
+		for {
+			p := l.nextRaw()
+			if p.isEOF() || p.TokType() != Tag {
+				return fmt.Errorf("%s %s: illegal parameter %v", keyword, name[0], p.Token)
+			}
+			params = append(params, sframe.MakeTagDecl(paramKinds[kind], p.Lexeme()))
+			if t = l.nextRaw(); t.Lexeme() != "," {
+				break
+			}
+		}
+		if t.Lexeme() != ")" {
+			return fmt.Errorf("%s %s: parameter list not closed", keyword, name[0])
+		}
+		t = l.nextRaw()
+	}
+	delimited := len(params)
+	if kind, ok := paramKinds[t.Lexeme()]; ok { // undelimited parameter
+		p := l.nextRaw()
+		if p.isEOF() || p.TokType() != Tag {
+			return fmt.Errorf("%s %s: illegal parameter %v", keyword, name[0], p.Token)
+		}
+		params = append(params, sframe.MakeTagDecl(kind, p.Lexeme()))
+		t = l.nextRaw()
+	}
+	if t.Lexeme() != "=" {
+		return fmt.Errorf("%s %s: expected '=', have %v", keyword, name[0], t.Token)
+	}
+	var body []rawToken
+	for nesting := 0; ; { // read replacement text up to the matching enddef
+		t = l.nextRaw()
+		if t.isEOF() {
+			return fmt.Errorf("%s %s: missing enddef", keyword, name[0])
+		}
+		switch t.Lexeme() {
+		case "def", "vardef", "primarydef", "secondarydef", "tertiarydef":
+			nesting++
+		case "enddef":
+			nesting--
+		}
+		if nesting < 0 {
+			break
+		}
+		body = append(body, t)
+	}
+	tracer().Debugf("define macro %s", strings.Join(name, "."))
+	delete(l.operators, name[0])
+	if keyword == "def" {
+		delete(l.vardefs, name[0])
+		l.macros[name[0]] = sframe.NewMacro(name[0], params, delimited, tokenText(body))
+		return nil
+	}
+	delete(l.macros, name[0])
+	m := sframe.NewVardef(name, suffixed, params, delimited,
+		"begingroup "+tokenText(body)+" endgroup")
+	vardefs := l.vardefs[name[0]]
+	for i, other := range vardefs { // re-definition replaces a vardef
+		if other.Declaration().Name() == m.Declaration().Name() {
+			vardefs = append(vardefs[:i], vardefs[i+1:]...)
+			break
+		}
+	}
+	l.vardefs[name[0]] = append(vardefs, m)
+	return nil
+}
+
+// macroName reads the name of a macro definition. For def this is a single
+// tag, for vardef a generic variable, optionally followed by @#. The token
+// following the name is returned as well.
+func (l *lexer) macroName(keyword string) (name []string, suffixed bool, next rawToken, err error) {
+	t := l.nextRaw()
+	if t.isEOF() || !isMacroName(t.Token) || isSuffixParameter(t.Lexeme()) {
+		return nil, false, t, fmt.Errorf("%s: illegal macro name %v", keyword, t.Token)
+	}
+	name = append(name, t.Lexeme())
+	next = l.nextRaw()
+	if keyword == "def" {
+		return name, false, next, nil
+	}
+	for !next.isEOF() {
+		if next.Lexeme() == "[" {
+			if t = l.nextRaw(); t.Lexeme() != "]" {
+				return nil, false, t, fmt.Errorf("vardef %s: illegal subscript in name", name[0])
+			}
+			name = append(name, "[]")
+		} else if next.TokType() == Tag && !isSuffixParameter(next.Lexeme()) {
+			name = append(name, next.Lexeme())
+		} else {
+			break
+		}
+		next = l.nextRaw()
+	}
+	if next.Lexeme() == "@#" {
+		suffixed = true
+		next = l.nextRaw()
+	}
+	return name, suffixed, next, nil
+}
+
+// isMacroName is a predicate: may t be the name of a macro? Apart from tags,
+// operators may be (re-)defined as macros, e.g. whatever or --.
+func isMacroName(t gorgo.Token) bool {
+	typ := t.TokType()
+	return typ == Tag || (typ <= UnaryOp && typ >= DrawOption && typ != Type)
+}
+
+// isSuffixParameter is a predicate: is s one of the implicit parameters of a
+// vardef?
+func isSuffixParameter(s string) bool {
+	return s == "@" || s == "#@" || s == "@#"
+}
+
+// binaryDefs maps the keywords for operator definitions to the token types
+// of the operators defined.
+var binaryDefs = map[string]gorgo.TokType{
+	"primarydef":   PrimaryOp,
+	"secondarydef": SecondaryOp,
+	"tertiarydef":  RelationOp,
+}
+
+// defineOperator reads the heading of an operator definition, following the
+// keyword primarydef, secondarydef or tertiarydef:
+//
+//     primarydef ⟨parameter⟩ ⟨name⟩ ⟨parameter⟩ = ⟨replacement text⟩ enddef
+//
+// Other than macros, operator definitions are handed to the parser, as the
+// operands of an operator call are known only after parsing. From now on,
+// the lexer will classify ⟨name⟩ as an operator of the level defined, i.e.
+// as PrimaryOp, SecondaryOp or RelationOp. Within the heading, ⟨name⟩ is
+// passed on as a tag.
+func (l *lexer) defineOperator(keyword string) error {
+	param, name := l.nextRaw(), l.nextRaw()
+	if name.isEOF() || !isMacroName(name.Token) || isSuffixParameter(name.Lexeme()) {
+		return fmt.Errorf("%s: illegal operator name %v", keyword, name.Token)
 	}
-	return subnr
+	tracer().Debugf("define operator %s", name.Lexeme())
+	delete(l.macros, name.Lexeme())
+	delete(l.vardefs, name.Lexeme())
+	l.operators[name.Lexeme()] = binaryDefs[keyword]
+	tag := MPToken{kind: Tag, lexeme: name.Lexeme(), Val: []string{name.Lexeme()}, span: name.Span()}
+	l.queue = append(l.queue, l.classify(param.Token), tag)
+	return nil
 }
 
-/*
-func (nr *nestedReader) PushMacro(v sframe.Variable, env *terex.Environment) *nestedReader {
-	macro := v.(sframe.Macro)
-	bound := make([]sframe.Variable, 0, len(macro.ArgsList))
-	for i, arg := range macro.ArgsList {
-		bound[i] = bind(arg, env)
+// classify changes the token type of names of user-defined operators.
+func (l *lexer) classify(t gorgo.Token) gorgo.Token {
+	if t == nil {
+		return t
 	}
-	macroFrame := sframe.GlobalFrameStack.PushNewFrame(macro.Declaration())
-	for i, variable := range bound {
-		macroFrame.Env().Def(macro.ArgsList[i].Name(), terex.Elem(variable))
+	if typ, ok := l.operators[t.Lexeme()]; ok && isMacroName(t) {
+		return MPToken{kind: typ, lexeme: t.Lexeme(), Val: t.Lexeme(), span: t.Span()}
+	}
+	return t
+}
+
+// expandMacro reads the arguments of a macro call and pushes the replacement
+// text of the macro, with its parameters bound to the arguments, to the
+// input. args may hold arguments already bound by the caller.
+func (l *lexer) expandMacro(m sframe.Macro, args map[string]string) error {
+	if l.input.depth >= maxMacroDepth || l.expansions >= maxMacroExpansions {
+		return fmt.Errorf("macro %s: expansion too deep (runaway recursion?)", m.Name())
+	}
+	l.expansions++
+	if args == nil {
+		args = make(map[string]string, len(m.ArgsList))
+	}
+	var capsules []string // value arguments
+	bind := func(p sframe.TagDeclaration, arg []rawToken) {
+		text, isValue := l.argumentText(p, arg)
+		args[p.Name()] = text
+		if isValue {
+			capsules = append(capsules, text)
+		}
+	}
+	for i := 0; i < m.Delimited; { // ( arg, arg )( arg ) …
+		if t := l.nextRaw(); t.Lexeme() != "(" {
+			return fmt.Errorf("macro %s: missing argument for %s", m.Name(), m.ArgsList[i].Name())
+		}
+		for {
+			arg, end := l.collect(func(t rawToken) bool {
+				return t.Lexeme() == "," || t.Lexeme() == ")"
+			})
+			if end.isEOF() {
+				return fmt.Errorf("macro %s: argument list not closed", m.Name())
+			} else if i == m.Delimited {
+				return fmt.Errorf("macro %s: too many arguments", m.Name())
+			}
+			bind(m.ArgsList[i], arg)
+			i++
+			if end.Lexeme() == ")" {
+				break
+			}
+		}
+	}
+	var rest string // text of a token read beyond the arguments
+	if len(m.ArgsList) > m.Delimited {
+		p := m.ArgsList[m.Delimited]
+		arg, next := l.undelimitedArgument(p.TagType())
+		if len(arg) == 0 {
+			return fmt.Errorf("macro %s: missing argument for %s", m.Name(), p.Name())
+		}
+		bind(p, arg)
+		if !next.isEOF() {
+			rest = " " + next.Lexeme()
+		}
+	}
+	tracer().Debugf("expand macro %s", m.Name())
+	l.pushText(l.evaluateFirst(capsules, substitute(m.ReplacementText(), args)) + rest)
+	return nil
+}
+
+// evaluateFirst makes sure that value arguments are evaluated when the macro
+// is called, and not at the first occurrence of their parameter, which may
+// be within a loop or may never be reached. The capsules are put in front of
+// the replacement text as statements of their own, if the text starts with
+// begingroup or the macro is called at the start of a statement. Otherwise
+// the arguments are evaluated on first use.
+func (l *lexer) evaluateFirst(capsules []string, text string) string {
+	if len(capsules) == 0 {
+		return text
 	}
-	return &nestedReader{
-		reader: bufio.NewReader(strings.NewReader(macro.ReplacementText())),
-		parent: nr,
+	stmts := strings.Join(capsules, "; ") + "; "
+	if first := NewLexer(strings.NewReader(text)).nextRaw(); first.Lexeme() == "begingroup" {
+		i := strings.Index(text, "begingroup") + len("begingroup")
+		return text[:i] + " " + stmts + text[i:]
+	} else if l.atStmt {
+		return stmts + text
 	}
+	return text
 }
 
-func bind(sym sframe.TagDecl, env *terex.Environment) sframe.Variable {
-	return sframe.Numeric{}
+// suffixPart is a component of a variable: a tag or a subscript.
+type suffixPart struct {
+	toks      []rawToken
+	subscript bool
+}
+
+// nextSuffixPart reads the next component of a variable. If the token read
+// does not start a component, ok is false and the token is returned as the
+// only token of the part.
+func (l *lexer) nextSuffixPart() (part suffixPart, ok bool) {
+	t := l.nextRaw()
+	part.toks = []rawToken{t}
+	switch {
+	case t.isEOF():
+		return part, false
+	case t.TokType() == Tag && !isSuffixParameter(t.Lexeme()):
+		_, isMacro := l.macros[t.Lexeme()]
+		return part, !isMacro
+	case t.TokType() == Unsigned || t.TokType() == ScalarMulOp:
+		part.subscript = true
+		return part, true
+	case t.Lexeme() == "[":
+		sub, end := l.collect(func(t rawToken) bool { return t.Lexeme() == "]" })
+		part.toks = append(append(part.toks, sub...), end)
+		part.subscript = true
+		return part, true
+	}
+	return part, false
+}
+
+// expandVardef expands a call of a vardef macro, i.e. a variable starting
+// with the tag of one or more vardefs. The vardef with the longest generic
+// variable matching the called variable is expanded, with
+//
+//     #@ = the components of the variable before @
+//     @  = the last component of the generic variable
+//     @# = the suffix following the generic variable (for vardef … @#)
+//
+// If no vardef matches, the tokens following the tag are pushed back to the
+// input and expanded is false.
+func (l *lexer) expandVardef(tag gorgo.Token, vardefs []sframe.Macro) (expanded bool, err error) {
+	parts := []suffixPart{{toks: []rawToken{{Token: tag}}}}
+	var best *sframe.Macro
+	var n int // number of components matched by best
+	candidates := vardefs
+	ok := true // is the last part read a component?
+	for {
+		for i, m := range candidates {
+			if len(m.Declaration().Components()) == len(parts) {
+				best, n = &candidates[i], len(parts)
+			}
+		}
+		var part suffixPart
+		part, ok = l.nextSuffixPart()
+		parts = append(parts, part)
+		if !ok {
+			break
+		}
+		var matching []sframe.Macro
+		for _, m := range candidates {
+			if c := m.Declaration().Components(); len(c) >= len(parts) &&
+				matchesComponent(c[len(parts)-1], part) {
+				matching = append(matching, m)
+			}
+		}
+		if len(matching) == 0 {
+			break
+		}
+		candidates = matching
+	}
+	if best == nil {
+		l.pushText(partsText(parts[1:]))
+		l.lastType = Tag
+		return false, nil
+	}
+	var suffix []suffixPart
+	rest := parts[n:] // parts to push back to the input
+	if best.Suffixed { // the rest of the variable is the suffix
+		for ok {
+			var part suffixPart
+			part, ok = l.nextSuffixPart()
+			parts = append(parts, part)
+		}
+		suffix, rest = parts[n:len(parts)-1], parts[len(parts)-1:]
+	}
+	l.pushText(partsText(rest))
+	args := map[string]string{
+		"#@": partsText(parts[:n-1]),
+		"@":  partsText(parts[n-1 : n]),
+		"@#": partsText(suffix),
+	}
+	return true, l.expandMacro(*best, args)
+}
+
+// matchesComponent is a predicate: does a component of a called variable
+// match a component of a generic variable?
+func matchesComponent(generic string, part suffixPart) bool {
+	if part.subscript {
+		return generic == "[]"
+	}
+	return generic == part.toks[0].Lexeme()
+}
+
+// partsText returns the text of a list of variable components.
+func partsText(parts []suffixPart) string {
+	var b strings.Builder
+	for _, part := range parts {
+		if part.toks[0].isEOF() {
+			break
+		}
+		b.WriteString(" " + tokenText(part.toks))
+	}
+	return b.String()
+}
+
+// undelimitedArgument reads the argument of an undelimited parameter. As
+// expressions are not parsed at this point, the extent of an argument is
+// determined by its tokens: a suffix consists of tags, numbers and
+// subscripts, a primary is a variable or a parenthesized expression, and
+// other arguments end at the next token which cannot be part of an
+// expression. The token following the argument is returned as well.
+func (l *lexer) undelimitedArgument(kind sframe.TagType) (arg []rawToken, next rawToken) {
+	switch kind {
+	case sframe.SparkSuffix, sframe.SparkPrimary:
+		next = l.nextRaw()
+		if kind == sframe.SparkPrimary && next.TokType() == Capsule { // capsule ( ⟨argument⟩ )
+			arg = append(arg, next)
+			next = l.nextRaw()
+		}
+		if kind == sframe.SparkPrimary && (next.Lexeme() == "(" || next.Lexeme() == "begingroup") {
+			closing := map[string]string{"(": ")", "begingroup": "endgroup"}[next.Lexeme()]
+			group, end := l.collect(func(t rawToken) bool { return t.Lexeme() == closing })
+			arg = append(append(append(arg, next), group...), end)
+			return arg, l.nextRaw()
+		}
+		for !next.isEOF() {
+			if next.Lexeme() == "[" {
+				sub, end := l.collect(func(t rawToken) bool { return t.Lexeme() == "]" })
+				arg = append(append(append(arg, next), sub...), end)
+			} else if next.TokType() == Tag || next.TokType() == Unsigned || next.TokType() == ScalarMulOp ||
+				(kind == sframe.SparkPrimary && len(arg) == 0) {
+				arg = append(arg, next)
+			} else {
+				break
+			}
+			next = l.nextRaw()
+		}
+		return arg, next
+	case sframe.SparkText:
+		return l.collect(func(t rawToken) bool {
+			return t.Lexeme() == ";" || t.Lexeme() == "endgroup" || t.Lexeme() == "enddef" || t.Lexeme() == "end"
+		})
+	}
+	return l.collect(func(t rawToken) bool {
+		switch t.Lexeme() {
+		case ";", ",", ")", "]", "}", ":", ":=", "endgroup", "fi", "else", "elseif",
+			"endfor", "enddef", "end":
+			return true
+		}
+		return false
+	})
+}
+
+// collect reads raw tokens up to a token for which stop is true, outside of
+// any brackets or groups. It returns the tokens read and the stop token.
+func (l *lexer) collect(stop func(rawToken) bool) (toks []rawToken, end rawToken) {
+	depth := 0
+	for {
+		t := l.nextRaw()
+		if t.isEOF() || (depth == 0 && stop(t)) {
+			return toks, t
+		}
+		switch t.Lexeme() {
+		case "(", "[", "{", "begingroup":
+			depth++
+		case ")", "]", "}", "endgroup":
+			if depth > 0 {
+				depth--
+			}
+		}
+		toks = append(toks, t)
+	}
+}
+
+// pushText inserts text into the input. Runes which have already been read
+// by the lexer, but are not yet part of a token, will follow the text.
+func (l *lexer) pushText(text string) {
+	text += l.stream.writer.String() // pending category sequence
+	l.stream.ResetOutput()
+	l.csq.l = 0
+	l.state = state_start
+	if l.stream.next != 0 && !l.stream.isEof { // lookahead
+		text += string(l.stream.next)
+		l.stream.next = 0
+	}
+	l.stream.isEof = false
+	l.flushed = false
+	l.input.Push(strings.NewReader(text))
+}
+
+// argumentText returns the text of an argument and if it is a value. Suffix
+// and text arguments are substituted as they are. Value arguments are bound
+// to a new capsule, which is followed by the argument in parentheses:
+//
+//     ⟨capsule⟩ ( ⟨argument⟩ )
+//
+// The evaluator will evaluate the argument of a capsule only once, no matter
+// how often the parameter occurs in the replacement text. Capsules do not
+// open a group, therefore a macro may still save variables of its caller or
+// leave a command or path unfinished.
+func (l *lexer) argumentText(param sframe.TagDeclaration, arg []rawToken) (string, bool) {
+	text := tokenText(arg)
+	switch param.TagType() {
+	case sframe.SparkSuffix, sframe.SparkText:
+		return text, false
+	}
+	l.capsules++
+	return capsuleName(l.capsules) + " (" + text + ")", true
+}
+
+// capsuleName returns the name of the n-th capsule, which is the capsule
+// mark followed by letters only, as digits would start a subscript.
+func capsuleName(n int) string {
+	name := []rune{capsuleMark}
+	for ; n > 0; n /= 26 {
+		name = append(name, rune('a'+n%26))
+	}
+	return string(name)
+}
+
+// substitute scans the replacement text of a macro and replaces its
+// parameters by the text of their arguments. Parameters may occur as parts
+// of tags, e.g. x.s for a suffix parameter s.
+func substitute(text string, args map[string]string) string {
+	var b strings.Builder
+	lex := NewLexer(strings.NewReader(text))
+	for t := lex.nextRaw(); !t.isEOF(); t = lex.nextRaw() {
+		if t.spaced {
+			b.WriteByte(' ')
+		}
+		tag, ok := t.Value().([]string)
+		if !ok || t.TokType() != Tag || !hasParameter(tag, args) {
+			b.WriteString(t.Lexeme())
+			continue
+		}
+		for i, s := range tag {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			if arg, ok := args[s]; ok {
+				b.WriteString(arg + " ")
+			} else {
+				b.WriteString(s)
+			}
+		}
+	}
+	return b.String()
+}
+
+func hasParameter(tag []string, args map[string]string) bool {
+	for _, s := range tag {
+		if _, ok := args[s]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenText reconstructs the text of a list of raw tokens.
+func tokenText(toks []rawToken) string {
+	var b strings.Builder
+	for i, t := range toks {
+		if i > 0 && t.spaced {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.Lexeme())
+	}
+	return b.String()
 }
-*/
@@ -53,17 +53,33 @@ func TestParseList(t *testing.T) {
 	parse("xpart z", true, "primary", false, t)
 	parse("a * xpart z", true, "secondary", false, t)
 	parse("x.r' < -1/4", true, "boolean_expression", false, t)
+	parse("a < b <= c", true, "boolean_expression", false, t)
+	parse("a = b", true, "boolean_expression", false, t)
+	parse("not a and b or c", true, "tertiary", false, t)
 
 	parse("numeric p", true, "declaration", false, t)
 	parse("pair p[]", true, "declaration", false, t)
 	parse("a=1", true, "equation", false, t)
 	parse("a=b=5", true, "equation", false, t)
+	parse("b = x ≤ y", true, "equation", false, t)
+	parse("s = \"a\" & str x.r", true, "equation", false, t)
+	parse("substring (0,2) of s", true, "primary", false, t)
 	parse("b = a shifted (1,2)", true, "equation", false, t)
 	parse("pair p; p = q;", true, "statement_list", false, t)
 	parse("..tension 1.2..", true, "basic_path_join", false, t)
 	parse("a = begingroup 5 endgroup", true, "equation", false, t)
 	parse("a = begingroup numeric a; 5 endgroup", true, "statement", false, t)
 	parse("save a, @$", true, "command", false, t)
+	parse("primarydef a times b = a*b enddef", true, "function_definition", false, t)
+	parse("z = (1,0) shifted (2,2) rotated 90", true, "equation", false, t)
+	parse("c = (1,0.5,0) + .5[(0,0,0,1),d]", true, "equation", false, t)
+	parse("b = cycle p and (length p > 2)", true, "equation", false, t)
+	parse("z = point 1 of reverse subpath (1,2) of p", true, "equation", false, t)
+	parse("z = point arctime arclength p / 2 of p of p", true, "equation", false, t)
+	parse("z = p intersectiontimes (q shifted (1,0))", true, "equation", false, t)
+	parse("r = p cutbefore q cutafter r", true, "equation", false, t)
+	parse("q = makepath (makepen p scaled 2)", true, "equation", false, t)
+	parse("z = ((0,0)--(1,1)) intersectiontimes ((0,1)..(1,0)..cycle)", true, "equation", false, t)
 	//
 	// TODO parse("def a = XXX enddef", true, "macro_definition", false, t)
 	// TODO parse("def a(expr x) = XXX enddef;", true, false, t)
@@ -97,6 +113,20 @@ func TestPrimaryAST(t *testing.T) {
 	compile("xpart z", "primary", t)
 }
 
+func TestNegationAST(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp.grammar")
+	defer teardown()
+	//
+	compile("-a * -(1,2) dotprod +z", "secondary", t)
+}
+
+func TestPredicateAST(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp.grammar")
+	defer teardown()
+	//
+	compile("known x and pair z.r and not cycle p", "secondary", t)
+}
+
 func TestSecondaryAST(t *testing.T) {
 	teardown := gotestingadapter.QuickConfig(t, "pmmp.grammar")
 	defer teardown()
@@ -249,6 +279,8 @@ func TestCommand(t *testing.T) {
 	defer teardown()
 	//
 	compile("save a.r, @$; pickup pencircle; show a;", "statement_list", t)
+	compile("pickup pencircle xscaled 2 rotated 30; linecap := butt;", "statement_list", t)
+	compile("randomseed := 42; a = uniformdeviate 10 + normaldeviate;", "statement_list", t)
 }
 
 func TestDraw(t *testing.T) {
@@ -256,6 +288,60 @@ func TestDraw(t *testing.T) {
 	defer teardown()
 	//
 	compile("draw a.r withcolor white withpen pensquare;", "statement_list", t)
+	compile("addto currentpicture contour p withcolor red withpen pensquare;", "statement_list", t)
+	compile("addto q also currentpicture; clip q to bbox p; setbounds q to p;", "statement_list", t)
+	compile("drawdblarrow p withpen pencircle scaled 2 withcolor blue; cutdraw q;", "statement_list", t)
+	compile("draw p dashed dashpattern(on 3 off 2) scaled 2; draw q dashed evenly;", "statement_list", t)
+	compile(`label.top("a", z1) withcolor red; dotlabel("b", (0,0)); draw thelabel.lft("c" infont "gobold", z2);`,
+		"statement_list", t)
+}
+
+func TestIfStatement(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp.grammar")
+	defer teardown()
+	//
+	ast := compile("if a<1: a=2; elseif a>5: a=5; else: a=3; b=a; fi;", "statement_list", t)
+	if ast == nil || !strings.Contains(ast.ListString(), "else") {
+		t.Errorf("expected if-statement to contain else-branch")
+	}
+}
+
+func TestConditionalPrimary(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp.grammar")
+	defer teardown()
+	//
+	compile("if a<1: b else: c fi", "primary", t)
+}
+
+func TestLoops(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp.grammar")
+	defer teardown()
+	//
+	compile("for i=1 upto 3: a[i]=i; endfor;", "statement_list", t)
+	compile("for i=1 step 2 until 7: a[i]=i; endfor;", "statement_list", t)
+	compile("for v=a,b,c: v=1; endfor;", "statement_list", t)
+	compile("forsuffixes s=l,r: x.s=1; endfor;", "statement_list", t)
+	compile("forever: a:=a-1; exitif a<0; endfor;", "statement_list", t)
+}
+
+func TestPathSegments(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp.grammar")
+	defer teardown()
+	//
+	compile("p := z0 for i=1 upto 5: .. z[i] endfor .. cycle;", "statement_list", t)
+	compile("p := z0 if a<1: --z1 else: ..z2 fi ..z3;", "statement_list", t)
+}
+
+func TestMacroCapsules(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp.grammar")
+	defer teardown()
+	//
+	ast := compile("def inc(expr x) = a := a + x enddef; inc(3);", "statement_list", t)
+	if ast == nil || !strings.Contains(ast.ListString(), "capsule") {
+		t.Errorf("expected macro argument to be bound to a capsule")
+	}
+	compile("def drawred(expr p) = draw p withcolor enddef; drawred(q) red;", "statement_list", t)
+	compile("def via(expr z) = .. z .. enddef; p := z0 via(z1) z2;", "statement_list", t)
 }
 
 // ---------------------------------------------------------------------------
@@ -27,6 +27,7 @@ const (
 	SymTok          gorgo.TokType = -9
 	Unsigned        gorgo.TokType = -10
 	Signed          gorgo.TokType = -11
+	Capsule         gorgo.TokType = -12
 	UnaryOp         gorgo.TokType = -15
 	NullaryOp       gorgo.TokType = -16
 	PrimaryOp       gorgo.TokType = -17
@@ -50,23 +51,31 @@ const (
 
 // The tokens representing literal one-char lexemes
 var literals = []string{
-	";", "(", ")", "[", "]", "{", "}", ",", "=",
+	";", ":", "(", ")", "[", "]", "{", "}", ",", "=",
 }
 var types = []string{
-	"boolean", "cmycolor", "color", "numeric", "pair", "path", "pen",
+	"boolean", "cmykcolor", "color", "numeric", "pair", "path", "pen",
 	"picture", "rgbcolor", "string", "transform",
 }
 var unaryOps = []string{ // TODO
-	"abs", "angle",
+	"abs", "angle", "not", "known", "unknown",
+	"sqrt", "sind", "cosd", "mlog", "mexp", "floor", "ceiling", "round",
+	"dir", "unitvector", "uniformdeviate",
+	"ASCII", "char", "decimal", "length",
+	"reverse", "turningnumber", "arclength",
+	"makepen", "makepath",
+	"llcorner", "lrcorner", "ulcorner", "urcorner", "center", "bbox",
 	//
-	"xpart", "ypart", "yellowpart",
+	"xpart", "ypart", "xxpart", "xypart", "yxpart", "yypart", "inverse",
+	"redpart", "greenpart", "bluepart",
+	"cyanpart", "magentapart", "yellowpart", "blackpart",
 }
 var nullOps = []string{
-	"false", "normaldeviate", "nullpen", "nullpicture",
-	"pencircle", "true", "whatever",
+	"false", "identity", "normaldeviate", "nullpen", "nullpicture",
+	"pencircle", "pensquare", "true", "whatever",
 }
-var primOps = []string{`*`, `/`, `**`, "and", "dotprod", "div", "mod"}
-var secOps = []string{`++`, `+-+`, "or", "intersectionpoint"}
+var primOps = []string{`*`, `/`, `**`, "and", "dotprod", "div", "mod", "infont"}
+var secOps = []string{`++`, `+-+`, "or", "intersectionpoint", "intersectiontimes"}
 var sign = []string{`+`, `-`}
 var relOps = []string{
 	`==`, `<`, `>`, `≤`, `≥`, `≠`, `<=`, `>=`, `<>`,
@@ -104,15 +113,19 @@ var keywords = []string{ // TODO
 	"of",
 	`[]`,
 	"begingroup", "endgroup",
-	"picture", "end",
-	"tension", "and", "controls", "curl",
-	"pickup", "save", "show",
+	"end",
+	"tension", "and", "controls", "curl", "cycle",
+	"pickup", "save", "show", "str", "randomseed",
 	"def", "vardef", "enddef",
 	"expr", "suffix",
 	"primary", "secondary", "tertiary",
 	"primarydef", "secondarydef", "tertiarydef",
-	"if", "fi", "else:", "elseif",
+	"if", "fi", "else", "elseif",
 	"for", "endfor", "forsuffixes", "forever", "upto", "downto", "step", "until",
+	"exitif", "exitunless",
+	"addto", "also", "contour", "doublepath", "clip", "setbounds", "to",
+	"dashpattern", "on", "off",
+	"label", "dotlabel", "thelabel",
 }
 
 // All of the tokens (including literals and keywords)
@@ -123,6 +136,39 @@ var keywords = []string{ // TODO
 // tokenTypeFromLexeme will be set in initTokens()
 var tokenTypeFromLexeme map[string]gorgo.TokType // A map from the token names to their int ids
 
+// tokenCategories maps the names of token categories, as used in the grammar,
+// to their token types. Category names are not lexemes and therefore are kept
+// separate from tokenTypeFromLexeme.
+var tokenCategories = map[string]gorgo.TokType{
+	"TAG":             Tag,
+	"STRING":          String,
+	"SymTok":          SymTok,
+	"Unsigned":        Unsigned,
+	"Signed":          Signed,
+	"Capsule":         Capsule,
+	"UnaryOp":         UnaryOp,
+	"NullaryOp":       NullaryOp,
+	"PrimaryOp":       PrimaryOp,
+	"SecondaryOp":     SecondaryOp,
+	"RelationOp":      RelationOp,
+	"AssignOp":        AssignOp,
+	"OfOp":            OfOp,
+	"UnaryTransform":  UnaryTransform,
+	"BinaryTransform": BinaryTransform,
+	"PlusOrMinus":     PlusOrMinus,
+	"Type":            Type,
+	"PseudoOp":        PseudoOp,
+	"Function":        Function,
+	"Join":            Join,
+	"DrawCmd":         DrawCmd,
+	"DrawOption":      DrawOption,
+	"ScalarMulOp":     ScalarMulOp,
+	"MacroDef":        MacroDef,
+	"Keyword":         Keyword,
+	"Dir":             PseudoOp,
+	"Array":           PseudoOp,
+}
+
 var initOnce sync.Once // monitors one-time initialization
 
 func initTokens() {
@@ -288,6 +334,9 @@ func S(lexeme string) (string, int) {
 	if t, ok := tokenTypeFromLexeme[lexeme]; ok { // is a keyword
 		return lexeme, int(t)
 	}
+	if t, ok := tokenCategories[lexeme]; ok { // is a token category
+		return lexeme, int(t)
+	}
 	panic(fmt.Sprintf("did not find token value for lexeme '%s'", lexeme))
 	//return lexeme, tokenIds["TAG"] // this should not happen
 }
@@ -334,7 +383,13 @@ func makeLMToken(tokcat string, lexeme string) *terex.Token {
 }
 */
 func makeLMToken(tokcat string, lexeme string) gorgo.Token {
-	panic("TODO: create tokens during term rewriting")
+	t, ok := tokenCategories[tokcat]
+	if !ok {
+		if t, ok = tokenTypeFromLexeme[tokcat]; !ok {
+			panic(fmt.Sprintf("cannot create token for unknown category %q", tokcat))
+		}
+	}
+	return MakeMPToken(t, lexeme, lexeme)
 }
 
 /*
@@ -3,6 +3,7 @@ package grammar
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"strings"
 	"testing"
@@ -181,6 +182,25 @@ func TestLexerNextToken(t *testing.T) {
 	}
 }
 
+func TestLexerStrings(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp.grammar")
+	defer teardown()
+	//
+	initTokens()
+	input := `s = "a b" & "" & "x%y";`
+	expect := []string{"a b", "", "x%y"}
+	lex := NewLexer(bufio.NewReader(strings.NewReader(input)))
+	var values []string
+	for token := lex.NextToken(); token != nil && token.TokType() != EOF; token = lex.NextToken() {
+		if token.TokType() == String {
+			values = append(values, token.Value().(string))
+		}
+	}
+	if strings.Join(values, "|") != strings.Join(expect, "|") {
+		t.Errorf("expected strings %q, have %q", expect, values)
+	}
+}
+
 func TestLexerMacroDef(t *testing.T) {
 	teardown := gotestingadapter.QuickConfig(t, "pmmp.grammar")
 	defer teardown()
@@ -200,6 +220,128 @@ func TestLexerMacroDef(t *testing.T) {
 	}
 }
 
+func TestLexerMacroExpansion(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp.grammar")
+	defer teardown()
+	//
+	initTokens()
+	for i, x := range []struct {
+		input  string
+		expect string
+	}{
+		{input: "def inc(expr x) = a := a + x enddef; inc(3);", expect: "; ⟦1⟧ ( 3 ) ; a := a + ⟦1⟧ ( 3 ) ;"},
+		{input: "def p(suffix s)(text t) = x.s t enddef; p(l)(:= 1);", expect: "; x l := 1 ;"},
+		{input: "def twice text t = t; t enddef; twice a := a+1;", expect: "; a := a + 1 ; a := a + 1 ;"},
+		{input: "def sq primary x = x*x enddef; b = sq a + 1;", expect: "; b = ⟦1⟧ ( a ) * ⟦1⟧ ( a ) + 1 ;"},
+		{input: "def f(expr x) = begingroup x endgroup enddef; b = f(2);",
+			expect: "; b = begingroup ⟦1⟧ ( 2 ) ; ⟦1⟧ ( 2 ) endgroup ;"},
+		{input: "def f(expr x) = x enddef; b = if c: f(1) else: 2 fi;",
+			expect: "; b = if c : ⟦1⟧ ( 1 ) else : 2 fi ;"},
+		{input: "def f(expr x) = draw x enddef; if c: f(p); fi;",
+			expect: "; if c : ⟦1⟧ ( p ) ; draw ⟦1⟧ ( p ) ; fi ;"},
+		{input: "def sq primary x = x*x enddef; def f(expr y) = sq y enddef; b = f(a);",
+			expect: "; ; b = ⟦1⟧ ( ⟦2⟧ ( a ) ) * ⟦1⟧ ( ⟦2⟧ ( a ) ) ;"},
+		{input: "def via(expr z) = .. z .. enddef; p = a via(b) c;", expect: "; p = a .. ⟦1⟧ ( b ) .. c ;"},
+	} {
+		lex := NewLexer(bufio.NewReader(strings.NewReader(x.input)))
+		lex.SetErrorHandler(func(e error) {
+			t.Errorf("test %d: %v", i, e)
+		})
+		var lexemes []string
+		capsules := make(map[string]string) // capsule names are numbered ⟦1⟧, ⟦2⟧, …
+		for token := lex.NextToken(); token != nil && token.TokType() != EOF; token = lex.NextToken() {
+			lexeme := token.Lexeme()
+			if token.TokType() == Capsule {
+				if _, ok := capsules[lexeme]; !ok {
+					capsules[lexeme] = fmt.Sprintf("⟦%d⟧", len(capsules)+1)
+				}
+				lexeme = capsules[lexeme]
+			}
+			lexemes = append(lexemes, lexeme)
+		}
+		if s := strings.Join(lexemes, " "); s != x.expect {
+			t.Errorf("test %d: expected %q, have %q", i, x.expect, s)
+		}
+	}
+}
+
+func TestLexerVardef(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp.grammar")
+	defer teardown()
+	//
+	initTokens()
+	for i, x := range []struct {
+		input  string
+		expect string
+	}{
+		{input: "vardef z@#(expr a) = x@# + a enddef; w = z1.left(3);",
+			expect: "; w = begingroup ⟦1⟧ ( 3 ) ; x 1 left + ⟦1⟧ ( 3 ) endgroup ;"},
+		{input: "vardef dir primary d = right rotated d enddef; a = dir 30;",
+			expect: "; a = begingroup ⟦1⟧ ( 30 ) ; right rotated ⟦1⟧ ( 30 ) endgroup ;"},
+		{input: "vardef p[]q = show #@; show @ enddef; a = p3q; c = p3;",
+			expect: "; a = begingroup show p 3 ; show q endgroup ; c = p 3 ;"},
+		{input: "vardef a.b = 1 enddef; vardef a@# = @# enddef; x = a.b + a.c;",
+			expect: "; ; x = begingroup 1 endgroup + begingroup c endgroup ;"},
+		{input: "vardef whatever = save ?; ? enddef; z = whatever;",
+			expect: "; z = begingroup save ? ; ? endgroup ;"},
+	} {
+		lex := NewLexer(bufio.NewReader(strings.NewReader(x.input)))
+		lex.SetErrorHandler(func(e error) {
+			t.Errorf("test %d: %v", i, e)
+		})
+		var lexemes []string
+		capsules := make(map[string]string)
+		for token := lex.NextToken(); token != nil && token.TokType() != EOF; token = lex.NextToken() {
+			lexeme := token.Lexeme()
+			if token.TokType() == Capsule {
+				if _, ok := capsules[lexeme]; !ok {
+					capsules[lexeme] = fmt.Sprintf("⟦%d⟧", len(capsules)+1)
+				}
+				lexeme = capsules[lexeme]
+			}
+			lexemes = append(lexemes, lexeme)
+		}
+		if s := strings.Join(lexemes, " "); s != x.expect {
+			t.Errorf("test %d: expected %q, have %q", i, x.expect, s)
+		}
+	}
+}
+
+func TestLexerOperatorDef(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp.grammar")
+	defer teardown()
+	//
+	initTokens()
+	input := "secondarydef a plus b = a+b enddef; x = u plus v;"
+	lex := NewLexer(bufio.NewReader(strings.NewReader(input)))
+	var types []gorgo.TokType
+	for token := lex.NextToken(); token != nil && token.TokType() != EOF; token = lex.NextToken() {
+		if token.Lexeme() == "plus" {
+			types = append(types, token.TokType())
+		}
+	}
+	if len(types) != 2 || types[0] != Tag || types[1] != SecondaryOp {
+		t.Errorf("expected plus to be a tag in the heading and an operator afterwards, have %v", types)
+	}
+}
+
+func TestLexerMacroRecursion(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp.grammar")
+	defer teardown()
+	//
+	initTokens()
+	lex := NewLexer(bufio.NewReader(strings.NewReader("def f = f + 1 enddef; x = f;")))
+	var err error
+	lex.SetErrorHandler(func(e error) {
+		err = e
+	})
+	for token := lex.NextToken(); token != nil && token.TokType() != EOF; token = lex.NextToken() {
+	}
+	if err == nil {
+		t.Error("expected runaway recursion to be reported")
+	}
+}
+
 /*
 func TestScanner(t *testing.T) {
 	teardown := gotestingadapter.QuickConfig(t, "tyse.fonts")
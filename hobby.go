@@ -0,0 +1,412 @@
+package pmmp
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/npillmayer/arithm"
+)
+
+// --- Hobby's algorithm -----------------------------------------------------
+
+// This is an implementation of John Hobby's algorithm for choosing the
+// control points of a path, as done by MetaFont and MetaPost. It follows
+// the description in "MetaFont: The Program", §§ 255–302, with scaled
+// arithmetic replaced by floats and angles given in radians. The variable
+// names stick closely to the original.
+
+// knotType is the type of one side of a knot, in MetaFont's order.
+type knotType int8
+
+const (
+	endpoint knotType = iota // end of an open path
+	explicit                 // control point given explicitly or already chosen
+	given                    // direction given
+	curl                     // curl given
+	open                     // nothing given yet
+	endCycle                 // marks a cycle without breakpoints
+)
+
+// infinity is MetaPost's tension for ---.
+const infinity = 4095.99998
+
+// knot is a knot of a path, together with the parameters of the curves to
+// its left and to its right.
+type knot struct {
+	z                  arithm.Pair
+	ltype, rtype       knotType
+	lgiven, rgiven     float64 // direction angle, for given
+	lcurl, rcurl       float64 // curl, for curl
+	ltension, rtension float64 // tension, negative for "at least"
+	lcontrol, rcontrol arithm.Pair
+}
+
+// hobby collects the knots of a path and chooses the control points.
+type hobby struct {
+	knots []knot
+	cycle bool
+}
+
+// findControls chooses the control points for the joins of a path. It
+// returns the control points of join i as entry i.
+func findControls(knots []arithm.Pair, joins []Join, cycle bool) ([][2]arithm.Pair, error) {
+	h := &hobby{knots: make([]knot, len(knots)), cycle: cycle}
+	for i, z := range knots {
+		h.knots[i] = knot{z: z, ltype: open, rtype: open, ltension: 1, rtension: 1}
+	}
+	if err := h.setup(joins); err != nil {
+		return nil, err
+	}
+	h.makeChoices()
+	controls := make([][2]arithm.Pair, len(joins))
+	for i := range joins {
+		controls[i] = [2]arithm.Pair{h.knots[i].rcontrol, h.knot(i + 1).lcontrol}
+	}
+	return controls, nil
+}
+
+// knot returns knot i, modulo the number of knots.
+func (h *hobby) knot(i int) *knot {
+	return &h.knots[i%len(h.knots)]
+}
+
+// setup transfers the parameters of the joins to the knots. A direction
+// given on one side of a knot applies to the other side as well, if
+// nothing is given there.
+func (h *hobby) setup(joins []Join) error {
+	for i, j := range joins {
+		p, q := h.knot(i), h.knot(i+1)
+		for _, t := range j.Tension {
+			if t < 0.75 {
+				return fmt.Errorf("improper tension %g", t)
+			}
+		}
+		p.rtension, q.ltension = j.Tension[0], j.Tension[1]
+		switch j.Type {
+		case "...": // tension atleast 1
+			p.rtension, q.ltension = -p.rtension, -q.ltension
+		case "---": // tension infinity
+			p.rtension, q.ltension = infinity, infinity
+		}
+		if len(j.Controls) == 2 {
+			p.rtype, p.rcontrol = explicit, j.Controls[0]
+			q.ltype, q.lcontrol = explicit, j.Controls[1]
+			continue
+		}
+		pre, post := j.Pre, j.Post
+		if j.Type == "--" { // {curl 1}..{curl 1}
+			if pre.Kind == DirAuto {
+				pre = Direction{Kind: DirCurl, Curl: 1}
+			}
+			if post.Kind == DirAuto {
+				post = Direction{Kind: DirCurl, Curl: 1}
+			}
+		}
+		var err error
+		if p.rtype, p.rgiven, p.rcurl, err = direction(pre); err != nil {
+			return err
+		}
+		if q.ltype, q.lgiven, q.lcurl, err = direction(post); err != nil {
+			return err
+		}
+	}
+	if !h.cycle {
+		first, last := h.knot(0), h.knot(len(h.knots)-1)
+		first.ltype, last.rtype = endpoint, endpoint
+		if first.rtype == open {
+			first.rtype, first.rcurl = curl, 1
+		}
+		if last.ltype == open {
+			last.ltype, last.lcurl = curl, 1
+		}
+	}
+	for i := range h.knots {
+		k := &h.knots[i]
+		if k.rtype == open && (k.ltype == curl || k.ltype == given) {
+			k.rtype, k.rgiven, k.rcurl = k.ltype, k.lgiven, k.lcurl
+		}
+		if k.ltype == open && (k.rtype == curl || k.rtype == given) {
+			k.ltype, k.lgiven, k.lcurl = k.rtype, k.rgiven, k.rcurl
+		}
+	}
+	return nil
+}
+
+// direction converts a direction specifier into a knot type and its
+// parameter. A zero direction vector is the same as no direction.
+func direction(d Direction) (knotType, float64, float64, error) {
+	switch d.Kind {
+	case DirGiven:
+		if d.Dir.X() != 0 || d.Dir.Y() != 0 {
+			return given, math.Atan2(d.Dir.Y(), d.Dir.X()), 0, nil
+		}
+	case DirCurl:
+		if d.Curl < 0 {
+			return open, 0, 0, fmt.Errorf("improper curl %g", d.Curl)
+		}
+		return curl, 0, d.Curl, nil
+	}
+	return open, 0, 0, nil
+}
+
+// makeChoices chooses the control points for all joins which do not have
+// explicit ones (§§ 269–272). The path is broken into stretches between
+// breakpoints, i.e., knots with something given on either side, and the
+// angles for every stretch are found by solving a system of equations.
+func (h *hobby) makeChoices() {
+	n := len(h.knots)
+	last := n
+	if !h.cycle {
+		last = n - 1
+	}
+	for i := 0; i < last; i++ { // if consecutive knots are equal, join them explicitly
+		p, q := h.knot(i), h.knot(i+1)
+		if p.z == q.z && p.rtype > explicit {
+			p.rtype, p.rcontrol = explicit, p.z
+			if p.ltype == open {
+				p.ltype, p.lcurl = curl, 1
+			}
+			q.ltype, q.lcontrol = explicit, p.z
+			if q.rtype == open {
+				q.rtype, q.rcurl = curl, 1
+			}
+		}
+	}
+	h0 := 0 // find the first breakpoint
+	for h.knot(h0).ltype == open && h.knot(h0).rtype == open {
+		h0++
+		if h0 == n {
+			h0 = 0
+			h.knot(h0).ltype = endCycle
+			break
+		}
+	}
+	p := h0
+	for {
+		q := p + 1
+		if h.knot(p).rtype >= given {
+			for h.knot(q).ltype == open && h.knot(q).rtype == open {
+				q++
+			}
+			h.solveChoices(p, q-p)
+		}
+		p = q
+		if p%n == h0 {
+			break
+		}
+	}
+}
+
+// solveChoices chooses the control points for the stretch of n curves
+// between breakpoints p and p+n (§§ 273–293).
+func (h *hobby) solveChoices(p, n int) {
+	at := func(k int) *knot { return h.knot(p + k) }
+	dx, dy := make([]float64, n+2), make([]float64, n+2)
+	delta, psi := make([]float64, n+2), make([]float64, n+2)
+	k := 0
+	for { // calculate the turning angles ψ
+		s, t := at(k), at(k+1)
+		dx[k], dy[k] = t.z.X()-s.z.X(), t.z.Y()-s.z.Y()
+		delta[k] = math.Hypot(dx[k], dy[k])
+		if k > 0 {
+			sine, cosine := dy[k-1]/delta[k-1], dx[k-1]/delta[k-1]
+			psi[k] = math.Atan2(dy[k]*cosine-dx[k]*sine, dx[k]*cosine+dy[k]*sine)
+		}
+		k++
+		if k >= n && (at(k).ltype != endCycle || k > n) {
+			break
+		}
+	}
+	if k == n {
+		psi[n] = 0
+	} else {
+		psi[k] = psi[1]
+	}
+	q, s := at(n), at(0) // remove open types at the breakpoints
+	if q.ltype == open {
+		h.openToGiven(&q.ltype, &q.lgiven, &q.lcurl, q.rcontrol-q.z)
+	}
+	if s.rtype == open && s.ltype == explicit {
+		h.openToGiven(&s.rtype, &s.rgiven, &s.rcurl, s.z-s.lcontrol)
+	}
+	theta := make([]float64, n+1)
+	uu, vv, ww := make([]float64, n+1), make([]float64, n+1), make([]float64, n+1)
+	var r *knot
+loop:
+	for k = 0; ; k++ {
+		s, t := at(k), at(k+1)
+		if k == 0 { // get the linear equations started
+			switch s.rtype {
+			case given:
+				if t.ltype == given {
+					aa := math.Atan2(dy[0], dx[0])
+					st, ct := math.Sincos(s.rgiven - aa)
+					sf, cf := math.Sincos(t.lgiven - aa)
+					setControls(s, t, dx[0], dy[0], st, ct, -sf, cf)
+					return
+				}
+				vv[0] = reduceAngle(s.rgiven - math.Atan2(dy[0], dx[0]))
+				uu[0], ww[0] = 0, 0
+			case curl:
+				if t.ltype == curl {
+					straightLine(s, t)
+					return
+				}
+				uu[0] = curlRatio(s.rcurl, math.Abs(s.rtension), math.Abs(t.ltension))
+				vv[0], ww[0] = -psi[1]*uu[0], 0
+			case open: // this begins a cycle
+				uu[0], vv[0], ww[0] = 0, 0, 1
+			}
+			r = s
+			continue
+		}
+		switch s.ltype {
+		case endCycle, open: // match mock curvatures at z_k
+			var aa, bb, dd, ee float64
+			if rt := math.Abs(r.rtension); rt == 1 {
+				aa, dd = 0.5, 2*delta[k]
+			} else {
+				aa, dd = 1/(3*rt-1), delta[k]*(3-1/rt)
+			}
+			if lt := math.Abs(t.ltension); lt == 1 {
+				bb, ee = 0.5, 2*delta[k-1]
+			} else {
+				bb, ee = 1/(3*lt-1), delta[k-1]*(3-1/lt)
+			}
+			cc := 1 - uu[k-1]*aa
+			dd *= cc
+			if lt, rt := math.Abs(s.ltension), math.Abs(s.rtension); lt < rt {
+				dd *= (lt / rt) * (lt / rt)
+			} else if lt > rt {
+				ee *= (rt / lt) * (rt / lt)
+			}
+			ff := ee / (ee + dd)
+			uu[k] = ff * bb
+			acc := -psi[k+1] * uu[k]
+			if r.rtype == curl {
+				ww[k] = 0
+				vv[k] = acc - psi[1]*(1-ff)
+			} else {
+				ff = (1 - ff) / cc
+				acc -= psi[k] * ff
+				ff *= aa
+				vv[k] = acc - vv[k-1]*ff
+				ww[k] = -ww[k-1] * ff
+			}
+			if s.ltype == endCycle { // adjust θ_n to equal θ_0
+				aa, bb = 0, 1
+				for j := n - 1; ; j-- {
+					if j == 0 {
+						j = n
+					}
+					aa = vv[j] - aa*uu[j]
+					bb = ww[j] - bb*uu[j]
+					if j == n {
+						break
+					}
+				}
+				aa /= 1 - bb
+				theta[n], vv[0] = aa, aa
+				for j := 1; j < n; j++ {
+					vv[j] += aa * ww[j]
+				}
+				break loop
+			}
+		case curl:
+			ff := curlRatio(s.lcurl, math.Abs(s.ltension), math.Abs(r.rtension))
+			theta[n] = -(vv[n-1] * ff) / (1 - ff*uu[n-1])
+			break loop
+		case given:
+			theta[n] = reduceAngle(s.lgiven - math.Atan2(dy[n-1], dx[n-1]))
+			break loop
+		}
+		r = s
+	}
+	for k = n - 1; k >= 0; k-- {
+		theta[k] = vv[k] - theta[k+1]*uu[k]
+	}
+	for k = 0; k < n; k++ {
+		st, ct := math.Sincos(theta[k])
+		sf, cf := math.Sincos(-psi[k+1] - theta[k+1])
+		setControls(at(k), at(k+1), dx[k], dy[k], st, ct, sf, cf)
+	}
+}
+
+// openToGiven turns an open side of a breakpoint into a given direction d,
+// or into a curl of 1 if d is zero.
+func (h *hobby) openToGiven(typ *knotType, dir, c *float64, d arithm.Pair) {
+	if d.X() == 0 && d.Y() == 0 {
+		*typ, *c = curl, 1
+		return
+	}
+	*typ, *dir = given, math.Atan2(d.Y(), d.X())
+}
+
+// setControls sets the control points between knots p and q, given the
+// sine and cosine of θ and φ (§ 299).
+func setControls(p, q *knot, dx, dy, st, ct, sf, cf float64) {
+	rr := velocity(st, ct, sf, cf, math.Abs(p.rtension))
+	ss := velocity(sf, cf, st, ct, math.Abs(q.ltension))
+	if p.rtension < 0 || q.ltension < 0 { // stay inside the bounding triangle
+		if (st >= 0 && sf >= 0) || (st <= 0 && sf <= 0) {
+			sine := math.Abs(st)*cf + math.Abs(sf)*ct
+			if sine > 0 {
+				sine *= 1 + 1.0/4096 // safety factor
+				if p.rtension < 0 && math.Abs(sf) < rr*sine {
+					rr = math.Abs(sf) / sine
+				}
+				if q.ltension < 0 && math.Abs(st) < ss*sine {
+					ss = math.Abs(st) / sine
+				}
+			}
+		}
+	}
+	p.rcontrol = p.z + arithm.P((dx*ct-dy*st)*rr, (dy*ct+dx*st)*rr)
+	q.lcontrol = q.z - arithm.P((dx*cf+dy*sf)*ss, (dy*cf-dx*sf)*ss)
+	p.rtype, q.ltype = explicit, explicit
+}
+
+// straightLine sets the control points between knots p and q for a curve
+// with a curl on both ends (§ 302).
+func straightLine(p, q *knot) {
+	d := q.z - p.z
+	p.rcontrol = p.z + d*arithm.P(1/(3*math.Abs(p.rtension)), 0)
+	q.lcontrol = q.z - d*arithm.P(1/(3*math.Abs(q.ltension)), 0)
+	p.rtype, q.ltype = explicit, explicit
+}
+
+// velocity is Hobby's velocity function ρ/3, limited to 4 (§ 116).
+func velocity(st, ct, sf, cf, t float64) float64 {
+	num := 2 + math.Sqrt2*(st-sf/16)*(sf-st/16)*(ct-cf)
+	denom := 3 + 1.5*(math.Sqrt(5)-1)*ct + 1.5*(3-math.Sqrt(5))*cf
+	if t != 1 {
+		num /= t
+	}
+	if num/4 >= denom {
+		return 4
+	}
+	return num / denom
+}
+
+// curlRatio is the ratio of θ and φ at a knot with curl γ, given the
+// tensions of the curve, limited to 4 (§ 296).
+func curlRatio(gamma, atension, btension float64) float64 {
+	alpha, beta := 1/atension, 1/btension
+	num := gamma*alpha*alpha*(3-alpha) + beta*beta*beta
+	denom := gamma*alpha*alpha*alpha + (3-beta)*beta*beta
+	if num >= 4*denom {
+		return 4
+	}
+	return num / denom
+}
+
+// reduceAngle reduces an angle to the range -π…π.
+func reduceAngle(a float64) float64 {
+	if math.Abs(a) > math.Pi {
+		if a > 0 {
+			return a - 2*math.Pi
+		}
+		return a + 2*math.Pi
+	}
+	return a
+}
@@ -0,0 +1,88 @@
+package pmmp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/npillmayer/arithm"
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+)
+
+func TestHobbyControls(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp")
+	defer teardown()
+	//
+	curve, line := NewJoin(".."), NewJoin("--")
+	upDown := NewJoin("..")
+	upDown.Pre = Direction{Kind: DirGiven, Dir: arithm.P(0, 1)}
+	upDown.Post = Direction{Kind: DirGiven, Dir: arithm.P(0, -1)}
+	tense := upDown
+	tense.Tension = [2]float64{2, 2}
+	explicit := NewJoin("..")
+	explicit.Controls = []arithm.Pair{arithm.P(1, 2), arithm.P(3, 4)}
+	// expected control points are the ones chosen by MetaPost
+	for i, c := range []struct {
+		knots  []arithm.Pair
+		joins  []Join
+		cycle  bool
+		j      int // join to check
+		c1, c2 arithm.Pair
+	}{
+		{[]arithm.Pair{arithm.P(0, 0), arithm.P(1, 1)}, []Join{curve}, false,
+			0, arithm.P(0.33333, 0.33333), arithm.P(0.66667, 0.66667)},
+		{[]arithm.Pair{arithm.P(0, 0), arithm.P(3, 0)}, []Join{line}, false,
+			0, arithm.P(1, 0), arithm.P(2, 0)},
+		{[]arithm.Pair{arithm.P(0, 0), arithm.P(1, 0)}, []Join{upDown}, false,
+			0, arithm.P(0, 0.66667), arithm.P(1, 0.66667)},
+		{[]arithm.Pair{arithm.P(0, 0), arithm.P(1, 0)}, []Join{tense}, false,
+			0, arithm.P(0, 0.33333), arithm.P(1, 0.33333)},
+		{[]arithm.Pair{arithm.P(0, 0), arithm.P(10, 10), arithm.P(20, 0)}, []Join{curve, curve}, false,
+			1, arithm.P(15.52285, 10), arithm.P(20, 5.52285)},
+		{[]arithm.Pair{arithm.P(1, 1), arithm.P(2, 2), arithm.P(3, 1), arithm.P(2, 0)},
+			[]Join{curve, curve, curve, curve}, true,
+			3, arithm.P(1.44772, 0), arithm.P(1, 0.44772)},
+		{[]arithm.Pair{arithm.P(0, 0), arithm.P(5, 0)}, []Join{explicit}, false,
+			0, arithm.P(1, 2), arithm.P(3, 4)},
+		{[]arithm.Pair{arithm.P(2, 2), arithm.P(2, 2)}, []Join{curve}, false,
+			0, arithm.P(2, 2), arithm.P(2, 2)},
+	} {
+		p, err := NewPath(c.knots, c.joins, c.cycle)
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		c1, c2 := p.Controls(c.j)
+		if !near(c1, c.c1) || !near(c2, c.c2) {
+			t.Errorf("test %d: expected controls %v and %v, have %v and %v", i, c.c1, c.c2, c1, c2)
+		}
+	}
+}
+
+func TestHobbyErrors(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp")
+	defer teardown()
+	//
+	slack := NewJoin("..")
+	slack.Tension = [2]float64{0.5, 1}
+	curly := NewJoin("..")
+	curly.Pre = Direction{Kind: DirCurl, Curl: -1}
+	for _, j := range []Join{slack, curly} {
+		if _, err := NewPath([]arithm.Pair{arithm.P(0, 0), arithm.P(1, 1)}, []Join{j}, false); err == nil {
+			t.Errorf("expected join %v to be rejected", j)
+		}
+	}
+}
+
+func TestReduceAngle(t *testing.T) {
+	for _, c := range [][2]float64{
+		{0, 0}, {math.Pi / 2, math.Pi / 2}, {3 * math.Pi / 2, -math.Pi / 2}, {-5 * math.Pi / 2, -math.Pi / 2},
+	} {
+		if a := reduceAngle(c[0]); math.Abs(a-c[1]) > 1e-9 {
+			t.Errorf("expected reduceAngle(%g) = %g, is %g", c[0], c[1], a)
+		}
+	}
+}
+
+func near(a, b arithm.Pair) bool {
+	return math.Abs(a.X()-b.X()) < 1e-4 && math.Abs(a.Y()-b.Y()) < 1e-4
+}
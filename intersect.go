@@ -0,0 +1,161 @@
+package pmmp
+
+import (
+	"math"
+
+	"github.com/npillmayer/arithm"
+)
+
+// --- Intersections ---------------------------------------------------------
+
+// IntersectionTimes returns times (t,u) with point t of p equal to point u of
+// q, or (-1,-1) if the paths do not intersect.
+//
+// If there are several intersections, the one chosen is the one MetaPost
+// would choose: joins of p are tried in order, and for each of them the
+// joins of q. Within a pair of joins, the intersection with the smallest
+// times is found in the sense of interleaved binary digits, i.e. first
+// halves are preferred over second halves, on p before on q.
+func (p Path) IntersectionTimes(q Path) (float64, float64) {
+	if !p.IsKnown() || !q.IsKnown() {
+		return -1, -1
+	}
+	tol := intersectionTolerance(p, q)
+	for i, b := range p.segments() {
+		for j, c := range q.segments() {
+			x := intersector{tol: tol, patience: maxPatience}
+			if t, u, ok := x.find(b, c, 0, 0, 1, 0); ok {
+				return float64(i) + t, float64(j) + u
+			}
+		}
+	}
+	return -1, -1
+}
+
+// IntersectionPoint returns the point where two paths intersect, as chosen
+// by IntersectionTimes. The flag is false if the paths do not intersect.
+func (p Path) IntersectionPoint(q Path) (arithm.Pair, bool) {
+	t, u := p.IntersectionTimes(q)
+	if t < 0 {
+		return 0, false
+	}
+	return (p.Point(t) + q.Point(u)) / 2, true
+}
+
+// CutBefore returns p with the part before its intersection with q removed.
+// If the paths do not intersect, p is returned unchanged.
+func (p Path) CutBefore(q Path) Path {
+	t, _ := p.IntersectionTimes(q)
+	if t < 0 {
+		return p
+	}
+	return p.Subpath(t, float64(p.Length()))
+}
+
+// CutAfter returns p with the part after its last intersection with q
+// removed. If the paths do not intersect, p is returned unchanged.
+func (p Path) CutAfter(q Path) Path {
+	t, _ := p.Reverse().IntersectionTimes(q)
+	if t < 0 {
+		return p
+	}
+	return p.Subpath(0, float64(p.Length())-t)
+}
+
+// segments returns the Bézier curves of the joins of a path. A path
+// consisting of a single knot is a degenerate curve.
+func (p Path) segments() []bezier {
+	if len(p.controls) == 0 {
+		z := p.knots[0]
+		return []bezier{{z, z, z, z}}
+	}
+	segs := make([]bezier, len(p.controls))
+	for i := range segs {
+		segs[i] = p.bezier(i)
+	}
+	return segs
+}
+
+// Limits of the bisection of curves: the maximum depth, and the maximum
+// number of pairs of curve parts examined for a single pair of joins, after
+// which overlapping parts are accepted as an intersection. The patience is
+// MetaPost's.
+const (
+	maxBisection = 48
+	maxPatience  = 5000
+)
+
+// intersector finds the first intersection of two curves by bisection.
+type intersector struct {
+	tol      float64 // extent of parts considered to be points
+	patience int     // remaining number of part pairs to examine
+}
+
+// find looks for an intersection of curves b and c, which are parts of
+// larger curves starting at times t0 and u0, respectively, with a size of
+// the time interval of size.
+func (x *intersector) find(b, c bezier, t0, u0, size float64, depth int) (float64, float64, bool) {
+	x.patience--
+	bmin, bmax := b.bbox()
+	cmin, cmax := c.bbox()
+	if bmin.X() > cmax.X()+x.tol || cmin.X() > bmax.X()+x.tol ||
+		bmin.Y() > cmax.Y()+x.tol || cmin.Y() > bmax.Y()+x.tol {
+		return 0, 0, false
+	}
+	small := func(min, max arithm.Pair) bool {
+		return max.X()-min.X() <= x.tol && max.Y()-min.Y() <= x.tol
+	}
+	if depth >= maxBisection || x.patience <= 0 || small(bmin, bmax) && small(cmin, cmax) {
+		return t0 + size/2, u0 + size/2, true
+	}
+	half := size / 2
+	b1, b2 := b.halves()
+	c1, c2 := c.halves()
+	for _, h := range [4]struct {
+		b, c   bezier
+		dt, du float64
+	}{
+		{b1, c1, 0, 0}, {b1, c2, 0, half}, {b2, c1, half, 0}, {b2, c2, half, half},
+	} {
+		if t, u, ok := x.find(h.b, h.c, t0+h.dt, u0+h.du, half, depth+1); ok {
+			return t, u, true
+		}
+	}
+	return 0, 0, false
+}
+
+// intersectionTolerance returns the extent below which parts of curves of
+// paths p and q are considered to be points. Near a tangent point two curves
+// approach each other quadratically, so positions cannot be told apart more
+// precisely than the square root of the float resolution, relative to the
+// size of the coordinates.
+func intersectionTolerance(p, q Path) float64 {
+	scale := 1.0
+	for _, knots := range [2][]arithm.Pair{p.knots, q.knots} {
+		for _, z := range knots {
+			scale = math.Max(scale, math.Max(math.Abs(z.X()), math.Abs(z.Y())))
+		}
+	}
+	return scale * math.Sqrt(epsilon)
+}
+
+// epsilon is the resolution of float64 numbers, i.e. the difference between
+// 1 and the next larger number.
+const epsilon = 0x1p-52
+
+// halves splits a curve at time 1/2.
+func (b bezier) halves() (bezier, bezier) {
+	return b.split(0.5), b.reverse().split(0.5).reverse()
+}
+
+// bbox returns the lower left and upper right corner of the bounding box of
+// the control polygon of a curve, which contains the curve.
+func (b bezier) bbox() (arithm.Pair, arithm.Pair) {
+	minx, miny := b[0].X(), b[0].Y()
+	maxx, maxy := minx, miny
+	for _, z := range b[1:] {
+		minx, maxx = math.Min(minx, z.X()), math.Max(maxx, z.X())
+		miny, maxy = math.Min(miny, z.Y()), math.Max(maxy, z.Y())
+	}
+	return arithm.P(minx, miny), arithm.P(maxx, maxy)
+}
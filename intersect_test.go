@@ -0,0 +1,109 @@
+package pmmp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/npillmayer/arithm"
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+)
+
+func TestIntersectionTimes(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp")
+	defer teardown()
+	//
+	circle := makePath(t, "..", true, arithm.P(1, 0), arithm.P(0, 1), arithm.P(-1, 0), arithm.P(0, -1))
+	for i, c := range []struct {
+		p, q  Path
+		t, u  float64
+		delta float64 // accuracy of the times
+	}{
+		{ // crossing lines
+			makePath(t, "--", false, arithm.P(0, 0), arithm.P(2, 2)), makePath(t, "--", false, arithm.P(0, 2), arithm.P(2, 0)),
+			0.5, 0.5, 1e-6,
+		},
+		{ // no intersection
+			makePath(t, "--", false, arithm.P(0, 0), arithm.P(1, 0)), makePath(t, "--", false, arithm.P(0, 1), arithm.P(1, 1)),
+			-1, -1, 0,
+		},
+		{ // the second join of p hits the first join of q
+			makePath(t, "--", false, arithm.P(0, 0), arithm.P(1, 0), arithm.P(1, 2)), makePath(t, "--", false, arithm.P(0, 1), arithm.P(2, 1)),
+			1.5, 0.5, 1e-6,
+		},
+		{ // line tangent to the circle at its top knot
+			circle, makePath(t, "--", false, arithm.P(-2, 1), arithm.P(2, 1)),
+			1, 0.5, 1e-3,
+		},
+		{ // overlapping lines: the first point of the overlap on p
+			makePath(t, "--", false, arithm.P(0, 0), arithm.P(2, 0)), makePath(t, "--", false, arithm.P(1, 0), arithm.P(3, 0)),
+			0.5, 0, 1e-6,
+		},
+		{ // a path overlaps itself everywhere
+			circle, circle,
+			0, 0, 1e-6,
+		},
+	} {
+		tp, tq := c.p.IntersectionTimes(c.q)
+		if math.Abs(tp-c.t) > c.delta || math.Abs(tq-c.u) > c.delta {
+			t.Errorf("test %d: expected intersection times (%g,%g), have (%g,%g)", i, c.t, c.u, tp, tq)
+		}
+	}
+}
+
+func TestIntersectionPoint(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp")
+	defer teardown()
+	//
+	circle := makePath(t, "..", true, arithm.P(1, 0), arithm.P(0, 1), arithm.P(-1, 0), arithm.P(0, -1))
+	z, ok := circle.IntersectionPoint(makePath(t, "--", false, arithm.P(-2, 1), arithm.P(2, 1)))
+	if !ok || math.Abs(z.X()) > 1e-3 || math.Abs(z.Y()-1) > 1e-6 {
+		t.Errorf("expected the tangent to touch the circle at (0,1), have %v", z)
+	}
+	if _, ok = circle.IntersectionPoint(makePath(t, "--", false, arithm.P(-2, 2), arithm.P(2, 2))); ok {
+		t.Errorf("expected the circle not to intersect a line above it")
+	}
+}
+
+func TestCuts(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp")
+	defer teardown()
+	//
+	p := makePath(t, "--", false, arithm.P(0, 0), arithm.P(4, 0))
+	arc := NewJoin("..") // crosses p twice, at x = 2 ∓ 0.95258
+	arc.Controls = []arithm.Pair{arithm.P(1, -3), arithm.P(3, -3)}
+	q, err := NewPath([]arithm.Pair{arithm.P(1, 1), arithm.P(3, 1)}, []Join{arc}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	miss := makePath(t, "--", false, arithm.P(0, 5), arithm.P(1, 5))
+	for i, c := range []struct {
+		r          Path
+		start, end arithm.Pair
+	}{
+		{p.CutBefore(q), arithm.P(1.04742, 0), arithm.P(4, 0)},
+		{p.CutAfter(q), arithm.P(0, 0), arithm.P(2.95258, 0)},
+		{p.CutBefore(miss), arithm.P(0, 0), arithm.P(4, 0)},
+		{p.CutAfter(miss), arithm.P(0, 0), arithm.P(4, 0)},
+	} {
+		if !near(c.r.Point(0), c.start) || !near(c.r.Point(float64(c.r.Length())), c.end) {
+			t.Errorf("test %d: expected path from %v to %v, have %v", i, c.start, c.end, c.r)
+		}
+	}
+}
+
+// makePath creates a path of joins of a single type.
+func makePath(t *testing.T, typ string, cycle bool, knots ...arithm.Pair) Path {
+	n := len(knots) - 1
+	if cycle {
+		n++
+	}
+	joins := make([]Join, n)
+	for i := range joins {
+		joins[i] = NewJoin(typ)
+	}
+	p, err := NewPath(knots, joins, cycle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -0,0 +1,414 @@
+package pmmp
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/npillmayer/arithm"
+)
+
+// --- Path ------------------------------------------------------------------
+
+// Path is a path value. A path consists of knots, connected by joins. Join i
+// connects knot i with knot i+1. A cyclic path has an additional join from
+// the last knot back to the first one.
+//
+// Every join is a cubic Bézier curve. Its control points are chosen by John
+// Hobby's algorithm when the path is created, unless they are given
+// explicitly.
+//
+// The zero value is an unknown path.
+type Path struct {
+	knots    []arithm.Pair
+	joins    []Join
+	controls [][2]arithm.Pair // control points of join i
+	cycle    bool
+}
+
+// DirKind is the kind of a direction specifier.
+type DirKind int8
+
+// Kinds of direction specifiers
+const (
+	DirAuto  DirKind = iota // no direction given, use MetaPost's default
+	DirGiven                // explicit direction vector, e.g. {up}
+	DirCurl                 // curl value, e.g. {curl 1}
+)
+
+// Direction is a direction specifier at either end of a join.
+type Direction struct {
+	Kind DirKind
+	Dir  arithm.Pair // direction vector, for DirGiven
+	Curl float64     // curl value, for DirCurl
+}
+
+// Join is the connection between two consecutive knots of a path, as given
+// in a path expression.
+type Join struct {
+	Type     string        // "..", "...", "--" or "---"
+	Pre      Direction     // direction specifier leaving the first knot
+	Post     Direction     // direction specifier entering the second knot
+	Tension  [2]float64    // tension at the first and the second knot
+	Controls []arithm.Pair // explicit control points, if given
+}
+
+// NewJoin creates a join of a given type with default tensions of 1 and
+// without direction specifiers.
+func NewJoin(typ string) Join {
+	return Join{Type: typ, Tension: [2]float64{1, 1}}
+}
+
+// NewPath creates a path from its knots and joins. For n knots, n-1 joins
+// have to be provided for an open path and n joins for a cyclic path.
+// Control points of the joins will be chosen as MetaPost does. Tensions have
+// to be at least 3/4 and curls must not be negative.
+func NewPath(knots []arithm.Pair, joins []Join, cycle bool) (Path, error) {
+	if len(knots) == 0 {
+		return Path{}, fmt.Errorf("path without knots")
+	}
+	n := len(knots) - 1
+	if cycle {
+		n++
+	}
+	if len(joins) != n {
+		return Path{}, fmt.Errorf("path with %d knots needs %d joins, have %d", len(knots), n, len(joins))
+	}
+	controls, err := findControls(knots, joins, cycle)
+	if err != nil {
+		return Path{}, err
+	}
+	return Path{knots: knots, joins: joins, controls: controls, cycle: cycle}, nil
+}
+
+// Self returns this path, wrapped into a ValueBase struct.
+func (p Path) Self() ValueBase {
+	return ValueBase{p}
+}
+
+// IsKnown is a predicate: is this a known value? Paths are either completely
+// known or unknown.
+func (p Path) IsKnown() bool {
+	return len(p.knots) > 0
+}
+
+// Type returns PathType.
+func (p Path) Type() ValueType {
+	return PathType
+}
+
+// N returns the number of knots of a path.
+func (p Path) N() int {
+	return len(p.knots)
+}
+
+// Knot returns knot i of a path.
+func (p Path) Knot(i int) arithm.Pair {
+	return p.knots[i]
+}
+
+// Join returns the join leaving knot i.
+func (p Path) Join(i int) Join {
+	return p.joins[i]
+}
+
+// Controls returns the control points of the join leaving knot i.
+func (p Path) Controls(i int) (arithm.Pair, arithm.Pair) {
+	return p.controls[i][0], p.controls[i][1]
+}
+
+// ExplicitJoin returns the join leaving knot i with its control points made
+// explicit. Joins of this kind keep the shape of a curve when paths are
+// concatenated.
+func (p Path) ExplicitJoin(i int) Join {
+	j := NewJoin("..")
+	j.Controls = []arithm.Pair{p.controls[i][0], p.controls[i][1]}
+	return j
+}
+
+// IsCycle is a predicate: is this a cyclic path?
+func (p Path) IsCycle() bool {
+	return p.cycle
+}
+
+// Equal is a predicate: are two known paths equal? As in MetaPost, paths are
+// equal if they have the same knots and control points and are either both
+// cyclic or both open.
+func (p Path) Equal(q Path) bool {
+	if len(p.knots) != len(q.knots) || len(p.controls) != len(q.controls) || p.cycle != q.cycle {
+		return false
+	}
+	for i, z := range p.knots {
+		if !z.Equal(q.knots[i]) {
+			return false
+		}
+	}
+	for i, c := range p.controls {
+		if !c[0].Equal(q.controls[i][0]) || !c[1].Equal(q.controls[i][1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// --- Path queries ----------------------------------------------------------
+
+// Length returns the number of joins of a path, which is MetaPost's length of
+// a path. Times on a path range from 0 to its length, with integer times
+// denoting knots.
+func (p Path) Length() int {
+	return len(p.joins)
+}
+
+// Point returns the point of a path at time t.
+func (p Path) Point(t float64) arithm.Pair {
+	k, f := p.splitTime(t)
+	if f == 0 {
+		return p.knot(k)
+	}
+	b := p.bezier(k).split(f)
+	return b[3]
+}
+
+// PreControl returns the control point of a path in front of time t.
+func (p Path) PreControl(t float64) arithm.Pair {
+	k, f := p.splitTime(t)
+	if f == 0 {
+		if k == 0 && !p.cycle {
+			return p.knot(0)
+		}
+		return p.controls[(k+p.Length()-1)%p.Length()][1]
+	}
+	b := p.bezier(k).split(f)
+	return b[2]
+}
+
+// PostControl returns the control point of a path after time t.
+func (p Path) PostControl(t float64) arithm.Pair {
+	k, f := p.splitTime(t)
+	if f == 0 {
+		if k == p.Length() && !p.cycle {
+			return p.knot(k)
+		}
+		return p.controls[k%p.Length()][0]
+	}
+	b := p.bezier(k).reverse().split(1 - f)
+	return b[2]
+}
+
+// Direction returns the direction of a path at time t, i.e. its post-control
+// point minus its pre-control point.
+func (p Path) Direction(t float64) arithm.Pair {
+	return p.PostControl(t) - p.PreControl(t)
+}
+
+// Subpath returns the part of a path between times a and b. If a > b, the
+// subpath is reversed. The result is an open path.
+func (p Path) Subpath(a, b float64) Path {
+	if a > b {
+		return p.Subpath(b, a).Reverse()
+	}
+	n := float64(p.Length())
+	if p.cycle && n > 0 {
+		shift := math.Floor(a/n) * n
+		a, b = a-shift, b-shift
+	} else {
+		a, b = math.Max(0, math.Min(a, n)), math.Max(0, math.Min(b, n))
+	}
+	var knots []arithm.Pair
+	var controls [][2]arithm.Pair
+	z := p.Point(a)
+	for t := a; t < b; {
+		k := math.Floor(t)
+		end := math.Min(k+1, b)
+		seg := p.bezier(int(k)).part(t-k, end-k)
+		knots = append(knots, seg[0])
+		controls = append(controls, [2]arithm.Pair{seg[1], seg[2]})
+		z, t = seg[3], end
+	}
+	return explicitPath(append(knots, z), controls, false)
+}
+
+// Reverse returns a path with the order of its knots reversed. Time t on the
+// reversed path corresponds to time length-t on the original path.
+func (p Path) Reverse() Path {
+	n := p.Length()
+	knots := make([]arithm.Pair, len(p.knots))
+	for k := range knots {
+		knots[k] = p.knots[(n-k+len(p.knots))%len(p.knots)]
+	}
+	controls := make([][2]arithm.Pair, n)
+	for k := range controls {
+		c := p.controls[n-1-k]
+		controls[k] = [2]arithm.Pair{c[1], c[0]}
+	}
+	return explicitPath(knots, controls, p.cycle)
+}
+
+// TurningNumber returns the number of counter-clockwise turns of a cyclic
+// path, calculated from its control polygon, as MetaPost does. Open paths
+// have a turning number of 0.
+func (p Path) TurningNumber() int {
+	if !p.cycle {
+		return 0
+	}
+	var edges []arithm.Pair
+	for i := range p.controls {
+		b := p.bezier(i)
+		for j := 0; j < 3; j++ {
+			if e := b[j+1] - b[j]; e != 0 {
+				edges = append(edges, e)
+			}
+		}
+	}
+	turn := 0.0
+	for i, e := range edges {
+		d := edges[(i+1)%len(edges)]
+		turn += math.Atan2(e.X()*d.Y()-e.Y()*d.X(), e.X()*d.X()+e.Y()*d.Y())
+	}
+	return int(math.Round(turn / (2 * math.Pi)))
+}
+
+// Transformed applies a known transform to a path. The shape of the joins
+// is kept by transforming their control points, which become explicit.
+func (p Path) Transformed(t Transform) (Path, error) {
+	if !t.IsKnown() {
+		return Path{}, fmt.Errorf("cannot transform a path by an unknown transform")
+	}
+	if !p.IsKnown() {
+		return Path{}, fmt.Errorf("cannot transform an unknown path")
+	}
+	_, apply := t.affine()
+	knots := make([]arithm.Pair, len(p.knots))
+	for i, z := range p.knots {
+		knots[i] = apply(z)
+	}
+	controls := make([][2]arithm.Pair, len(p.controls))
+	for i, c := range p.controls {
+		controls[i] = [2]arithm.Pair{apply(c[0]), apply(c[1])}
+	}
+	return explicitPath(knots, controls, p.cycle), nil
+}
+
+// BBox returns the lower left and upper right corner of the bounding box of
+// a path. The box is tight, i.e. it touches the curves of the path, not just
+// their control points.
+func (p Path) BBox() (arithm.Pair, arithm.Pair) {
+	if !p.IsKnown() {
+		return 0, 0
+	}
+	var box boundingBox
+	for _, b := range p.segments() {
+		box = box.union(b.bounds())
+	}
+	return box.ll, box.ur
+}
+
+// splitTime splits a time on a path into a knot and a fraction of the join
+// leaving it. Times on cyclic paths are taken modulo the length of the path,
+// times on open paths are limited to the range of the path.
+func (p Path) splitTime(t float64) (int, float64) {
+	n := float64(p.Length())
+	if n == 0 {
+		return 0, 0
+	}
+	if p.cycle {
+		if t = math.Mod(t, n); t < 0 {
+			t += n
+		}
+	} else if t = math.Max(0, math.Min(t, n)); t == n {
+		return int(n), 0
+	}
+	k := math.Floor(t)
+	return int(k), t - k
+}
+
+// knot returns knot k, modulo the number of knots.
+func (p Path) knot(k int) arithm.Pair {
+	return p.knots[k%len(p.knots)]
+}
+
+// bezier returns the cubic Bézier curve of join i.
+func (p Path) bezier(i int) bezier {
+	i %= len(p.controls)
+	return bezier{p.knots[i], p.controls[i][0], p.controls[i][1], p.knot(i + 1)}
+}
+
+// explicitPath creates a path from knots and their control points, with
+// explicit joins.
+func explicitPath(knots []arithm.Pair, controls [][2]arithm.Pair, cycle bool) Path {
+	joins := make([]Join, len(controls))
+	for i, c := range controls {
+		joins[i] = NewJoin("..")
+		joins[i].Controls = []arithm.Pair{c[0], c[1]}
+	}
+	return Path{knots: knots, joins: joins, controls: controls, cycle: cycle}
+}
+
+// bezier is a cubic Bézier curve, given by its start point, two control
+// points and its end point.
+type bezier [4]arithm.Pair
+
+// split returns the part of a curve from time 0 to time t, using de
+// Casteljau's algorithm.
+func (b bezier) split(t float64) bezier {
+	lerp := func(a, b arithm.Pair) arithm.Pair {
+		return a + (b-a)*arithm.P(t, 0)
+	}
+	a1, a2, a3 := lerp(b[0], b[1]), lerp(b[1], b[2]), lerp(b[2], b[3])
+	b1, b2 := lerp(a1, a2), lerp(a2, a3)
+	return bezier{b[0], a1, b1, lerp(b1, b2)}
+}
+
+// part returns the part of a curve between times t0 ≤ t1.
+func (b bezier) part(t0, t1 float64) bezier {
+	if t1 < 1 {
+		b = b.split(t1)
+	}
+	if t0 > 0 {
+		b = b.reverse().split(1 - t0/t1).reverse()
+	}
+	return b
+}
+
+// reverse returns a curve with start and end swapped.
+func (b bezier) reverse() bezier {
+	return bezier{b[3], b[2], b[1], b[0]}
+}
+
+func (p Path) String() string {
+	if !p.IsKnown() {
+		return "<unknown path>"
+	}
+	var b strings.Builder
+	for i, z := range p.knots {
+		if i > 0 {
+			b.WriteString(" and ")
+			writePoint(&b, p.controls[i-1][1])
+			b.WriteString("..")
+		}
+		writePoint(&b, z)
+		if i < len(p.controls) {
+			b.WriteString("..controls ")
+			writePoint(&b, p.controls[i][0])
+		}
+	}
+	if p.cycle {
+		b.WriteString(" and ")
+		writePoint(&b, p.controls[len(p.controls)-1][1])
+		b.WriteString("..cycle")
+	}
+	return b.String()
+}
+
+func writePoint(b *strings.Builder, z arithm.Pair) {
+	b.WriteString(fmt.Sprintf("(%g,%g)", roundScaled(z.X()), roundScaled(z.Y())))
+}
+
+// roundScaled rounds x to 5 decimal places, as MetaPost shows numbers.
+func roundScaled(x float64) float64 {
+	if r := math.Round(x*1e5) / 1e5; r != 0 {
+		return r
+	}
+	return 0 // avoid printing -0
+}
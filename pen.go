@@ -0,0 +1,285 @@
+package pmmp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/npillmayer/arithm"
+)
+
+// --- Pen -------------------------------------------------------------------
+
+// Pen is a pen value. Pens are either elliptical or polygonal. Elliptical
+// pens are pencircle, a circle of diameter 1, transformed by a known
+// transform. Polygonal pens are convex polygons, created from the knots of
+// a path by makepen.
+//
+// The zero value is an unknown pen.
+type Pen struct {
+	elliptical bool
+	t          [6]float64    // tx, ty, txx, txy, tyx, tyy of an elliptical pen
+	vertices   []arithm.Pair // vertices of a polygonal pen, counter-clockwise
+}
+
+// PenCircle returns pencircle, an elliptical pen of diameter 1.
+func PenCircle() Pen {
+	return Pen{elliptical: true, t: [6]float64{0, 0, 1, 0, 0, 1}}
+}
+
+// NullPen returns nullpen, a polygonal pen consisting of the origin only.
+func NullPen() Pen {
+	return Pen{vertices: []arithm.Pair{0}}
+}
+
+// PenSquare returns pensquare, a polygonal pen in the shape of the unit
+// square centered at the origin.
+func PenSquare() Pen {
+	return Pen{vertices: []arithm.Pair{
+		arithm.P(-.5, -.5), arithm.P(.5, -.5), arithm.P(.5, .5), arithm.P(-.5, .5),
+	}}
+}
+
+// MakePen creates a polygonal pen from the convex hull of the knots of a
+// path.
+func MakePen(p Path) (Pen, error) {
+	if !p.IsKnown() {
+		return Pen{}, fmt.Errorf("makepen needs a known path")
+	}
+	return Pen{vertices: convexHull(p.knots)}, nil
+}
+
+// Self returns this pen, wrapped into a ValueBase struct.
+func (p Pen) Self() ValueBase {
+	return ValueBase{p}
+}
+
+// IsKnown is a predicate: is this a known value? Pens are either completely
+// known or unknown.
+func (p Pen) IsKnown() bool {
+	return p.elliptical || len(p.vertices) > 0
+}
+
+// Type returns PenType.
+func (p Pen) Type() ValueType {
+	return PenType
+}
+
+// IsElliptical is a predicate: is this a transformed pencircle?
+func (p Pen) IsElliptical() bool {
+	return p.elliptical
+}
+
+// Equal is a predicate: are two known pens equal? Elliptical pens are equal
+// if they are transformed by the same transform, polygonal pens if they have
+// the same vertices.
+func (p Pen) Equal(q Pen) bool {
+	if p.elliptical != q.elliptical || len(p.vertices) != len(q.vertices) {
+		return false
+	}
+	for i, t := range p.t {
+		if !arithm.Is0(t - q.t[i]) {
+			return false
+		}
+	}
+	for i, z := range p.vertices {
+		if !z.Equal(q.vertices[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Transformed applies a known transform to a pen. Polygonal pens stay
+// convex polygons, elliptical pens stay ellipses.
+func (p Pen) Transformed(t Transform) (Pen, error) {
+	if !t.IsKnown() {
+		return Pen{}, fmt.Errorf("cannot transform a pen by an unknown transform")
+	}
+	u, apply := t.affine()
+	if p.elliptical {
+		shift := apply(arithm.P(p.t[0], p.t[1]))
+		return Pen{elliptical: true, t: [6]float64{
+			shift.X(), shift.Y(),
+			u[2]*p.t[2] + u[3]*p.t[4], u[2]*p.t[3] + u[3]*p.t[5],
+			u[4]*p.t[2] + u[5]*p.t[4], u[4]*p.t[3] + u[5]*p.t[5],
+		}}, nil
+	}
+	vertices := make([]arithm.Pair, len(p.vertices))
+	for i, z := range p.vertices {
+		vertices[i] = apply(z)
+	}
+	return Pen{vertices: convexHull(vertices)}, nil
+}
+
+// MakePath returns the outline of a pen as a cyclic path. Elliptical pens
+// have eight knots, starting at the image of (0.5,0). Polygonal pens have
+// straight joins between their vertices.
+func (p Pen) MakePath() Path {
+	if !p.elliptical {
+		controls := make([][2]arithm.Pair, len(p.vertices))
+		for i, z := range p.vertices {
+			controls[i] = [2]arithm.Pair{z, p.vertices[(i+1)%len(p.vertices)]}
+		}
+		return explicitPath(append([]arithm.Pair(nil), p.vertices...), controls, true)
+	}
+	d := 4.0 / 3 * math.Tan(math.Pi/16) // control distance for arcs of 45°
+	knots := make([]arithm.Pair, 8)
+	controls := make([][2]arithm.Pair, 8)
+	for k := range knots {
+		a, b := float64(k)*math.Pi/4, float64(k+1)*math.Pi/4
+		z, w := arithm.P(math.Cos(a)/2, math.Sin(a)/2), arithm.P(math.Cos(b)/2, math.Sin(b)/2)
+		knots[k] = p.apply(z)
+		controls[k] = [2]arithm.Pair{
+			p.apply(z + arithm.P(-z.Y(), z.X())*arithm.P(d, 0)),
+			p.apply(w - arithm.P(-w.Y(), w.X())*arithm.P(d, 0)),
+		}
+	}
+	return explicitPath(knots, controls, true)
+}
+
+// Offset returns MetaPost's penoffset w of p, i.e. the point on the outline
+// of the pen where a line in direction w touches it with the pen to its
+// left.
+func (p Pen) Offset(w arithm.Pair) arithm.Pair {
+	right := arithm.P(w.Y(), -w.X()) // w rotated by -90°
+	if p.elliptical {
+		// maximize right⋅(L⋅u) for |u| = 1/2, with L the linear part
+		n := arithm.P(p.t[2]*right.X()+p.t[4]*right.Y(), p.t[3]*right.X()+p.t[5]*right.Y())
+		l := math.Hypot(n.X(), n.Y())
+		if l == 0 {
+			return arithm.P(p.t[0], p.t[1])
+		}
+		return p.apply(n * arithm.P(0.5/l, 0))
+	}
+	best, max := p.vertices[0], math.Inf(-1)
+	for _, z := range p.vertices {
+		if d := z.X()*right.X() + z.Y()*right.Y(); d > max {
+			best, max = z, d
+		}
+	}
+	return best
+}
+
+// BBox returns the lower left and upper right corner of the bounding box of
+// a pen.
+func (p Pen) BBox() (arithm.Pair, arithm.Pair) {
+	if p.elliptical {
+		half := arithm.P(math.Hypot(p.t[2], p.t[3])/2, math.Hypot(p.t[4], p.t[5])/2)
+		center := arithm.P(p.t[0], p.t[1])
+		return center - half, center + half
+	}
+	var box boundingBox
+	for _, z := range p.vertices {
+		box = box.union(pointBox(z))
+	}
+	return box.ll, box.ur
+}
+
+// apply maps a point of pencircle to the outline of an elliptical pen.
+func (p Pen) apply(z arithm.Pair) arithm.Pair {
+	return arithm.P(p.t[0]+p.t[2]*z.X()+p.t[3]*z.Y(), p.t[1]+p.t[4]*z.X()+p.t[5]*z.Y())
+}
+
+func (p Pen) String() string {
+	if !p.IsKnown() {
+		return "<unknown pen>"
+	}
+	if p.elliptical {
+		var t [6]interface{}
+		for i, x := range p.t {
+			t[i] = roundScaled(x)
+		}
+		return fmt.Sprintf("pencircle transformed (%g,%g,%g,%g,%g,%g)", t[:]...)
+	}
+	var b strings.Builder
+	b.WriteString("makepen(")
+	for i, z := range p.vertices {
+		if i > 0 {
+			b.WriteString("--")
+		}
+		writePoint(&b, z)
+	}
+	b.WriteString("--cycle)")
+	return b.String()
+}
+
+// LineCap is the shape of the ends of open paths stroked with a pen, as set
+// by MetaPost's internal variable linecap.
+type LineCap int8
+
+// Line caps, with the values of MetaPost's butt, rounded and squared
+const (
+	ButtCap LineCap = iota
+	RoundCap
+	SquareCap
+)
+
+// LineJoin is the shape of the corners of paths stroked with a pen, as set
+// by MetaPost's internal variable linejoin.
+type LineJoin int8
+
+// Line joins, with the values of MetaPost's mitered, rounded and beveled
+const (
+	MiterJoin LineJoin = iota
+	RoundJoin
+	BevelJoin
+)
+
+// Stroke holds the attributes which output formats need to stroke a path:
+// the pen, the shapes of line ends and corners, and the dash pattern.
+type Stroke struct {
+	Pen        Pen
+	Cap        LineCap
+	Join       LineJoin
+	MiterLimit float64
+	Dash       Dash
+}
+
+// Equal is a predicate: are two strokes equal?
+func (s Stroke) Equal(t Stroke) bool {
+	return s.Pen.Equal(t.Pen) && s.Cap == t.Cap && s.Join == t.Join &&
+		arithm.Is0(s.MiterLimit-t.MiterLimit) && s.Dash.Equal(t.Dash)
+}
+
+// convexHull returns the vertices of the convex hull of a set of points in
+// counter-clockwise order, starting with the lowest of the leftmost points,
+// using Andrew's monotone chain algorithm.
+func convexHull(points []arithm.Pair) []arithm.Pair {
+	pts := append([]arithm.Pair(nil), points...)
+	sort.Slice(pts, func(i, j int) bool {
+		if pts[i].X() != pts[j].X() {
+			return pts[i].X() < pts[j].X()
+		}
+		return pts[i].Y() < pts[j].Y()
+	})
+	unique := pts[:0]
+	for i, z := range pts {
+		if i == 0 || z != unique[len(unique)-1] {
+			unique = append(unique, z)
+		}
+	}
+	pts = unique
+	cross := func(o, a, b arithm.Pair) float64 {
+		return (a.X()-o.X())*(b.Y()-o.Y()) - (a.Y()-o.Y())*(b.X()-o.X())
+	}
+	var hull []arithm.Pair
+	for pass := 0; pass < 2; pass++ { // lower hull, then upper hull
+		start := len(hull)
+		for _, z := range pts {
+			for len(hull) >= start+2 && cross(hull[len(hull)-2], hull[len(hull)-1], z) <= 0 {
+				hull = hull[:len(hull)-1]
+			}
+			hull = append(hull, z)
+		}
+		hull = hull[:len(hull)-1] // last point is the first of the other half
+		for i, j := 0, len(pts)-1; i < j; i, j = i+1, j-1 {
+			pts[i], pts[j] = pts[j], pts[i]
+		}
+	}
+	if len(hull) == 0 { // all points coincide
+		hull = pts[:1]
+	}
+	return hull
+}
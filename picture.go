@@ -0,0 +1,429 @@
+package pmmp
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/npillmayer/arithm"
+)
+
+// --- Picture ---------------------------------------------------------------
+
+// Picture is a picture value: an ordered list of components, which output
+// formats paint one after the other. Components are filled contours, stroked
+// paths and texts. Clipping and setting the bounds of a picture wrap its
+// components into a component of their own.
+//
+// Pictures are immutable: operations on a picture return a new picture.
+//
+// The zero value is an unknown picture.
+type Picture struct {
+	known      bool
+	components []Component
+}
+
+// ComponentKind is the kind of a component of a picture.
+type ComponentKind int8
+
+// Kinds of picture components
+const (
+	FillComponent   ComponentKind = iota // filled contour, stroked as well if it has a pen
+	StrokeComponent                      // path stroked with a pen
+	TextComponent                        // text typeset in a font
+	ClipComponent                        // components clipped to a contour
+	BoundsComponent                      // components with their bounding box set to a contour
+)
+
+// Component is a component of a picture.
+type Component struct {
+	Kind       ComponentKind
+	Path       Path        // contour, stroked path, clipping path or bounds
+	Color      Color       // color of fills, strokes and texts
+	Stroke     *Stroke     // pen and line attributes; nil for fills without a pen
+	Text       Text        // for text components
+	Placement  Transform   // maps text coordinates to picture coordinates
+	Components []Component // enclosed components of clip and bounds components
+}
+
+// Text is a string typeset in a font, as contained in text components. Its
+// extent is given by the width, height and depth of the typeset string.
+type Text struct {
+	Chars                string
+	Font                 string
+	Width, Height, Depth float64
+}
+
+// NullPicture returns nullpicture, the known picture without components.
+func NullPicture() Picture {
+	return Picture{known: true}
+}
+
+// Self returns this picture, wrapped into a ValueBase struct.
+func (p Picture) Self() ValueBase {
+	return ValueBase{p}
+}
+
+// IsKnown is a predicate: is this a known value? Pictures are either
+// completely known or unknown.
+func (p Picture) IsKnown() bool {
+	return p.known
+}
+
+// Type returns PictureType.
+func (p Picture) Type() ValueType {
+	return PictureType
+}
+
+// Components returns the components of a picture in painting order.
+func (p Picture) Components() []Component {
+	return append([]Component(nil), p.components...)
+}
+
+// Equal is a predicate: are two known pictures equal? Pictures are equal if
+// they consist of equal components in the same order.
+func (p Picture) Equal(q Picture) bool {
+	return p.known == q.known && equalComponents(p.components, q.components)
+}
+
+// Also is MetaPost's addto p also q: the components of q are added on top of
+// the components of p.
+func (p Picture) Also(q Picture) (Picture, error) {
+	if !p.known || !q.known {
+		return Picture{}, fmt.Errorf("addto also needs known pictures")
+	}
+	return p.add(q.components...), nil
+}
+
+// AddContour is MetaPost's addto contour: a cyclic path is added as a filled
+// contour. If a stroke is given, the contour is stroked as well.
+func (p Picture) AddContour(c Path, color Color, stroke *Stroke) (Picture, error) {
+	if err := p.checkContour("addto contour", c); err != nil {
+		return Picture{}, err
+	}
+	return p.add(Component{Kind: FillComponent, Path: c, Color: color, Stroke: stroke}), nil
+}
+
+// AddDoublePath is MetaPost's addto doublepath: a path is added, to be
+// stroked with a pen.
+func (p Picture) AddDoublePath(q Path, color Color, stroke Stroke) (Picture, error) {
+	if !p.known || !q.IsKnown() {
+		return Picture{}, fmt.Errorf("addto doublepath needs a known picture and path")
+	}
+	return p.add(Component{Kind: StrokeComponent, Path: q, Color: color, Stroke: &stroke}), nil
+}
+
+// AddText adds a text, with a known transform placing it into the picture.
+func (p Picture) AddText(text Text, placement Transform, color Color) (Picture, error) {
+	if !p.known || !placement.IsKnown() {
+		return Picture{}, fmt.Errorf("adding a text needs a known picture and placement")
+	}
+	return p.add(Component{Kind: TextComponent, Text: text, Placement: placement, Color: color}), nil
+}
+
+// Clipped is MetaPost's clip p to c: the picture is clipped to the inside
+// of a cyclic path.
+func (p Picture) Clipped(c Path) (Picture, error) {
+	if err := p.checkContour("clip", c); err != nil {
+		return Picture{}, err
+	}
+	return Picture{known: true, components: []Component{
+		{Kind: ClipComponent, Path: c, Components: p.components},
+	}}, nil
+}
+
+// Bounded is MetaPost's setbounds p to c: the bounding box of the picture
+// becomes the bounding box of a cyclic path.
+func (p Picture) Bounded(c Path) (Picture, error) {
+	if err := p.checkContour("setbounds", c); err != nil {
+		return Picture{}, err
+	}
+	return Picture{known: true, components: []Component{
+		{Kind: BoundsComponent, Path: c, Components: p.components},
+	}}, nil
+}
+
+// Restyled returns a picture with the colors of all its components replaced
+// by c, the pens of its strokes replaced by pen and the dash patterns of its
+// stroked paths replaced by dash, as done by drawing options of MetaPost's
+// addto also. Nil arguments leave the respective attribute unchanged.
+func (p Picture) Restyled(c *Color, pen *Pen, dash *Dash) Picture {
+	return Picture{known: p.known, components: restyleComponents(p.components, c, pen, dash)}
+}
+
+// Transformed applies a known transform to a picture, including the pens and
+// dash patterns of its strokes and the placement of its texts. Dash patterns
+// are scaled by the square root of the determinant of the transform.
+func (p Picture) Transformed(t Transform) (Picture, error) {
+	if !t.IsKnown() {
+		return Picture{}, fmt.Errorf("cannot transform a picture by an unknown transform")
+	}
+	if !p.known {
+		return Picture{}, fmt.Errorf("cannot transform an unknown picture")
+	}
+	components, err := transformComponents(p.components, t)
+	if err != nil {
+		return Picture{}, err
+	}
+	return Picture{known: true, components: components}, nil
+}
+
+// BBox returns the lower left and upper right corner of the bounding box of
+// a picture. Strokes extend the bounding box of their paths by the extent of
+// their pens. The bounding box of an empty picture is the origin.
+func (p Picture) BBox() (arithm.Pair, arithm.Pair) {
+	box := componentsBBox(p.components)
+	return box.ll, box.ur
+}
+
+// add returns a picture with components appended to the components of p.
+// The components of p are not modified.
+func (p Picture) add(c ...Component) Picture {
+	n := len(p.components)
+	return Picture{known: true, components: append(p.components[:n:n], c...)}
+}
+
+// checkContour checks the arguments of operations on a picture which need a
+// cyclic path.
+func (p Picture) checkContour(op string, c Path) error {
+	if !p.known || !c.IsKnown() {
+		return fmt.Errorf("%s needs a known picture and path", op)
+	}
+	if !c.cycle {
+		return fmt.Errorf("%s needs a cyclic path, have %v", op, c)
+	}
+	return nil
+}
+
+func (p Picture) String() string {
+	if !p.known {
+		return "<unknown picture>"
+	}
+	if len(p.components) == 0 {
+		return "nullpicture"
+	}
+	var b strings.Builder
+	b.WriteString("picture(")
+	writeComponents(&b, p.components)
+	b.WriteString(")")
+	return b.String()
+}
+
+func (c Component) String() string {
+	var b strings.Builder
+	switch c.Kind {
+	case FillComponent:
+		fmt.Fprintf(&b, "contour %v withcolor %v", c.Path, c.Color)
+		if c.Stroke != nil {
+			fmt.Fprintf(&b, " withpen %v", c.Stroke.Pen)
+		}
+	case StrokeComponent:
+		fmt.Fprintf(&b, "doublepath %v withcolor %v withpen %v", c.Path, c.Color, c.Stroke.Pen)
+		if !c.Stroke.Dash.IsSolid() {
+			fmt.Fprintf(&b, " dashed %v", c.Stroke.Dash)
+		}
+	case TextComponent:
+		fmt.Fprintf(&b, "%q infont %q transformed %v withcolor %v", c.Text.Chars, c.Text.Font,
+			c.Placement, c.Color)
+	case ClipComponent, BoundsComponent:
+		op := "clip"
+		if c.Kind == BoundsComponent {
+			op = "setbounds"
+		}
+		fmt.Fprintf(&b, "%s(", op)
+		writeComponents(&b, c.Components)
+		fmt.Fprintf(&b, ") to %v", c.Path)
+	}
+	return b.String()
+}
+
+func writeComponents(b *strings.Builder, components []Component) {
+	for i, c := range components {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(c.String())
+	}
+}
+
+// restyleComponents replaces colors and pens of a list of components.
+func restyleComponents(components []Component, c *Color, pen *Pen, dash *Dash) []Component {
+	r := make([]Component, len(components))
+	for i, comp := range components {
+		if c != nil {
+			comp.Color = *c
+		}
+		if comp.Stroke != nil && (pen != nil || dash != nil && comp.Kind == StrokeComponent) {
+			stroke := *comp.Stroke
+			if pen != nil {
+				stroke.Pen = *pen
+			}
+			if dash != nil && comp.Kind == StrokeComponent {
+				stroke.Dash = *dash
+			}
+			comp.Stroke = &stroke
+		}
+		comp.Components = restyleComponents(comp.Components, c, pen, dash)
+		r[i] = comp
+	}
+	return r
+}
+
+// transformComponents applies a known transform to a list of components.
+func transformComponents(components []Component, t Transform) ([]Component, error) {
+	r := make([]Component, len(components))
+	var err error
+	for i, c := range components {
+		if c.Kind == TextComponent {
+			c.Placement, err = c.Placement.Transformed(t)
+		} else {
+			c.Path, err = c.Path.Transformed(t)
+		}
+		if err == nil && c.Stroke != nil {
+			stroke := *c.Stroke
+			stroke.Pen, err = stroke.Pen.Transformed(t)
+			stroke.Dash = stroke.Dash.Scaled(dashScale(t))
+			c.Stroke = &stroke
+		}
+		if err == nil && len(c.Components) > 0 {
+			c.Components, err = transformComponents(c.Components, t)
+		}
+		if err != nil {
+			return nil, err
+		}
+		r[i] = c
+	}
+	return r, nil
+}
+
+// equalComponents is a predicate: are two lists of components equal?
+func equalComponents(c1, c2 []Component) bool {
+	if len(c1) != len(c2) {
+		return false
+	}
+	for i, c := range c1 {
+		d := c2[i]
+		if c.Kind != d.Kind || c.Text != d.Text || !c.Path.Equal(d.Path) ||
+			!equalAttributes(c.Color, d.Color) || !equalAttributes(c.Placement, d.Placement) {
+			return false
+		}
+		if (c.Stroke == nil) != (d.Stroke == nil) || c.Stroke != nil && !c.Stroke.Equal(*d.Stroke) {
+			return false
+		}
+		if !equalComponents(c.Components, d.Components) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalAttributes is a predicate: are two attributes of picture components
+// equal? Components leave attributes they do not use unknown, and two
+// unknown attributes are equal.
+func equalAttributes(v, w Value) bool {
+	if !v.IsKnown() || !w.IsKnown() {
+		return !v.IsKnown() && !w.IsKnown()
+	}
+	eq, err := v.Self().Equals(w)
+	return err == nil && eq
+}
+
+// componentsBBox returns the bounding box of a list of components.
+func componentsBBox(components []Component) boundingBox {
+	var box boundingBox
+	for _, c := range components {
+		box = box.union(c.bbox())
+	}
+	return box
+}
+
+// bbox returns the bounding box of a component.
+func (c Component) bbox() boundingBox {
+	switch c.Kind {
+	case TextComponent:
+		_, apply := c.Placement.affine()
+		var box boundingBox
+		for _, z := range []arithm.Pair{
+			arithm.P(0, -c.Text.Depth), arithm.P(c.Text.Width, -c.Text.Depth),
+			arithm.P(0, c.Text.Height), arithm.P(c.Text.Width, c.Text.Height),
+		} {
+			box = box.union(pointBox(apply(z)))
+		}
+		return box
+	case ClipComponent:
+		return componentsBBox(c.Components).intersection(pathBox(c.Path))
+	case BoundsComponent:
+		return pathBox(c.Path)
+	}
+	box := pathBox(c.Path)
+	if c.Stroke != nil {
+		ll, ur := c.Stroke.Pen.BBox()
+		box.ll, box.ur = box.ll+ll, box.ur+ur
+	}
+	return box
+}
+
+// --- Bounding boxes --------------------------------------------------------
+
+// boundingBox is an axis-parallel box. The zero value is the empty box.
+type boundingBox struct {
+	ll, ur arithm.Pair // lower left and upper right corner
+	full   bool        // false for the empty box
+}
+
+// pointBox returns the bounding box of a single point.
+func pointBox(z arithm.Pair) boundingBox {
+	return boundingBox{ll: z, ur: z, full: true}
+}
+
+// pathBox returns the bounding box of a path.
+func pathBox(p Path) boundingBox {
+	ll, ur := p.BBox()
+	return boundingBox{ll: ll, ur: ur, full: true}
+}
+
+// union returns the smallest box containing two boxes.
+func (b boundingBox) union(c boundingBox) boundingBox {
+	if !b.full {
+		return c
+	}
+	if !c.full {
+		return b
+	}
+	return boundingBox{
+		ll:   arithm.P(math.Min(b.ll.X(), c.ll.X()), math.Min(b.ll.Y(), c.ll.Y())),
+		ur:   arithm.P(math.Max(b.ur.X(), c.ur.X()), math.Max(b.ur.Y(), c.ur.Y())),
+		full: true,
+	}
+}
+
+// intersection returns the intersection of two boxes, which may be empty.
+func (b boundingBox) intersection(c boundingBox) boundingBox {
+	if !b.full || !c.full {
+		return boundingBox{}
+	}
+	r := boundingBox{
+		ll:   arithm.P(math.Max(b.ll.X(), c.ll.X()), math.Max(b.ll.Y(), c.ll.Y())),
+		ur:   arithm.P(math.Min(b.ur.X(), c.ur.X()), math.Min(b.ur.Y(), c.ur.Y())),
+		full: true,
+	}
+	if r.ll.X() > r.ur.X() || r.ll.Y() > r.ur.Y() {
+		return boundingBox{}
+	}
+	return r
+}
+
+// bounds returns the bounding box of a curve. Besides its end points, the
+// curve may reach its extremes where a component of its derivative vanishes.
+func (b bezier) bounds() boundingBox {
+	box := pointBox(b[0]).union(pointBox(b[3]))
+	a, c, e := b[1]-b[0], b[2]-b[1], b[3]-b[2]
+	for _, part := range []func(arithm.Pair) float64{arithm.Pair.X, arithm.Pair.Y} {
+		// derivative/3 = (1-t)²a + 2t(1-t)c + t²e
+		roots, _ := quadraticRoots(part(a)-2*part(c)+part(e), 2*(part(c)-part(a)), part(a))
+		for _, t := range roots {
+			box = box.union(pointBox(b.split(t)[3]))
+		}
+	}
+	return box
+}
@@ -53,6 +53,8 @@ func init() {
 	// persistent flags which will be global for the application
 	rootCmd.PersistentFlags().BoolP("interactive", "i", false, "Force run in interactive mode")
 	rootCmd.PersistentFlags().String("logfile", "stderr", "URL of log output location")
+	rootCmd.PersistentFlags().String("unit", "bp", "Base unit of lengths (bp, pt, mm, cm, in, pc, dd, cc)")
+	rootCmd.PersistentFlags().Int64("seed", 0, "Seed for random numbers, for reproducible runs (0: time of day)")
 }
 
 // TODO if -c <cmd> flag is given:
@@ -25,6 +25,10 @@ const (
 	SparkMacro
 	SparkExpr
 	SparkText
+	SparkSuffix
+	SparkPrimary
+	SparkSecondary
+	SparkTertiary
 
 	TagArray TagType = 0x01 << 7 // bit flag for tags with array type
 )
@@ -70,6 +74,12 @@ func (st TagDeclaration) Name() string {
 	return st.Symbol.Name
 }
 
+// Components returns the components of a declared name, with "[]" for
+// array subscripts.
+func (st TagDeclaration) Components() []string {
+	return st.prefixes
+}
+
 func (st TagDeclaration) TagType() TagType {
 	return st.Kind & 0x03f
 }
@@ -105,6 +115,7 @@ func (st *TagDeclaration) IncarnateVar(indices []float64) Variable {
 		return Pair{TypeBase: b}
 	case TagPath:
 	case TagTransform:
+		return Transform{TypeBase: b}
 	case TagString:
 		return String{TypeBase: b}
 	}
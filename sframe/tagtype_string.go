@@ -21,21 +21,25 @@ func _() {
 	_ = x[SparkMacro-10]
 	_ = x[SparkExpr-11]
 	_ = x[SparkText-12]
+	_ = x[SparkSuffix-13]
+	_ = x[SparkPrimary-14]
+	_ = x[SparkSecondary-15]
+	_ = x[SparkTertiary-16]
 	_ = x[TagArray-128]
 }
 
 const (
-	_TagType_name_0 = "UndefinedTagTagVardefTagNumericTagPairTagPathTagTransformTagStringSparkSparkBuiltinSparkMacroSparkExprSparkText"
+	_TagType_name_0 = "UndefinedTagTagVardefTagNumericTagPairTagPathTagTransformTagStringSparkSparkBuiltinSparkMacroSparkExprSparkTextSparkSuffixSparkPrimarySparkSecondarySparkTertiary"
 	_TagType_name_1 = "TagArray"
 )
 
 var (
-	_TagType_index_0 = [...]uint8{0, 9, 12, 21, 31, 38, 45, 57, 66, 71, 83, 93, 102, 111}
+	_TagType_index_0 = [...]uint8{0, 9, 12, 21, 31, 38, 45, 57, 66, 71, 83, 93, 102, 111, 122, 134, 148, 161}
 )
 
 func (i TagType) String() string {
 	switch {
-	case i <= 12:
+	case i <= 16:
 		return _TagType_name_0[_TagType_index_0[i]:_TagType_index_0[i+1]]
 	case i == 128:
 		return _TagType_name_1
@@ -47,7 +47,7 @@ func (tbase TypeBase) Name() string {
 	var inx, fullname string
 	if len(frags) > 1 {
 		for i, frag := range frags[:len(frags)-1] {
-			if i > len(tbase.subscripts) {
+			if i >= len(tbase.subscripts) {
 				inx = "0"
 			} else {
 				inx = fmt.Sprintf("%f", tbase.subscripts[i])
@@ -79,12 +79,54 @@ type Pair struct {
 	Parts [2]Numeric
 }
 
+// Transform is a transform variable, with parts tx, ty, txx, txy, tyx, tyy.
+type Transform struct {
+	TypeBase
+	Parts [6]Numeric
+}
+
+// Macro is a macro defined by def or vardef. The first Delimited parameters
+// of ArgsList are delimited parameters, an optional last one is undelimited.
+// A vardef macro with Suffixed set takes the suffix of its name (@#).
 type Macro struct {
 	TypeBase
 	ArgsList    []TagDeclaration
+	Delimited   int
+	Suffixed    bool
 	replacement string
 }
 
+// NewMacro creates a macro from its name, parameters and replacement text.
+func NewMacro(name string, args []TagDeclaration, delimited int, replacement string) Macro {
+	decl := MakeTagDecl(SparkMacro, name)
+	return Macro{
+		TypeBase:    MakeTypeBase(&decl),
+		ArgsList:    args,
+		Delimited:   delimited,
+		replacement: replacement,
+	}
+}
+
+// NewVardef creates a macro defined by vardef. name holds the components of
+// the generic variable the macro is defined for, e.g. {"p", "[]", "q"}.
+func NewVardef(name []string, suffixed bool, args []TagDeclaration, delimited int,
+	replacement string) Macro {
+	//
+	decl := MakeTagDecl(TagVardef, name...)
+	return Macro{
+		TypeBase:    MakeTypeBase(&decl),
+		ArgsList:    args,
+		Delimited:   delimited,
+		Suffixed:    suffixed,
+		replacement: replacement,
+	}
+}
+
+// IsVardef is a predicate: has this macro been defined by vardef?
+func (m Macro) IsVardef() bool {
+	return m.Declaration().TagType() == TagVardef
+}
+
 func (m Macro) ReplacementText() string {
 	return m.replacement
 }
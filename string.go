@@ -0,0 +1,46 @@
+package pmmp
+
+// --- String ----------------------------------------------------------------
+
+// String is a known or unknown string value.
+//
+// The zero value is an unknown string.
+type String struct {
+	value string
+	known bool
+}
+
+// NewString creates a known string value.
+func NewString(s string) String {
+	return String{value: s, known: true}
+}
+
+// Self returns this string, wrapped into a ValueBase struct.
+func (s String) Self() ValueBase {
+	return ValueBase{s}
+}
+
+// IsKnown is a predicate: is this a known value?
+func (s String) IsKnown() bool {
+	return s.known
+}
+
+// Type returns StringType.
+func (s String) Type() ValueType {
+	return StringType
+}
+
+// AsString returns a known string value as a Go string, or "".
+func (s String) AsString() string {
+	if !s.known {
+		tracer().Errorf("value is not a known string")
+	}
+	return s.value
+}
+
+func (s String) String() string {
+	if !s.known {
+		return "<unknown string>"
+	}
+	return `"` + s.value + `"`
+}
@@ -0,0 +1,132 @@
+package pmmp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/gomediumitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/gofont/gosmallcaps"
+	"golang.org/x/image/font/gofont/gosmallcapsitalic"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// --- Fonts and text --------------------------------------------------------
+
+// FontSize is the size of text typeset by infont, in bp. MetaPost typesets
+// text at the design size of a font; the Go fonts are scalable and do not
+// have one.
+const FontSize = 10.0
+
+// DefaultFont is the name of the font plain MetaPost's defaultfont is set to.
+const DefaultFont = "goregular"
+
+// The fonts known to infont are the Go fonts, which the GUI uses as well.
+// They are named after their packages in golang.org/x/image/font/gofont.
+var goFonts = map[string][]byte{
+	"goregular":         goregular.TTF,
+	"gobold":            gobold.TTF,
+	"goitalic":          goitalic.TTF,
+	"gobolditalic":      gobolditalic.TTF,
+	"gomedium":          gomedium.TTF,
+	"gomediumitalic":    gomediumitalic.TTF,
+	"gomono":            gomono.TTF,
+	"gomonobold":        gomonobold.TTF,
+	"gomonoitalic":      gomonoitalic.TTF,
+	"gomonobolditalic":  gomonobolditalic.TTF,
+	"gosmallcaps":       gosmallcaps.TTF,
+	"gosmallcapsitalic": gosmallcapsitalic.TTF,
+}
+
+var fontCache = struct {
+	sync.Mutex
+	fonts map[string]*sfnt.Font
+}{fonts: make(map[string]*sfnt.Font)}
+
+// loadFont returns a parsed Go font.
+func loadFont(name string) (*sfnt.Font, error) {
+	fontCache.Lock()
+	defer fontCache.Unlock()
+	if f, ok := fontCache.fonts[name]; ok {
+		return f, nil
+	}
+	ttf, ok := goFonts[name]
+	if !ok {
+		names := make([]string, 0, len(goFonts))
+		for n := range goFonts {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("font %q not found, known fonts are %s", name, strings.Join(names, ", "))
+	}
+	f, err := sfnt.Parse(ttf)
+	if err != nil {
+		return nil, fmt.Errorf("font %q: %v", name, err)
+	}
+	fontCache.fonts[name] = f
+	return f, nil
+}
+
+// Typeset typesets a string in a font at FontSize. The width of the text is
+// the sum of the advance widths of its glyphs, including kerning; its height
+// and depth are the largest extent of a glyph above and below the baseline.
+// It is an error if the font has no glyph for a character.
+func Typeset(chars string, fontname string) (Text, error) {
+	f, err := loadFont(fontname)
+	if err != nil {
+		return Text{}, err
+	}
+	var b sfnt.Buffer
+	upem := fixed.Int26_6(f.UnitsPerEm()) << 6 // measure in font units
+	scale := FontSize / float64(upem)
+	text := Text{Chars: chars, Font: fontname}
+	var w fixed.Int26_6
+	var prev sfnt.GlyphIndex
+	for i, r := range []rune(chars) {
+		x, err := f.GlyphIndex(&b, r)
+		if err != nil {
+			return Text{}, fmt.Errorf("font %q: %v", fontname, err)
+		}
+		if x == 0 { // glyph 0 is .notdef
+			return Text{}, fmt.Errorf("font %q has no glyph for %q", fontname, r)
+		}
+		if i > 0 {
+			if k, err := f.Kern(&b, prev, x, upem, font.HintingNone); err == nil {
+				w += k
+			}
+		}
+		bounds, advance, err := f.GlyphBounds(&b, x, upem, font.HintingNone)
+		if err != nil {
+			return Text{}, fmt.Errorf("font %q: %v", fontname, err)
+		}
+		text.Height = math.Max(text.Height, float64(-bounds.Min.Y)*scale)
+		text.Depth = math.Max(text.Depth, float64(bounds.Max.Y)*scale)
+		w += advance
+		prev = x
+	}
+	text.Width = float64(w) * scale
+	return text, nil
+}
+
+// InFont is MetaPost's s infont f: a picture with a single black text
+// component, with its reference point at the origin.
+func InFont(chars string, fontname string) (Picture, error) {
+	text, err := Typeset(chars, fontname)
+	if err != nil {
+		return Picture{}, err
+	}
+	return NullPicture().AddText(text, Identity(), Greyscale(FromFloat(0)))
+}
@@ -0,0 +1,67 @@
+package pmmp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/npillmayer/arithm"
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+)
+
+func TestTypeset(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp")
+	defer teardown()
+	//
+	for _, c := range []struct {
+		chars, font          string
+		width, height, depth float64
+	}{
+		{"x", "goregular", 5, 5.30273, 0},
+		{"xx", "goregular", 10, 5.30273, 0},
+		{"g", "goregular", 5.56152, 5.41992, 2.05078},
+		{"x", "gomono", 6.00098, 5.30273, 0},
+		{"", "goregular", 0, 0, 0},
+	} {
+		text, err := Typeset(c.chars, c.font)
+		if err != nil {
+			t.Errorf("%q in %s: %v", c.chars, c.font, err)
+			continue
+		}
+		if math.Abs(text.Width-c.width) > 1e-4 || math.Abs(text.Height-c.height) > 1e-4 ||
+			math.Abs(text.Depth-c.depth) > 1e-4 {
+			t.Errorf("%q in %s: expected extent %g×(%g+%g), have %+v", c.chars, c.font,
+				c.width, c.height, c.depth, text)
+		}
+	}
+}
+
+func TestTypesetErrors(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp")
+	defer teardown()
+	//
+	for _, c := range []struct{ chars, font string }{
+		{"x", "cmr10"},      // unknown font
+		{"a中", "goregular"}, // missing glyph
+	} {
+		if _, err := Typeset(c.chars, c.font); err == nil {
+			t.Errorf("expected typesetting %q in %s to fail", c.chars, c.font)
+		}
+	}
+}
+
+func TestInFont(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "pmmp")
+	defer teardown()
+	//
+	pic, err := InFont("g", DefaultFont)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := pic.Components(); len(c) != 1 || c[0].Kind != TextComponent || c[0].Text.Chars != "g" {
+		t.Fatalf("expected a single text component, have %v", pic)
+	}
+	ll, ur := pic.BBox()
+	if !near(ll, arithm.P(0, -2.05078)) || !near(ur, arithm.P(5.56152, 5.41992)) {
+		t.Errorf("expected bounding box (0,-2.05078)…(5.56152,5.41992), have %v…%v", ll, ur)
+	}
+}
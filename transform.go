@@ -0,0 +1,238 @@
+package pmmp
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/npillmayer/arithm"
+)
+
+// --- Transform -------------------------------------------------------------
+
+// TransformPart is the index of a part of a transform.
+type TransformPart int8
+
+// Parts of a transform, in MetaPost's order
+const (
+	XPart  TransformPart = iota // tx
+	YPart                       // ty
+	XXPart                      // txx
+	XYPart                      // txy
+	YXPart                      // tyx
+	YYPart                      // tyy
+)
+
+var transformPartNames = [6]string{"xpart", "ypart", "xxpart", "xypart", "yxpart", "yypart"}
+
+func (p TransformPart) String() string {
+	return transformPartNames[p]
+}
+
+// Transform is a known or unknown affine transform. It consists of six
+// numeric parts (tx, ty, txx, txy, tyx, tyy), which map a point (x,y) to
+//
+//     (tx + txx⋅x + txy⋅y, ty + tyx⋅x + tyy⋅y)
+//
+// Like the parts of a pair, each part may be an unknown linear polynomial.
+type Transform struct {
+	parts [6]Numeric
+}
+
+// NewTransform creates a transform from its parts.
+func NewTransform(parts [6]Numeric) Transform {
+	return Transform{parts: parts}
+}
+
+// Identity returns the identity transform.
+func Identity() Transform {
+	return NewTransform([6]Numeric{
+		FromFloat(0), FromFloat(0), FromFloat(1), FromFloat(0), FromFloat(0), FromFloat(1),
+	})
+}
+
+// Shifting returns a transform which shifts by (a,b).
+func Shifting(a, b Numeric) Transform {
+	t := Identity()
+	t.parts[XPart], t.parts[YPart] = a, b
+	return t
+}
+
+// Scaling returns a transform which scales by a in x-direction and by b
+// in y-direction.
+func Scaling(a, b Numeric) Transform {
+	t := Identity()
+	t.parts[XXPart], t.parts[YYPart] = a, b
+	return t
+}
+
+// Slanting returns a transform which slants by s.
+func Slanting(s Numeric) Transform {
+	t := Identity()
+	t.parts[XYPart] = s
+	return t
+}
+
+// ZScaling returns a transform which rotates and scales like a
+// multiplication with the complex number a+bi.
+func ZScaling(a, b Numeric) Transform {
+	return NewTransform([6]Numeric{
+		FromFloat(0), FromFloat(0), a, FromFloat(0).Minus(b), b, a,
+	})
+}
+
+// Rotation returns a transform which rotates by an angle given in degrees.
+func Rotation(deg float64) Transform {
+	sin, cos := math.Sincos(deg * math.Pi / 180)
+	return ZScaling(FromFloat(arithm.Zap(cos)), FromFloat(arithm.Zap(sin)))
+}
+
+// Self returns this transform, wrapped into a ValueBase struct.
+func (t Transform) Self() ValueBase {
+	return ValueBase{t}
+}
+
+// IsKnown is a predicate: is this a known value?
+func (t Transform) IsKnown() bool {
+	for _, p := range t.parts {
+		if !p.IsKnown() {
+			return false
+		}
+	}
+	return true
+}
+
+// Type returns TransformType.
+func (t Transform) Type() ValueType {
+	return TransformType
+}
+
+// Part returns a part of a transform.
+func (t Transform) Part(p TransformPart) Numeric {
+	return t.parts[p]
+}
+
+// Plus is t + u, part by part.
+func (t Transform) Plus(u Transform) Transform {
+	var r Transform
+	for i := range r.parts {
+		r.parts[i] = t.parts[i].Plus(u.parts[i])
+	}
+	return r
+}
+
+// Negated is -t, part by part.
+func (t Transform) Negated() Transform {
+	var r Transform
+	for i := range r.parts {
+		r.parts[i] = t.parts[i].Negated()
+	}
+	return r
+}
+
+// Minus is t - u, part by part. It is used to create equations between
+// transforms.
+func (t Transform) Minus(u Transform) Transform {
+	var r Transform
+	for i := range r.parts {
+		r.parts[i] = t.parts[i].Minus(u.parts[i])
+	}
+	return r
+}
+
+// ApplyTo transforms a pair. Either the transform or the pair has to be
+// known, otherwise the result would not be linear.
+func (t Transform) ApplyTo(p Pair) (Pair, error) {
+	x, err := linear(t.parts[XPart], t.parts[XXPart], p.xpart, t.parts[XYPart], p.ypart)
+	if err != nil {
+		return NullPair(), err
+	}
+	y, err := linear(t.parts[YPart], t.parts[YXPart], p.xpart, t.parts[YYPart], p.ypart)
+	if err != nil {
+		return NullPair(), err
+	}
+	return NewPair(x, y), nil
+}
+
+// Transformed returns t transformed u, i.e. a transform which first applies t
+// and then u. Either t or u has to be known, otherwise the result would not
+// be linear.
+func (t Transform) Transformed(u Transform) (Transform, error) {
+	zero := FromFloat(0)
+	var r Transform
+	var err error
+	for i, x := range [6][5]Numeric{
+		{u.parts[XPart], u.parts[XXPart], t.parts[XPart], u.parts[XYPart], t.parts[YPart]},
+		{u.parts[YPart], u.parts[YXPart], t.parts[XPart], u.parts[YYPart], t.parts[YPart]},
+		{zero, u.parts[XXPart], t.parts[XXPart], u.parts[XYPart], t.parts[YXPart]},
+		{zero, u.parts[XXPart], t.parts[XYPart], u.parts[XYPart], t.parts[YYPart]},
+		{zero, u.parts[YXPart], t.parts[XXPart], u.parts[YYPart], t.parts[YXPart]},
+		{zero, u.parts[YXPart], t.parts[XYPart], u.parts[YYPart], t.parts[YYPart]},
+	} {
+		if r.parts[i], err = linear(x[0], x[1], x[2], x[3], x[4]); err != nil {
+			return Transform{}, err
+		}
+	}
+	return r, nil
+}
+
+// Inverse returns the inverse of a known transform. It is an error to invert
+// a singular transform.
+func (t Transform) Inverse() (Transform, error) {
+	if !t.IsKnown() {
+		return Transform{}, fmt.Errorf("cannot invert an unknown transform")
+	}
+	var f [6]float64
+	for i, p := range t.parts {
+		f[i] = p.AsFloat()
+	}
+	det := f[XXPart]*f[YYPart] - f[XYPart]*f[YXPart]
+	if arithm.Is0(det) {
+		return Transform{}, fmt.Errorf("cannot invert a singular transform")
+	}
+	xx, xy := f[YYPart]/det, -f[XYPart]/det
+	yx, yy := -f[YXPart]/det, f[XXPart]/det
+	return NewTransform([6]Numeric{
+		FromFloat(arithm.Zap(-xx*f[XPart] - xy*f[YPart])),
+		FromFloat(arithm.Zap(-yx*f[XPart] - yy*f[YPart])),
+		FromFloat(xx), FromFloat(xy), FromFloat(yx), FromFloat(yy),
+	}), nil
+}
+
+// affine returns the parts of a known transform as floats, together with a
+// function which applies the transform to a point.
+func (t Transform) affine() ([6]float64, func(arithm.Pair) arithm.Pair) {
+	var u [6]float64
+	for i, p := range t.parts {
+		u[i] = p.AsFloat()
+	}
+	return u, func(z arithm.Pair) arithm.Pair {
+		return arithm.P(u[0]+u[2]*z.X()+u[3]*z.Y(), u[1]+u[4]*z.X()+u[5]*z.Y())
+	}
+}
+
+func (t Transform) String() string {
+	var b strings.Builder
+	b.WriteString("(")
+	for i, p := range t.parts {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(p.Self().String())
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// linear calculates c + a1⋅b1 + a2⋅b2.
+func linear(c, a1, b1, a2, b2 Numeric) (Numeric, error) {
+	p1, err := a1.Times(b1)
+	if err != nil {
+		return Numeric{}, err
+	}
+	p2, err := a2.Times(b2)
+	if err != nil {
+		return Numeric{}, err
+	}
+	return c.Plus(p1).Plus(p2), nil
+}
@@ -1,6 +1,7 @@
 package pmmp
 
 import (
+    "errors"
     "fmt"
     "math"
 
@@ -25,6 +26,11 @@ const (
     PathType
     ColorType
     PenType
+    BooleanType
+    StringType
+    TransformType
+    CMYKColorType
+    PictureType
     VardefType
     SubscriptType
     SuffixType
@@ -39,6 +45,11 @@ type Value interface {
     Type() ValueType // type of the value
 }
 
+// ErrNonlinear is reported for operations which would result in a product
+// of unknown quantities. Values are linear polynomials, and MetaPost solves
+// linear equations only.
+var ErrNonlinear = errors.New("nonlinear equation")
+
 // ValueBase is a helper struct for operations on values.
 type ValueBase struct {
     V Value
@@ -66,6 +77,48 @@ func (b ValueBase) IsPair() bool {
     return ok
 }
 
+// IsPath is a predicate: is it a Path?
+func (b ValueBase) IsPath() bool {
+    _, ok := b.V.(Path)
+    return ok
+}
+
+// IsBoolean is a predicate: is it a Boolean?
+func (b ValueBase) IsBoolean() bool {
+    _, ok := b.V.(Boolean)
+    return ok
+}
+
+// IsString is a predicate: is it a String?
+func (b ValueBase) IsString() bool {
+    _, ok := b.V.(String)
+    return ok
+}
+
+// IsTransform is a predicate: is it a Transform?
+func (b ValueBase) IsTransform() bool {
+    _, ok := b.V.(Transform)
+    return ok
+}
+
+// IsColor is a predicate: is it a Color, either RGB or CMYK?
+func (b ValueBase) IsColor() bool {
+    _, ok := b.V.(Color)
+    return ok
+}
+
+// IsPen is a predicate: is it a Pen?
+func (b ValueBase) IsPen() bool {
+    _, ok := b.V.(Pen)
+    return ok
+}
+
+// IsPicture is a predicate: is it a Picture?
+func (b ValueBase) IsPicture() bool {
+    _, ok := b.V.(Picture)
+    return ok
+}
+
 // Type returns the value type of a value.
 func (b ValueBase) Type() ValueType {
     return b.V.Type()
@@ -89,6 +142,93 @@ func (b ValueBase) AsPair() Pair {
     return NullPair()
 }
 
+// AsPath returns a value as a Path, or an error and an unknown path.
+func (b ValueBase) AsPath() Path {
+    if p, ok := b.V.(Path); ok {
+        return p
+    }
+    tracer().Errorf("value is not of type path: %v", b.V)
+    return Path{}
+}
+
+// AsBoolean returns a value as a Boolean, or an error and an unknown boolean.
+func (b ValueBase) AsBoolean() Boolean {
+    if v, ok := b.V.(Boolean); ok {
+        return v
+    }
+    tracer().Errorf("value is not of type boolean: %v", b.V)
+    return Boolean{}
+}
+
+// AsString returns a value as a String, or an error and an unknown string.
+func (b ValueBase) AsString() String {
+    if v, ok := b.V.(String); ok {
+        return v
+    }
+    tracer().Errorf("value is not of type string: %v", b.V)
+    return String{}
+}
+
+// AsTransform returns a value as a Transform, or an error and an unknown
+// transform.
+func (b ValueBase) AsTransform() Transform {
+    if t, ok := b.V.(Transform); ok {
+        return t
+    }
+    tracer().Errorf("value is not of type transform: %v", b.V)
+    return Transform{}
+}
+
+// AsColor returns a value as a Color, or an error and an unknown color.
+func (b ValueBase) AsColor() Color {
+    if c, ok := b.V.(Color); ok {
+        return c
+    }
+    tracer().Errorf("value is not of type color: %v", b.V)
+    return Color{}
+}
+
+// AsPen returns a value as a Pen, or an error and an unknown pen.
+func (b ValueBase) AsPen() Pen {
+    if p, ok := b.V.(Pen); ok {
+        return p
+    }
+    tracer().Errorf("value is not of type pen: %v", b.V)
+    return Pen{}
+}
+
+// AsPicture returns a value as a Picture, or an error and an unknown picture.
+func (b ValueBase) AsPicture() Picture {
+    if p, ok := b.V.(Picture); ok {
+        return p
+    }
+    tracer().Errorf("value is not of type picture: %v", b.V)
+    return Picture{}
+}
+
+// Plus calculates a + b.
+func (b ValueBase) Plus(w Value) (Value, error) {
+    switch b.Type() {
+    case NumericType:
+        if w.Self().IsNumeric() {
+            return b.AsNumeric().Plus(w.Self().AsNumeric()), nil
+        }
+    case PairType:
+        if w.Self().IsPair() {
+            return b.AsPair().Plus(w.Self().AsPair()), nil
+        }
+    case TransformType:
+        if w.Self().IsTransform() {
+            return b.AsTransform().Plus(w.Self().AsTransform()), nil
+        }
+    case ColorType, CMYKColorType:
+        if w.Self().IsColor() {
+            return b.AsColor().Plus(w.Self().AsColor())
+        }
+    }
+    return Numeric{}, fmt.Errorf("cannot add %v and %v", b.Type(), w.Type())
+}
+
 // Minus calculates a - b.
 func (b ValueBase) Minus(w Value) (Value, error) {
     switch b.Type() {
@@ -100,10 +240,108 @@ func (b ValueBase) Minus(w Value) (Value, error) {
         if w.Self().IsPair() {
             return b.AsPair().Minus(w.Self().AsPair()), nil
         }
-    default:
-        tracer().Errorf("not yet implemented: %T minus %T", b.V, w)
+    case TransformType:
+        if w.Self().IsTransform() {
+            return b.AsTransform().Minus(w.Self().AsTransform()), nil
+        }
+    case ColorType, CMYKColorType:
+        if w.Self().IsColor() {
+            return b.AsColor().Minus(w.Self().AsColor())
+        }
+    }
+    return Numeric{}, fmt.Errorf("cannot subtract %v from %v", w.Type(), b.Type())
+}
+
+// Negated calculates -b.
+func (b ValueBase) Negated() (Value, error) {
+    switch b.Type() {
+    case NumericType:
+        return b.AsNumeric().Negated(), nil
+    case PairType:
+        return b.AsPair().Negated(), nil
+    case TransformType:
+        return b.AsTransform().Negated(), nil
+    case ColorType, CMYKColorType:
+        return b.AsColor().Times(FromFloat(-1))
+    }
+    return Numeric{}, fmt.Errorf("cannot negate a value of type %v", b.Type())
+}
+
+// Times scales a value by a numeric n. Either n or the value has to be
+// known, otherwise the result would not be linear.
+func (b ValueBase) Times(n Numeric) (Value, error) {
+    switch b.Type() {
+    case NumericType:
+        return b.AsNumeric().Times(n)
+    case PairType:
+        return b.AsPair().Times(n)
+    case ColorType, CMYKColorType:
+        return b.AsColor().Times(n)
     }
-    return Numeric{}, fmt.Errorf("not yet implemented: %T minus %T", b.V, w)
+    return Numeric{}, fmt.Errorf("cannot scale a value of type %v", b.Type())
+}
+
+// Over divides a value by a known, non-zero numeric n.
+func (b ValueBase) Over(n Numeric) (Value, error) {
+    r, err := FromFloat(1).Over(n)
+    if err != nil {
+        return Numeric{}, err
+    }
+    return b.Times(r)
+}
+
+// DotProd calculates the dot product of two pairs. One of the pairs has to
+// be known, otherwise the result would not be linear.
+func (b ValueBase) DotProd(w Value) (Value, error) {
+    if !b.IsPair() || !w.Self().IsPair() {
+        return Numeric{}, fmt.Errorf("cannot calculate %v dotprod %v", b.Type(), w.Type())
+    }
+    return b.AsPair().DotProd(w.Self().AsPair())
+}
+
+// Equals is a predicate: are two known values of the same type equal?
+// Numerical values are compared with a tolerance, see arithm.Is0. It is an
+// error to compare unknown values or values of different types.
+func (b ValueBase) Equals(w Value) (bool, error) {
+    if b.Type() != w.Type() {
+        return false, fmt.Errorf("cannot compare %v and %v", b.Type(), w.Type())
+    }
+    if !b.V.IsKnown() || !w.IsKnown() {
+        return false, fmt.Errorf("cannot compare unknown values of type %v", b.Type())
+    }
+    v := w.Self()
+    switch b.Type() {
+    case NumericType:
+        return arithm.Is0(b.AsNumeric().AsFloat() - v.AsNumeric().AsFloat()), nil
+    case PairType:
+        return b.AsPair().AsPair().Equal(v.AsPair().AsPair()), nil
+    case BooleanType:
+        return b.AsBoolean().AsBool() == v.AsBoolean().AsBool(), nil
+    case StringType:
+        return b.AsString().AsString() == v.AsString().AsString(), nil
+    case PathType:
+        return b.AsPath().Equal(v.AsPath()), nil
+    case PenType:
+        return b.AsPen().Equal(v.AsPen()), nil
+    case PictureType:
+        return b.AsPicture().Equal(v.AsPicture()), nil
+    case TransformType:
+        for p := XPart; p <= YYPart; p++ {
+            if eq, _ := b.AsTransform().Part(p).Self().Equals(v.AsTransform().Part(p)); !eq {
+                return false, nil
+            }
+        }
+        return true, nil
+    case ColorType, CMYKColorType:
+        p2 := v.AsColor().Parts()
+        for i, p := range b.AsColor().Parts() {
+            if eq, _ := p.Self().Equals(p2[i]); !eq {
+                return false, nil
+            }
+        }
+        return true, nil
+    }
+    return false, fmt.Errorf("cannot compare values of type %v", b.Type())
 }
 
 // --- Numeric ---------------------------------------------------------------
@@ -152,16 +390,48 @@ func (n Numeric) AsFloat() float64 {
     return polyn.Polynomial(n).GetConstantValue()
 }
 
-// Plus is n + m.
+// Plus is n + m. Terms which cancel out are removed, thus the sum of
+// unknowns may be known.
 func (n Numeric) Plus(m Numeric) Numeric {
     r := polyn.Polynomial(n).Add(polyn.Polynomial(m), false)
-    return Numeric(r)
+    return Numeric(r.Zap())
 }
 
-// Minus is n - m.
+// Minus is n - m. Terms which cancel out are removed, thus the difference
+// of unknowns may be known.
 func (n Numeric) Minus(m Numeric) Numeric {
     r := polyn.Polynomial(n).Subtract(polyn.Polynomial(m), false)
-    return Numeric(r)
+    return Numeric(r.Zap())
+}
+
+// Negated is -n.
+func (n Numeric) Negated() Numeric {
+    return FromFloat(0).Minus(n)
+}
+
+// Times is n * m. At least one of n and m has to be known, otherwise the
+// product is not linear.
+func (n Numeric) Times(m Numeric) (Numeric, error) {
+    if !n.IsKnown() && !m.IsKnown() {
+        return Numeric{}, fmt.Errorf("%w: product of unknown numerics", ErrNonlinear)
+    }
+    r := polyn.Polynomial(n).Multiply(polyn.Polynomial(m).CopyPolynomial(), false) // Multiply destroys its argument
+    return Numeric(r), nil
+}
+
+// Over is n / m, where m has to be a known numeric other than zero.
+func (n Numeric) Over(m Numeric) (Numeric, error) {
+    if !m.IsKnown() {
+        if !n.IsKnown() {
+            return Numeric{}, fmt.Errorf("%w: division by an unknown numeric", ErrNonlinear)
+        }
+        return Numeric{}, fmt.Errorf("division by an unknown numeric")
+    }
+    d := m.AsFloat()
+    if d == 0 {
+        return Numeric{}, fmt.Errorf("division by zero")
+    }
+    return n.Times(FromFloat(1 / d))
 }
 
 // --- Pair ------------------------------------------------------------------
@@ -231,6 +501,28 @@ func ConvPair(p arithm.Pair) Pair {
     )
 }
 
+// Plus is p + q.
+func (p Pair) Plus(q Pair) Pair {
+    return NewPair(
+        p.XNumeric().Plus(q.XNumeric()),
+        p.YNumeric().Plus(q.YNumeric()),
+    )
+}
+
+// Times scales p by n. Either n or p has to be known, otherwise the result
+// would not be linear.
+func (p Pair) Times(n Numeric) (Pair, error) {
+    x, err := p.xpart.Times(n)
+    if err != nil {
+        return NullPair(), err
+    }
+    y, err := p.ypart.Times(n)
+    if err != nil {
+        return NullPair(), err
+    }
+    return NewPair(x, y), nil
+}
+
 // Minus is p - q.
 func (p Pair) Minus(q Pair) Pair {
     r := NewPair(
@@ -240,6 +532,25 @@ func (p Pair) Minus(q Pair) Pair {
     return r
 }
 
+// Negated is -p.
+func (p Pair) Negated() Pair {
+    return NewPair(p.xpart.Negated(), p.ypart.Negated())
+}
+
+// DotProd is the dot product xpart p ⋅ xpart q + ypart p ⋅ ypart q. Either
+// p or q has to be known, otherwise the result would not be linear.
+func (p Pair) DotProd(q Pair) (Numeric, error) {
+    x, err := p.xpart.Times(q.xpart)
+    if err != nil {
+        return Numeric{}, err
+    }
+    y, err := p.ypart.Times(q.ypart)
+    if err != nil {
+        return Numeric{}, err
+    }
+    return x.Plus(y), nil
+}
+
 // --- Helpers ---------------------------------------------------------------
 
 func (vt ValueType) String() string {
@@ -256,6 +567,16 @@ func (vt ValueType) String() string {
         return "color"
     case PenType:
         return "pen"
+    case BooleanType:
+        return "boolean"
+    case StringType:
+        return "string"
+    case TransformType:
+        return "transform"
+    case CMYKColorType:
+        return "cmykcolor"
+    case PictureType:
+        return "picture"
     case VardefType:
         return "vardef"
     case SubscriptType:
@@ -275,10 +596,20 @@ func TypeFromString(str string) ValueType {
         return PairType
     case "path":
         return PathType
-    case "color":
+    case "color", "rgbcolor":
         return ColorType
+    case "cmykcolor":
+        return CMYKColorType
     case "pen":
         return PenType
+    case "picture":
+        return PictureType
+    case "boolean":
+        return BooleanType
+    case "string":
+        return StringType
+    case "transform":
+        return TransformType
     }
     return Undefined
 }
@@ -274,6 +274,12 @@ func CreateVarRef(decl *Suffix, value pmmp.Value, indices []float64) *VarRef {
 	if decl.Type() == pmmp.PairType {
 		return createPairTypeVarRef(v, decl, value, indices)
 	}
+	if decl.Type() == pmmp.TransformType {
+		return createTransformTypeVarRef(v, decl, value, indices)
+	}
+	if decl.Type() == pmmp.ColorType || decl.Type() == pmmp.CMYKColorType {
+		return createColorTypeVarRef(v, decl, value, indices)
+	}
 	return v
 }
 
@@ -363,7 +369,7 @@ func (v *VarRef) SuffixesString() string {
 // }
 //
 type pairVarValues struct { // has to satisfy interface pmmp.Value
-	values [2]PairPartValue // but is not used as an actual value
+	values []PairPartValue // but is not used as an actual value
 }
 
 func (pv *pairVarValues) Self() pmmp.ValueBase {
@@ -371,7 +377,12 @@ func (pv *pairVarValues) Self() pmmp.ValueBase {
 }
 
 func (pv *pairVarValues) IsKnown() bool {
-	return pv.values[0].Value.IsKnown() && pv.values[1].Value.IsKnown()
+	for _, ppv := range pv.values {
+		if ppv.Value == nil || !ppv.Value.IsKnown() {
+			return false
+		}
+	}
+	return true
 }
 
 func (pv *pairVarValues) Type() pmmp.ValueType {
@@ -389,21 +400,30 @@ func (pv *pairVarValues) yPart() *PairPartValue {
 // PairPartValue is a pseudo-variable to hold a pair part value of a
 // pair variable. It is wrapped into a variable struct to be able to feed
 // it into the LEQ solver.
+//
+// Variables of type transform use the same mechanism for their six parts.
 type PairPartValue struct {
 	runtime.Tag
 	id       int32
 	variable *VarRef
+	partname string // "xpart", "ypart", …
 	Value    pmmp.Value
 }
 
-func newPairVarValues(v *VarRef) *pairVarValues {
-	ppv := &pairVarValues{}
-	ppv.values[0].id = v.id
-	ppv.values[0].variable = v
-	ppv.values[0].Tag.UData = ppv.values[0]
-	ppv.values[1].id = serialCounter.Get()
-	ppv.values[1].variable = v
-	ppv.values[1].Tag.UData = ppv.values[1]
+// newPairVarValues creates the part values for a pair or transform
+// variable. The first part shares the ID of the variable.
+func newPairVarValues(v *VarRef, partnames ...string) *pairVarValues {
+	ppv := &pairVarValues{values: make([]PairPartValue, len(partnames))}
+	for i, name := range partnames {
+		if i == 0 {
+			ppv.values[i].id = v.id
+		} else {
+			ppv.values[i].id = serialCounter.Get()
+		}
+		ppv.values[i].variable = v
+		ppv.values[i].partname = name
+		ppv.values[i].Tag.UData = &ppv.values[i]
+	}
 	return ppv
 }
 
@@ -412,22 +432,57 @@ func createPairTypeVarRef(v *VarRef, decl *Suffix, value pmmp.Value, indices []f
 	tracer().Debugf("extending pair var for %v", decl.FullName())
 	v.Typ = int8(pmmp.PairType)
 	tracer().Debugf("creating pair values proxy")
-	pv := newPairVarValues(v)
+	pv := newPairVarValues(v, "xpart", "ypart")
 	v.Value = pv
 	v.Set(value)
 	return v
 }
 
+// createTransformTypeVarRef creates a transform variable reference. Low level
+// method.
+func createTransformTypeVarRef(v *VarRef, decl *Suffix, value pmmp.Value, indices []float64) *VarRef {
+	tracer().Debugf("extending transform var for %v", decl.FullName())
+	v.Typ = int8(pmmp.TransformType)
+	var names []string
+	for p := pmmp.XPart; p <= pmmp.YYPart; p++ {
+		names = append(names, p.String())
+	}
+	v.Value = newPairVarValues(v, names...)
+	v.Set(value)
+	return v
+}
+
+// createColorTypeVarRef creates a color or cmykcolor variable reference. Low
+// level method.
+func createColorTypeVarRef(v *VarRef, decl *Suffix, value pmmp.Value, indices []float64) *VarRef {
+	tracer().Debugf("extending color var for %v", decl.FullName())
+	first, last := pmmp.RedPart, pmmp.BluePart
+	if decl.Type() == pmmp.CMYKColorType {
+		first, last = pmmp.CyanPart, pmmp.BlackPart
+	}
+	var names []string
+	for p := first; p <= last; p++ {
+		names = append(names, p.String())
+	}
+	v.Value = newPairVarValues(v, names...)
+	v.Set(value)
+	return v
+}
+
 // Name returns a string for a pair part.
 // Pair parts (x-part or y-part) return the name of their parent pair symbol,
 // prepending "xpart" or "ypart" respectively. This name is constant and
-// may be used to store the pair part in a symbol table.
+// may be used to store the pair part in a symbol table. Transform parts are
+// named the same way, e.g. "xxpart T".
 //
 func (ppv *PairPartValue) Name() string {
-	if ppv.variable.id == ppv.id {
-		return "xpart " + ppv.variable.FullName()
-	}
-	return "ypart " + ppv.variable.FullName()
+	return ppv.partname + " " + ppv.variable.FullName()
+}
+
+// ID gets the pair part's ID. The ID of the x-part is identical to the ID
+// of the parent pair variable.
+func (ppv *PairPartValue) ID() int32 {
+	return ppv.id
 }
 
 // Type returns the type of a pair part, which is always numeric.
@@ -454,6 +509,32 @@ func (v *VarRef) IsPair() bool {
 	return v.Type() == pmmp.PairType
 }
 
+// IsTransform is a predicate: is this variable of type transform?
+func (v *VarRef) IsTransform() bool {
+	return v.Type() == pmmp.TransformType
+}
+
+// IsColor is a predicate: is this variable of type color or cmykcolor?
+func (v *VarRef) IsColor() bool {
+	return v.Type() == pmmp.ColorType || v.Type() == pmmp.CMYKColorType
+}
+
+// Parts returns the numeric parts of a pair, transform or color variable, in
+// the order of xpart, ypart, xxpart, xypart, yxpart and yypart, or of the
+// parts of the color model, respectively. For variables of other types,
+// Parts returns nil.
+func (v *VarRef) Parts() []*PairPartValue {
+	values, ok := v.Value.(*pairVarValues)
+	if !ok {
+		return nil
+	}
+	parts := make([]*PairPartValue, len(values.values))
+	for i := range values.values {
+		parts[i] = &values.values[i]
+	}
+	return parts
+}
+
 // XPart gets the x-part of a pair variable
 func (v *VarRef) XPart() *PairPartValue {
 	if !v.IsPair() {
@@ -464,13 +545,13 @@ func (v *VarRef) XPart() *PairPartValue {
 		panic("pair variable must never be without values proxy")
 	}
 	values := v.Value.(*pairVarValues)
-	return values.yPart()
+	return values.xPart()
 }
 
 // YPart gets the y-part of a pair variable
 func (v *VarRef) YPart() *PairPartValue {
 	if !v.IsPair() {
-		tracer().P("var", v.Name).Errorf("cannot access x-part of non-pair")
+		tracer().P("var", v.Name).Errorf("cannot access y-part of non-pair")
 		return nil
 	}
 	if v.Value == nil {
@@ -543,14 +624,35 @@ func (v *VarRef) FullName() string {
 
 // HasKnownValue is a predicate: has this variable a known value?
 func (v *VarRef) HasKnownValue() bool {
-	if !v.IsPair() {
-		return v.Value.IsKnown()
+	if !v.IsPair() && !v.IsTransform() && !v.IsColor() {
+		return v.Value != nil && v.Value.IsKnown()
 	}
 	return v.Value.(*pairVarValues).IsKnown()
 }
 
 // Get gets a variable's value.
 func (v *VarRef) Get() pmmp.Value {
+	if v.IsTransform() {
+		var parts [6]pmmp.Numeric
+		for i, ppv := range v.Parts() {
+			if ppv.Value != nil {
+				parts[i] = ppv.Value.Self().AsNumeric()
+			}
+		}
+		return pmmp.NewTransform(parts)
+	}
+	if v.IsColor() {
+		parts := make([]pmmp.Numeric, 4)
+		for i, ppv := range v.Parts() {
+			if ppv.Value != nil {
+				parts[i] = ppv.Value.Self().AsNumeric()
+			}
+		}
+		if v.Type() == pmmp.CMYKColorType {
+			return pmmp.NewCMYKColor(parts[0], parts[1], parts[2], parts[3])
+		}
+		return pmmp.NewColor(parts[0], parts[1], parts[2])
+	}
 	if !v.IsPair() {
 		return v.Value
 	}
@@ -564,6 +666,35 @@ func (v *VarRef) Get() pmmp.Value {
 // Set sets a variable's value.
 func (v *VarRef) Set(val pmmp.Value) {
 	tracer().P("var", v.Name).Debugf("new value: %v", val)
+	if v.IsTransform() {
+		t, ok := val.(pmmp.Transform)
+		if val != nil && !ok {
+			tracer().P("var", v.Name).Errorf("cannot set transform to %v", val)
+			return
+		}
+		for i, ppv := range v.Parts() {
+			if val == nil {
+				ppv.Value = pmmp.Numeric{}
+			} else {
+				ppv.Value = t.Part(pmmp.TransformPart(i))
+			}
+		}
+		return
+	}
+	if v.IsColor() {
+		var parts []pmmp.Numeric
+		if c, ok := val.(pmmp.Color); ok {
+			parts = c.Parts()
+		}
+		for i, ppv := range v.Parts() {
+			if i < len(parts) {
+				ppv.Value = parts[i]
+			} else {
+				ppv.Value = pmmp.Numeric{}
+			}
+		}
+		return
+	}
 	if !v.IsPair() {
 		switch v.Type() {
 		case pmmp.NumericType:
@@ -572,6 +703,8 @@ func (v *VarRef) Set(val pmmp.Value) {
 			} else {
 				v.Value = val
 			}
+		default:
+			v.Value = val
 		}
 		return
 	}
@@ -647,10 +780,12 @@ func (v *VarRef) ValueString() string {
 func (v *VarRef) Reincarnate() int32 {
 	oldserial := v.id
 	v.id = serialCounter.Get()
-	if v.IsPair() {
-		ypartid := serialCounter.Get()
-		v.XPart().id = v.id
-		v.YPart().id = ypartid
+	for i, ppv := range v.Parts() {
+		if i == 0 {
+			ppv.id = v.id
+		} else {
+			ppv.id = serialCounter.Get()
+		}
 	}
 	return oldserial
 }
@@ -663,11 +798,12 @@ type UniqueID struct {
 }
 
 // Get fetches a new unique id from this counter.
+// IDs start at 1, as ID 0 denotes the constant term of polynomials.
 func (c *UniqueID) Get() int32 {
 	for {
 		val := atomic.LoadInt32(&c.counter)
 		if atomic.CompareAndSwapInt32(&c.counter, val, val+1) {
-			return val
+			return val + 1
 		}
 	}
 }
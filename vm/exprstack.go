@@ -7,6 +7,7 @@ import (
 	"github.com/npillmayer/arithm"
 	"github.com/npillmayer/arithm/polyn"
 	"github.com/npillmayer/gorgo/terex"
+	"github.com/npillmayer/pmmp"
 	"github.com/npillmayer/pmmp/sframe"
 )
 
@@ -595,15 +596,22 @@ func (es *ExprStack) MultiplyTOS2OS() error {
 	if e1.IsPair {
 		if e2.IsPair {
 			tracer().Errorf("one multiplicant must be a known numeric")
-			tracer().Errorf("not implemented: <pair> * <pair>")
-		} else {
-			n := e2.XPolyn
-			nn := n.CopyPolynomial()
-			px := e1.XPolyn.Multiply(n, false)
-			py := e1.YPolyn.Multiply(nn, false)
-			e = NewPairExpression(px, py)
+			return fmt.Errorf("not implemented: <pair> * <pair>")
+		}
+		if !isConstant(e2.XPolyn) && !(isConstant(e1.XPolyn) && isConstant(e1.YPolyn)) {
+			tracer().Errorf("nonlinear product: <unknown> * <unknown pair>")
+			return fmt.Errorf("%w: <unknown> * <unknown pair>", pmmp.ErrNonlinear)
 		}
+		n := e2.XPolyn
+		nn := n.CopyPolynomial()
+		px := e1.XPolyn.Multiply(n, false)
+		py := e1.YPolyn.Multiply(nn, false)
+		e = NewPairExpression(px, py)
 	} else {
+		if !isConstant(e1.XPolyn) && !isConstant(e2.XPolyn) {
+			tracer().Errorf("nonlinear product: <unknown> * <unknown>")
+			return fmt.Errorf("%w: <unknown> * <unknown>", pmmp.ErrNonlinear)
+		}
 		px := e1.XPolyn.Multiply(e2.XPolyn, false)
 		e = NewNumericExpression(px)
 	}
@@ -612,6 +620,12 @@ func (es *ExprStack) MultiplyTOS2OS() error {
 	return nil
 }
 
+// isConstant is a predicate: is p a known numeric?
+func isConstant(p polyn.Polynomial) bool {
+	_, ok := p.IsConstant()
+	return ok
+}
+
 // DivideTOS2OS divides
 // 2ndOS by TOS. Divisor must be numeric non-0 constant.
 func (es *ExprStack) DivideTOS2OS() error {
@@ -625,6 +639,10 @@ func (es *ExprStack) DivideTOS2OS() error {
 		tracer().Errorf("divisor must be a known non-zero numeric")
 		return fmt.Errorf("not implemented: division by <pair>")
 	}
+	if c, ok := e2.XPolyn.IsConstant(); !ok || arithm.Is0(c) {
+		tracer().Errorf("divisor must be a known non-zero numeric")
+		return fmt.Errorf("illegal divisor: %s", e2.String())
+	}
 	if e1.IsPair {
 		n := e2.XPolyn
 		nn := n.CopyPolynomial()
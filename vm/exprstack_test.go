@@ -1,10 +1,13 @@
 package vm
 
 import (
+	"errors"
 	"log"
 	"testing"
 
+	"github.com/npillmayer/arithm"
 	"github.com/npillmayer/arithm/polyn"
+	"github.com/npillmayer/pmmp"
 )
 
 type X struct { // helper for quick construction of polynomials
@@ -104,6 +107,27 @@ func TestStackMultiply(t *testing.T) {
 }
 */
 
+func TestStackNonlinear(t *testing.T) {
+	est := NewExprStack()
+	est.PushPairConstant(arithm.P(1, 2))
+	est.PushPairConstant(arithm.P(3, 4))
+	if err := est.MultiplyTOS2OS(); err == nil {
+		t.Errorf("expected <pair> * <pair> to be an error")
+	}
+	est = NewExprStack()
+	est.Push(NewNumericExpression(polynom(1, X{1, 2})))
+	est.Push(NewNumericExpression(polynom(0, X{2, 1})))
+	if err := est.MultiplyTOS2OS(); !errors.Is(err, pmmp.ErrNonlinear) {
+		t.Errorf("expected <unknown> * <unknown> to be nonlinear, error is %v", err)
+	}
+	est = NewExprStack()
+	est.Push(NewNumericExpression(polynom(1, X{1, 2})))
+	est.PushConstant(0)
+	if err := est.DivideTOS2OS(); err == nil {
+		t.Errorf("expected division by zero to be an error")
+	}
+}
+
 /*
 func TestStackDivide(t *testing.T) {
 	est := NewExprStack()